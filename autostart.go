@@ -0,0 +1,80 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"strconv"
+
+	"github.com/arduino/arduino-create-agent/config"
+	"github.com/arduino/go-paths-helper"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// AutostartStatus is the state of the automatic start of the agent after login on macOS
+type AutostartStatus struct {
+	Autostart bool `json:"autostart"`
+}
+
+// autostartEnabled returns true if the agent starts automatically after login
+func autostartEnabled() bool {
+	return runtime.GOOS == "darwin" && config.PlistFileInstalled()
+}
+
+func autostartHandler(c *gin.Context) {
+	if runtime.GOOS != "darwin" {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "autostart is supported only on macOS"})
+		return
+	}
+	c.JSON(http.StatusOK, AutostartStatus{Autostart: autostartEnabled()})
+}
+
+// setAutostartHandler installs or removes the launchd agent. The choice is saved
+// in the config file, otherwise it would be reverted at the next start.
+func setAutostartHandler(configPath *paths.Path) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if runtime.GOOS != "darwin" {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "autostart is supported only on macOS"})
+			return
+		}
+
+		var data AutostartStatus
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var err error
+		if data.Autostart {
+			err = config.EnableAutostart()
+		} else {
+			err = config.DisableAutostart()
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if configPath != nil {
+			if err := config.SetAutostartMacOSIni(configPath.String(), strconv.FormatBool(data.Autostart)); err != nil {
+				log.Errorf("cannot set autostartMacOS value in config.ini: %s", err)
+			}
+		}
+		c.JSON(http.StatusOK, AutostartStatus{Autostart: autostartEnabled()})
+	}
+}
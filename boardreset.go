@@ -0,0 +1,115 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// boardResetWindow is the time within which a port reappearing with the
+// same identity is considered a reset of the board, and not a new connection
+const boardResetWindow = 5 * time.Second
+
+// boardResetDetector recognizes the boards resetting unexpectedly (e.g. for a
+// brownout or the watchdog), whose port disappears and reappears shortly after
+type boardResetDetector struct {
+	mu sync.Mutex
+	// the ports disappeared, by name
+	removed map[string]removedPort
+	// the ports closed because of an error, by name, to reopen them after the reset
+	closedByError map[string]closedPort
+}
+
+type removedPort struct {
+	identity string
+	time     time.Time
+}
+
+type closedPort struct {
+	conf       *SerialConfig
+	bufferType string
+	time       time.Time
+}
+
+var boardResets = boardResetDetector{
+	removed:       map[string]removedPort{},
+	closedByError: map[string]closedPort{},
+}
+
+// portIdentity identifies the board connected to a port
+func portIdentity(port *SpPortItem) string {
+	return port.VendorID + ":" + port.ProductID + ":" + port.SerialNumber
+}
+
+func (d *boardResetDetector) portRemoved(port *SpPortItem) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.removed[port.Name] = removedPort{identity: portIdentity(port), time: time.Now()}
+}
+
+// removedIdentity returns the identity of the board connected to a port that disappeared
+func (d *boardResetDetector) removedIdentity(portname string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	removed, ok := d.removed[portname]
+	return removed.identity, ok
+}
+
+func (d *boardResetDetector) portClosedByError(conf *SerialConfig, bufferType string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closedByError[conf.Name] = closedPort{conf: conf, bufferType: bufferType, time: time.Now()}
+}
+
+// portAdded returns true if the port is reappearing after a reset, and the
+// configuration of the port if it was open when the board reset
+func (d *boardResetDetector) portAdded(port *SpPortItem) (bool, *closedPort) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	removed, ok := d.removed[port.Name]
+	closed, wasOpen := d.closedByError[port.Name]
+	delete(d.removed, port.Name)
+	delete(d.closedByError, port.Name)
+	if !ok || removed.identity != portIdentity(port) || time.Since(removed.time) > boardResetWindow {
+		return false, nil
+	}
+	if !wasOpen || time.Since(closed.time) > boardResetWindow {
+		return true, nil
+	}
+	return true, &closed
+}
+
+// checkBoardReset sends the BoardReset event if the port is reappearing after a reset
+// of the board, and reopens the port if it was open and reopenOnReset is enabled.
+// The resets during the uploads are expected, so they are ignored.
+func checkBoardReset(port *SpPortItem) {
+	reset, closed := boardResets.portAdded(port)
+	if !reset || currentUpload.status().InProgress {
+		return
+	}
+	event, _ := json.Marshal(map[string]interface{}{
+		"Cmd":      "BoardReset",
+		"Port":     port.Name,
+		"WasOpen":  closed != nil,
+		"Reopened": closed != nil && reopenOnReset.Load(),
+	})
+	h.broadcastSys <- event
+	if closed != nil && reopenOnReset.Load() {
+		go spHandlerOpen(closed.conf, closed.bufferType)
+	}
+}
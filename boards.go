@@ -0,0 +1,121 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BoardCandidate is a board that could be connected to a port
+type BoardCandidate struct {
+	Fqbn       string  `json:"fqbn"`
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`
+}
+
+// BoardIdentification is the result of the identification of the board connected to a port
+type BoardIdentification struct {
+	Port         string           `json:"port"`
+	VendorID     string           `json:"vid"`
+	ProductID    string           `json:"pid"`
+	SerialNumber string           `json:"serialNumber"`
+	Candidates   []BoardCandidate `json:"candidates"`
+}
+
+type knownBoard struct {
+	vid, pid string
+	fqbn     string
+	name     string
+}
+
+// knownBoards maps the USB identifiers to the boards using them.
+// The package index doesn't carry this information, so we keep the most common ones here.
+// Some USB-serial converters are used by many boards, in that case all of them are listed.
+var knownBoards = []knownBoard{
+	{"0x2341", "0x0043", "arduino:avr:uno", "Arduino Uno"},
+	{"0x2341", "0x0001", "arduino:avr:uno", "Arduino Uno"},
+	{"0x2a03", "0x0043", "arduino:avr:uno", "Arduino Uno"},
+	{"0x2341", "0x0243", "arduino:avr:uno", "Arduino Uno"},
+	{"0x2341", "0x0010", "arduino:avr:mega", "Arduino Mega or Mega 2560"},
+	{"0x2341", "0x0042", "arduino:avr:mega", "Arduino Mega or Mega 2560"},
+	{"0x2a03", "0x0042", "arduino:avr:mega", "Arduino Mega or Mega 2560"},
+	{"0x2341", "0x0036", "arduino:avr:leonardo", "Arduino Leonardo"},
+	{"0x2341", "0x8036", "arduino:avr:leonardo", "Arduino Leonardo"},
+	{"0x2341", "0x0037", "arduino:avr:micro", "Arduino Micro"},
+	{"0x2341", "0x8037", "arduino:avr:micro", "Arduino Micro"},
+	{"0x2341", "0x0058", "arduino:megaavr:nona4809", "Arduino Nano Every"},
+	{"0x2341", "0x004d", "arduino:samd:arduino_zero_native", "Arduino Zero (Native USB Port)"},
+	{"0x2341", "0x804d", "arduino:samd:arduino_zero_native", "Arduino Zero (Native USB Port)"},
+	{"0x2341", "0x804e", "arduino:samd:mkr1000", "Arduino MKR1000"},
+	{"0x2341", "0x8054", "arduino:samd:mkrwifi1010", "Arduino MKR WiFi 1010"},
+	{"0x2341", "0x8057", "arduino:samd:nano_33_iot", "Arduino NANO 33 IoT"},
+	{"0x2341", "0x805a", "arduino:mbed_nano:nano33ble", "Arduino Nano 33 BLE"},
+	{"0x2341", "0x025b", "arduino:mbed_portenta:envie_m7", "Arduino Portenta H7"},
+	{"0x2341", "0x0069", "arduino:renesas_uno:minima", "Arduino UNO R4 Minima"},
+	{"0x2341", "0x1002", "arduino:renesas_uno:unor4wifi", "Arduino UNO R4 WiFi"},
+	{"0x1a86", "0x7523", "arduino:avr:uno", "Arduino Uno (CH340 clone)"},
+	{"0x1a86", "0x7523", "arduino:avr:nano", "Arduino Nano (CH340 clone)"},
+	{"0x0403", "0x6001", "arduino:avr:nano", "Arduino Nano (FTDI)"},
+	{"0x0403", "0x6001", "arduino:avr:diecimila", "Arduino Duemilanove or Diecimila (FTDI)"},
+}
+
+// identifyBoard returns the boards matching the given vid and pid.
+// The confidence is split between the boards sharing the same identifiers.
+func identifyBoard(vid, pid string) []BoardCandidate {
+	vid, pid = strings.ToLower(vid), strings.ToLower(pid)
+
+	candidates := []BoardCandidate{}
+	for _, b := range knownBoards {
+		if b.vid == vid && b.pid == pid {
+			candidates = append(candidates, BoardCandidate{Fqbn: b.fqbn, Name: b.name})
+		}
+	}
+	for i := range candidates {
+		candidates[i].Confidence = 1 / float64(len(candidates))
+	}
+	return candidates
+}
+
+func boardIdentifyHandler(c *gin.Context) {
+	portName := c.Query("port")
+	if portName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "port is required"})
+		return
+	}
+
+	serialPorts.portsLock.Lock()
+	port := serialPorts.getPortByName(portName)
+	var res BoardIdentification
+	if port != nil {
+		res = BoardIdentification{
+			Port:         port.Name,
+			VendorID:     port.VendorID,
+			ProductID:    port.ProductID,
+			SerialNumber: port.SerialNumber,
+		}
+	}
+	serialPorts.portsLock.Unlock()
+
+	if port == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "port " + portName + " not found"})
+		return
+	}
+	res.Candidates = identifyBoard(res.VendorID, res.ProductID)
+	c.JSON(http.StatusOK, res)
+}
@@ -15,9 +15,20 @@
 
 package main
 
+import "time"
+
 // Bufferflow interface
 type Bufferflow interface {
 	Init()
 	OnIncomingData(data string) // implement this method
 	Close()                     // implement this method
 }
+
+// messageTimestamp returns the time to attach to the messages read from a port,
+// or an empty string if the timestamp is not enabled
+func messageTimestamp(enabled bool) string {
+	if !enabled {
+		return ""
+	}
+	return time.Now().Format(time.RFC3339Nano)
+}
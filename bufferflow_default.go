@@ -23,19 +23,21 @@ import (
 
 // BufferflowDefault is the default bufferflow, whick means no buffering
 type BufferflowDefault struct {
-	port   string
-	output chan<- []byte
-	input  chan string
-	done   chan bool
+	port      string
+	output    func(serialMessage)
+	input     chan string
+	done      chan bool
+	timestamp bool
 }
 
 // NewBufferflowDefault create a new default bufferflow
-func NewBufferflowDefault(port string, output chan<- []byte) *BufferflowDefault {
+func NewBufferflowDefault(port string, output func(serialMessage), timestamp bool) *BufferflowDefault {
 	return &BufferflowDefault{
-		port:   port,
-		output: output,
-		input:  make(chan string),
-		done:   make(chan bool),
+		port:      port,
+		output:    output,
+		input:     make(chan string),
+		done:      make(chan bool),
+		timestamp: timestamp,
 	}
 }
 
@@ -50,9 +52,9 @@ Loop:
 	for {
 		select {
 		case data := <-b.input:
-			m := SpPortMessage{b.port, data}
+			m := SpPortMessage{P: b.port, D: data, T: messageTimestamp(b.timestamp)}
 			message, _ := json.Marshal(m)
-			b.output <- message
+			b.output(serialMessage{port: b.port, data: []byte(data), json: message})
 		case <-b.done:
 			break Loop //this is required, a simple break statement would only exit the innermost switch statement
 		}
@@ -25,16 +25,17 @@ import (
 // BufferflowTimed sends data once every 16ms
 type BufferflowTimed struct {
 	port           string
-	output         chan<- []byte
+	output         func(serialMessage)
 	input          chan string
 	done           chan bool
 	ticker         *time.Ticker
 	sPort          string
 	bufferedOutput string
+	timestamp      bool
 }
 
 // NewBufferflowTimed will create a new timed bufferflow
-func NewBufferflowTimed(port string, output chan<- []byte) *BufferflowTimed {
+func NewBufferflowTimed(port string, output func(serialMessage), timestamp bool) *BufferflowTimed {
 	return &BufferflowTimed{
 		port:           port,
 		output:         output,
@@ -43,6 +44,7 @@ func NewBufferflowTimed(port string, output chan<- []byte) *BufferflowTimed {
 		ticker:         time.NewTicker(16 * time.Millisecond),
 		sPort:          "",
 		bufferedOutput: "",
+		timestamp:      timestamp,
 	}
 }
 
@@ -61,9 +63,9 @@ Loop:
 			b.sPort = b.port
 		case <-b.ticker.C: // after 16ms send the buffered output message
 			if b.bufferedOutput != "" {
-				m := SpPortMessage{b.sPort, b.bufferedOutput}
+				m := SpPortMessage{P: b.sPort, D: b.bufferedOutput, T: messageTimestamp(b.timestamp)}
 				buf, _ := json.Marshal(m)
-				b.output <- buf
+				b.output(serialMessage{port: b.sPort, data: []byte(b.bufferedOutput), json: buf})
 				// reset the buffer and the port
 				b.bufferedOutput = ""
 				b.sPort = ""
@@ -25,16 +25,17 @@ import (
 // BufferflowTimedRaw sends raw data once every 16ms
 type BufferflowTimedRaw struct {
 	port              string
-	output            chan<- []byte
+	output            func(serialMessage)
 	input             chan string
 	done              chan bool
 	ticker            *time.Ticker
 	bufferedOutputRaw []byte
 	sPortRaw          string
+	timestamp         bool
 }
 
 // NewBufferflowTimedRaw will create a new raw bufferflow
-func NewBufferflowTimedRaw(port string, output chan<- []byte) *BufferflowTimedRaw {
+func NewBufferflowTimedRaw(port string, output func(serialMessage), timestamp bool) *BufferflowTimedRaw {
 	return &BufferflowTimedRaw{
 		port:              port,
 		output:            output,
@@ -43,6 +44,7 @@ func NewBufferflowTimedRaw(port string, output chan<- []byte) *BufferflowTimedRa
 		ticker:            time.NewTicker(16 * time.Millisecond),
 		bufferedOutputRaw: nil,
 		sPortRaw:          "",
+		timestamp:         timestamp,
 	}
 }
 
@@ -61,10 +63,10 @@ Loop:
 			b.sPortRaw = b.port
 		case <-b.ticker.C: // after 16ms send the buffered output message
 			if b.bufferedOutputRaw != nil {
-				m := SpPortMessageRaw{b.sPortRaw, b.bufferedOutputRaw}
+				m := SpPortMessageRaw{P: b.sPortRaw, D: b.bufferedOutputRaw, T: messageTimestamp(b.timestamp)}
 				buf, _ := json.Marshal(m)
 				// since bufferedOutputRaw is a []byte is base64-encoded by json.Marshal() function automatically
-				b.output <- buf
+				b.output(serialMessage{port: b.sPortRaw, data: b.bufferedOutputRaw, json: buf})
 				// reset the buffer and the port
 				b.bufferedOutputRaw = nil
 				b.sPortRaw = ""
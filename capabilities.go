@@ -0,0 +1,67 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Capabilities are the features supported by the agent, the clients can use
+// them to adapt to the running agent instead of checking its version
+type Capabilities struct {
+	Version  string          `json:"version"`
+	Features map[string]bool `json:"features"`
+}
+
+func getCapabilities() Capabilities {
+	return Capabilities{
+		Version: version,
+		Features: map[string]bool{
+			"serialUpload":        true,
+			"uploadRetries":       true,
+			"uploadStatus":        true,
+			"networkUpload":       false, // OTA uploads are not supported anymore
+			"ble":                 false,
+			"sendRaw":             true, // base64 encoded binary data
+			"sendFile":            true,
+			"touch":               true,
+			"loopbackTest":        true, // needs a jumper between TX and RX
+			"messageTimestamp":    true,
+			"lineEndings":         true,
+			"recording":           true,
+			"boardIdentification": true,
+			"boardReset":          true,
+			"portsGrouping":       groupPorts.Load(),
+			"virtualPort":         *virtualPort,
+			"readiness":           true,
+			"toolsV2":             true,
+			"binarySerial":        true, // serial data as binary frames, with the binary=true parameter
+			"serialV2":            true, // open and close the ports on /v2/serial
+		},
+	}
+}
+
+func capabilitiesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, getCapabilities())
+}
+
+func broadcastCapabilities() {
+	capabilities, _ := json.Marshal(map[string]Capabilities{"Capabilities": getCapabilities()})
+	h.broadcastSys <- capabilities
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/http"
+	"runtime"
+
+	cert "github.com/arduino/arduino-create-agent/certificates"
+	"github.com/arduino/arduino-create-agent/config"
+	"github.com/arduino/go-paths-helper"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// CertTrustGuide explains how to trust the certificate authority of the agent,
+// used to sign the certificate of the HTTPS server
+type CertTrustGuide struct {
+	OS string `json:"os"`
+	// CACert is the path of the certificate to trust, empty if it has not been generated
+	CACert  string `json:"caCert"`
+	Trusted bool   `json:"trusted"`
+	// CanInstall is true if the agent can trust the certificate by itself, with a PUT on the same
+	// endpoint sending the admin token
+	CanInstall bool     `json:"canInstall"`
+	Steps      []string `json:"steps"`
+	// Command is the command that trusts the certificate, to run in a terminal
+	Command string `json:"command,omitempty"`
+}
+
+// certTrustGuide returns the instructions to trust the certificate in certsDir for the given OS
+func certTrustGuide(goos string, certsDir *paths.Path) CertTrustGuide {
+	guide := CertTrustGuide{OS: goos, Steps: []string{}}
+	caCert := certsDir.Join("ca.cert.cer")
+	if caCert.NotExist() {
+		guide.Steps = append(guide.Steps, "The HTTPS certificate has not been generated yet: enable it from the \"Manage HTTPS certificate\" menu of the agent")
+		return guide
+	}
+	guide.CACert = caCert.String()
+
+	switch goos {
+	case "darwin":
+		guide.CanInstall = true
+		guide.Command = `security add-trusted-cert -r trustRoot -k "$HOME/Library/Keychains/login.keychain-db" "` + caCert.String() + `"`
+		guide.Steps = append(guide.Steps,
+			"Open the \"Manage HTTPS certificate\" menu of the agent and click \"Install the certificate for Safari\", or run the command in a terminal",
+			"Enter your password to allow the changes to the keychain",
+			"Restart Safari")
+	case "windows":
+		guide.Command = `certutil -user -addstore Root "` + caCert.String() + `"`
+		guide.Steps = append(guide.Steps,
+			"Run the command in a command prompt, or double click on the certificate and choose \"Install Certificate...\"",
+			"Select \"Place all certificates in the following store\" and choose \"Trusted Root Certification Authorities\"",
+			"Confirm the security warning and restart the browser")
+	default:
+		pemCert := certsDir.Join("ca.cert.pem")
+		guide.Command = `sudo cp "` + pemCert.String() + `" /usr/local/share/ca-certificates/arduino-create-agent.crt && sudo update-ca-certificates`
+		guide.Steps = append(guide.Steps,
+			"Run the command in a terminal to trust the certificate system wide (Debian and Ubuntu based distributions)",
+			"Firefox and Chrome use their own list: import "+pemCert.String()+" in the \"Authorities\" tab of the certificates settings of the browser",
+			"Restart the browser")
+	}
+	return guide
+}
+
+func certTrustHandler(c *gin.Context) {
+	guide := certTrustGuide(runtime.GOOS, config.GetCertificatesDir())
+	if runtime.GOOS == "darwin" && guide.CACert != "" {
+		guide.Trusted = cert.CertInKeychain()
+	}
+	c.JSON(http.StatusOK, guide)
+}
+
+// installCertHandler trusts the certificate on macOS, the keychain asks the
+// password to the user. Like the systray menu, the choice is saved in the config file.
+// It's bound to a PUT so that the browsers ask the CORS permission before calling it,
+// and it requires the admin token because it changes the trusted certificates of the user.
+func installCertHandler(configPath *paths.Path) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if runtime.GOOS != "darwin" {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "the certificate can be installed by the agent only on macOS, follow the steps instead"})
+			return
+		}
+		caCert := config.GetCertificatesDir().Join("ca.cert.cer")
+		if caCert.NotExist() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "the HTTPS certificate has not been generated yet"})
+			return
+		}
+		if !cert.CertInKeychain() {
+			if err := cert.InstallCertificate(caCert); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if configPath != nil {
+				if err := config.SetInstallCertsIni(configPath.String(), "true"); err != nil {
+					log.Errorf("cannot set installCerts value in config.ini: %s", err)
+				}
+			}
+		}
+		guide := certTrustGuide(runtime.GOOS, config.GetCertificatesDir())
+		guide.Trusted = cert.CertInKeychain()
+		c.JSON(http.StatusOK, guide)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/arduino/arduino-create-agent/utilities"
+	shellwords "github.com/mattn/go-shellwords"
+)
+
+// getCommandlineOverride returns the commandline to use instead of the one derived from the index
+// and sent in the upload request, or an empty string if it's not overridden. In order of priority:
+//   - the commandline_override of the request, accepted depending on the allowCommandlineOverride setting:
+//     "off" never, "signed" only if it's signed like the commandline, "on" always.
+//     With requireSignature "on" behaves like "signed"
+//   - the commandline set for the board in the commandlineOverrides file, a json object mapping
+//     the FQBN of the boards to their commandline
+//
+// The executable of an overridden commandline must be one of the installed tools, see checkExecutable.
+func getCommandlineOverride(data Upload, pubKeys []*rsa.PublicKey) (string, error) {
+	if data.CommandlineOverride != "" {
+		switch mode := allowCmdOverride.Load(); {
+		case mode == "on" && !requireSignature.Load():
+		case mode == "on" || mode == "signed":
+			if err := utilities.VerifyInput(data.CommandlineOverride, data.CommandlineOverrideSignature, pubKeys); err != nil {
+				return "", errors.New("the signature of the commandline override is invalid")
+			}
+		default:
+			return "", errors.New("the commandline override is not allowed by the agent configuration")
+		}
+		return data.CommandlineOverride, nil
+	}
+
+	commandlineOverrides.RLock()
+	defer commandlineOverrides.RUnlock()
+	return commandlineOverrides.byBoard[data.Board], nil
+}
+
+// commandlineOverrides are the commandlines of the commandlineOverrides file, by FQBN
+var commandlineOverrides struct {
+	sync.RWMutex
+	byBoard map[string]string
+}
+
+// loadCommandlineOverrides reads the commandlineOverrides file, it must be called
+// again when the setting changes. The overrides are cleared if the file can't be read.
+func loadCommandlineOverrides(file string) error {
+	overrides := map[string]string{}
+	var err error
+	if file != "" {
+		var content []byte
+		if content, err = os.ReadFile(file); err == nil {
+			if err = json.Unmarshal(content, &overrides); err != nil {
+				err = errors.New("cannot parse " + file + ": " + err.Error())
+			}
+		}
+	}
+	if err != nil {
+		overrides = map[string]string{}
+	}
+	commandlineOverrides.Lock()
+	commandlineOverrides.byBoard = overrides
+	commandlineOverrides.Unlock()
+	return err
+}
+
+// checkExecutable checks that the executable of the resolved commandline is inside the install
+// directory of one of the tools installed by the agent, so that an overridden commandline can't
+// run arbitrary programs, e.g. the files of the uploads
+func checkExecutable(commandline string, toolDirs []string) error {
+	args, err := shellwords.Parse(commandline)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("the commandline is empty")
+	}
+	executable, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+	for _, dir := range toolDirs {
+		toolDir, err := filepath.Abs(filepath.FromSlash(dir))
+		if err != nil || dir == "" {
+			continue
+		}
+		if rel, err := filepath.Rel(toolDir, executable); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return errors.New("the executable " + args[0] + " is not one of the installed tools")
+}
@@ -145,6 +145,25 @@ func unloadLaunchdAgent() error {
 	return err
 }
 
+// PlistFileInstalled returns true if the plist file required for the autostart is installed
+func PlistFileInstalled() bool {
+	return getLaunchdAgentPath().Exist()
+}
+
+// EnableAutostart writes the plist file required for the autostart while the agent is running.
+// Unlike InstallPlistFile the agent is not loaded using launchd, because that would start
+// another instance: the agent will start automatically from the next login.
+func EnableAutostart() error {
+	return writePlistFile(getLaunchdAgentPath())
+}
+
+// DisableAutostart removes the plist file required for the autostart while the agent is running.
+// Unlike UninstallPlistFile the agent is not unloaded using launchd, because that would stop
+// the running instance if it has been started by launchd.
+func DisableAutostart() error {
+	return removePlistFile()
+}
+
 // removePlistFile function will remove the plist file from $HOME/Library/LaunchAgents/ArduinoCreateAgent.plist and return an error
 // it will not do anything if the file is not there
 func removePlistFile() error {
@@ -18,6 +18,7 @@ package config
 import (
 	// we need this for the config ini in this package
 	_ "embed"
+	"fmt"
 	"os"
 
 	"github.com/arduino/go-paths-helper"
@@ -27,7 +28,7 @@ import (
 
 // GetCertificatesDir return the directory where SSL certificates are saved
 func GetCertificatesDir() *paths.Path {
-	return GetDataDir()
+	return dataDirPath()
 }
 
 // CertsExist checks if the certs have already been generated
@@ -36,31 +37,62 @@ func CertsExist() bool {
 	return certFile.Exist() //if the certFile is not present we assume there are no certs
 }
 
-// GetDataDir returns the full path to the default Arduino Create Agent data directory.
-func GetDataDir() *paths.Path {
-	userDir, err := os.UserHomeDir()
+// dataDirPath returns the path of the data directory without creating it
+func dataDirPath() *paths.Path {
+	dataDir, err := dataDirLocation()
 	if err != nil {
 		log.Panicf("Could not get user dir: %s", err)
 	}
-	dataDir := paths.New(userDir, ".arduino-create")
+	return dataDir
+}
+
+func dataDirLocation() (*paths.Path, error) {
+	userDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return paths.New(userDir, ".arduino-create"), nil
+}
+
+// GetDataDir returns the full path to the default Arduino Create Agent data directory.
+// If the directory can't be created the path is returned together with the error,
+// the path is nil only if the home directory of the user is unknown.
+func GetDataDir() (*paths.Path, error) {
+	dataDir, err := dataDirLocation()
+	if err != nil {
+		return nil, fmt.Errorf("could not get user dir: %w", err)
+	}
 	if err := dataDir.MkdirAll(); err != nil {
-		log.Panicf("Could not create data dir: %s", err)
+		return dataDir, fmt.Errorf("could not create data dir: %w", err)
 	}
-	return dataDir
+	return dataDir, nil
+}
+
+// GetUploadsDir returns the directory where the files of the uploads are saved
+func GetUploadsDir() (*paths.Path, error) {
+	return getDataSubdir("uploads")
 }
 
 // GetLogsDir return the directory where logs are saved
-func GetLogsDir() *paths.Path {
-	logsDir := GetDataDir().Join("logs")
-	if err := logsDir.MkdirAll(); err != nil {
-		log.Panicf("Can't create logs dir: %s", err)
+func GetLogsDir() (*paths.Path, error) {
+	return getDataSubdir("logs")
+}
+
+func getDataSubdir(name string) (*paths.Path, error) {
+	dataDir, err := dataDirLocation()
+	if err != nil {
+		return nil, fmt.Errorf("could not get user dir: %w", err)
 	}
-	return logsDir
+	dir := dataDir.Join(name)
+	if err := dir.MkdirAll(); err != nil {
+		return dir, fmt.Errorf("can't create %s dir: %w", name, err)
+	}
+	return dir, nil
 }
 
 // LogsIsEmpty checks if the folder containing crash-reports is empty
 func LogsIsEmpty() bool {
-	return GetLogsDir().NotExist() // if the logs directory is empty we assume there are no crashreports
+	return dataDirPath().Join("logs").NotExist() // if the logs directory is empty we assume there are no crashreports
 }
 
 // GetDefaultConfigDir returns the full path to the default Arduino Create Agent configuration directory.
@@ -87,11 +119,22 @@ func GetDefaultConfigDir() *paths.Path {
 
 	agentConfigDir := paths.New(configDir, "ArduinoCreateAgent")
 	if err := agentConfigDir.MkdirAll(); err != nil {
-		log.Panicf("Can't create config dir: %s", err)
+		// the agent is still able to run with the default config, see CheckWritable
+		log.Errorf("Can't create config dir: %s", err)
 	}
 	return agentConfigDir
 }
 
+// CheckWritable returns an error if it's not possible to create files inside dir
+func CheckWritable(dir *paths.Path) error {
+	f, err := os.CreateTemp(dir.String(), ".write-check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
 // GetDefaultHomeDir returns the full path to the user's home directory.
 func GetDefaultHomeDir() *paths.Path {
 	// UserHomeDir returns the current user's home directory.
@@ -111,6 +154,11 @@ func GetDefaultHomeDir() *paths.Path {
 //go:embed config.ini
 var configContent []byte
 
+// DefaultConfig returns the content of the default config.ini
+func DefaultConfig() []byte {
+	return configContent
+}
+
 // GenerateConfig function will take a directory path as an input
 // and will write the default config,ini file to that directory,
 // it will panic if something goes wrong
@@ -128,11 +176,25 @@ func GenerateConfig(destDir *paths.Path) *paths.Path {
 
 // SetInstallCertsIni sets installCerts value to true in the config
 func SetInstallCertsIni(filename string, value string) error {
+	return setIniKey(filename, "installCerts", value)
+}
+
+// SetAutostartMacOSIni sets the autostartMacOS value in the config
+func SetAutostartMacOSIni(filename string, value string) error {
+	return setIniKey(filename, "autostartMacOS", value)
+}
+
+// SetOriginsIni sets the origins value in the config
+func SetOriginsIni(filename string, value string) error {
+	return setIniKey(filename, "origins", value)
+}
+
+func setIniKey(filename, key, value string) error {
 	cfg, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: false, AllowPythonMultilineValues: true}, filename)
 	if err != nil {
 		return err
 	}
-	_, err = cfg.Section("").NewKey("installCerts", value)
+	_, err = cfg.Section("").NewKey(key, value)
 	if err != nil {
 		return err
 	}
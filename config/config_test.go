@@ -0,0 +1,47 @@
+// Copyright 2023 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/arduino/go-paths-helper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDataDirNotCreatable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the home dir is not read from $HOME on windows")
+	}
+	home := paths.New(t.TempDir())
+	t.Setenv("HOME", home.String())
+
+	// a file in place of the data dir prevents its creation, even when running as root
+	require.NoError(t, home.Join(".arduino-create").WriteFile([]byte{}))
+	dataDir, err := GetDataDir()
+	require.Error(t, err)
+	require.Equal(t, home.Join(".arduino-create").String(), dataDir.String())
+	_, err = GetLogsDir()
+	require.Error(t, err)
+	_, err = GetUploadsDir()
+	require.Error(t, err)
+
+	require.NoError(t, home.Join(".arduino-create").Remove())
+	dataDir, err = GetDataDir()
+	require.NoError(t, err)
+	require.NoError(t, CheckWritable(dataDir))
+}
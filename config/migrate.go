@@ -0,0 +1,96 @@
+// Copyright 2023 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/arduino/go-paths-helper"
+)
+
+// Migration is a file copied from the location used by an older version of the agent
+type Migration struct {
+	From *paths.Path
+	To   *paths.Path
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%s -> %s", m.From, m.To)
+}
+
+// certificatesFiles are the files generated by the agent to serve HTTPS
+var certificatesFiles = []string{
+	"ca.key.pem",
+	"ca.cert.pem",
+	"ca.cert.cer",
+	"key.pem",
+	"cert.pem",
+	"cert.cer",
+}
+
+// LegacyDirs returns the directories where the older versions of the agent kept
+// the config.ini and the certificates: the directory of the executable and, on macOS,
+// the install dir used before 1.3.0 ($HOME/Applications/ArduinoCreateAgent).
+// The tools have always been saved in the data dir, so they don't need to be migrated.
+func LegacyDirs() paths.PathList {
+	var dirs paths.PathList
+	if src, err := os.Executable(); err == nil {
+		dirs.Add(paths.New(src).Parent())
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs.Add(paths.New(home, "Applications", "ArduinoCreateAgent", "ArduinoCreateAgent.app", "Contents", "MacOS"))
+	}
+	return dirs
+}
+
+// MigrateLegacy copies the config.ini and the certificates found in the legacyDirs to
+// configDir and certsDir. The files already in the new locations are never overwritten,
+// so it's safe to call it at every start: only the first legacy dir with a file is used.
+// It returns the files copied, even if it fails halfway.
+func MigrateLegacy(legacyDirs paths.PathList, configDir, certsDir *paths.Path) ([]Migration, error) {
+	var migrations []Migration
+	copyFile := func(from, to *paths.Path) error {
+		if err := from.CopyTo(to); err != nil {
+			return fmt.Errorf("cannot copy %s to %s: %w", from, to, err)
+		}
+		migrations = append(migrations, Migration{From: from, To: to})
+		return nil
+	}
+
+	for _, dir := range legacyDirs {
+		if dir.IsDir() && !dir.EquivalentTo(configDir) {
+			legacyConfig := dir.Join("config.ini")
+			if legacyConfig.Exist() && configDir.Join("config.ini").NotExist() {
+				if err := copyFile(legacyConfig, configDir.Join("config.ini")); err != nil {
+					return migrations, err
+				}
+			}
+		}
+
+		// the certificates are migrated all together, or not at all
+		if dir.IsDir() && !dir.EquivalentTo(certsDir) && dir.Join("cert.pem").Exist() && certsDir.Join("cert.pem").NotExist() {
+			for _, name := range certificatesFiles {
+				if legacyCert := dir.Join(name); legacyCert.Exist() {
+					if err := copyFile(legacyCert, certsDir.Join(name)); err != nil {
+						return migrations, err
+					}
+				}
+			}
+		}
+	}
+	return migrations, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/arduino/go-paths-helper"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir *paths.Path, content string, names ...string) {
+	require.NoError(t, dir.MkdirAll())
+	for _, name := range names {
+		require.NoError(t, dir.Join(name).WriteFile([]byte(content)))
+	}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	t.Run("config and certificates next to the executable", func(t *testing.T) {
+		root := paths.New(t.TempDir())
+		execDir, configDir, certsDir := root.Join("bin"), root.Join("config"), root.Join("data")
+		writeFiles(t, execDir, "old", "config.ini", "ca.cert.pem", "cert.pem", "key.pem")
+		writeFiles(t, configDir, "")
+		writeFiles(t, certsDir, "")
+
+		migrations, err := MigrateLegacy(paths.NewPathList(execDir.String()), configDir, certsDir)
+		require.NoError(t, err)
+		require.Len(t, migrations, 4)
+		require.Equal(t, execDir.Join("config.ini"), migrations[0].From)
+		require.Equal(t, configDir.Join("config.ini"), migrations[0].To)
+		content, err := configDir.Join("config.ini").ReadFile()
+		require.NoError(t, err)
+		require.Equal(t, "old", string(content))
+		for _, name := range []string{"ca.cert.pem", "cert.pem", "key.pem"} {
+			require.True(t, certsDir.Join(name).Exist())
+		}
+
+		// the migration is done only once
+		migrations, err = MigrateLegacy(paths.NewPathList(execDir.String()), configDir, certsDir)
+		require.NoError(t, err)
+		require.Empty(t, migrations)
+	})
+
+	t.Run("pre 1.3 macOS install", func(t *testing.T) {
+		root := paths.New(t.TempDir())
+		execDir := root.Join("Applications", "Arduino Cloud Agent.app", "Contents", "MacOS")
+		oldInstall := root.Join("home", "Applications", "ArduinoCreateAgent", "ArduinoCreateAgent.app", "Contents", "MacOS")
+		configDir, certsDir := root.Join("config"), root.Join("data")
+		writeFiles(t, execDir, "")
+		writeFiles(t, oldInstall, "old", "config.ini", "cert.pem")
+		writeFiles(t, configDir, "")
+		writeFiles(t, certsDir, "")
+
+		migrations, err := MigrateLegacy(paths.NewPathList(execDir.String(), oldInstall.String()), configDir, certsDir)
+		require.NoError(t, err)
+		require.Len(t, migrations, 2)
+		require.True(t, configDir.Join("config.ini").Exist())
+		require.True(t, certsDir.Join("cert.pem").Exist())
+	})
+
+	t.Run("existing files are not overwritten", func(t *testing.T) {
+		root := paths.New(t.TempDir())
+		execDir, configDir, certsDir := root.Join("bin"), root.Join("config"), root.Join("data")
+		writeFiles(t, execDir, "old", "config.ini", "cert.pem", "key.pem")
+		writeFiles(t, configDir, "new", "config.ini")
+		writeFiles(t, certsDir, "new", "cert.pem")
+
+		migrations, err := MigrateLegacy(paths.NewPathList(execDir.String()), configDir, certsDir)
+		require.NoError(t, err)
+		require.Empty(t, migrations)
+		content, err := configDir.Join("config.ini").ReadFile()
+		require.NoError(t, err)
+		require.Equal(t, "new", string(content))
+		// the certificates are not mixed
+		require.True(t, certsDir.Join("key.pem").NotExist())
+	})
+
+	t.Run("missing legacy dirs", func(t *testing.T) {
+		root := paths.New(t.TempDir())
+		migrations, err := MigrateLegacy(paths.NewPathList(root.Join("missing").String()), root, root)
+		require.NoError(t, err)
+		require.Empty(t, migrations)
+	})
+
+	t.Run("executable in the data dir", func(t *testing.T) {
+		root := paths.New(t.TempDir())
+		writeFiles(t, root, "old", "config.ini", "cert.pem")
+		configDir := root.Join("config")
+		writeFiles(t, configDir, "")
+
+		migrations, err := MigrateLegacy(paths.NewPathList(root.String()), configDir, root)
+		require.NoError(t, err)
+		require.Len(t, migrations, 1)
+		require.Equal(t, configDir.Join("config.ini"), migrations[0].To)
+	})
+}
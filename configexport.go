@@ -0,0 +1,235 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+
+	"github.com/arduino/arduino-create-agent/config"
+	"github.com/arduino/go-paths-helper"
+	"github.com/gin-gonic/gin"
+	"github.com/go-ini/ini"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxExportedFileSize is the maximum size of a file in an imported archive
+const maxExportedFileSize = 1024 * 1024
+
+// exportedCerts are the files of the certificates dir added to the archive, if requested.
+// The private key of the CA is never exported: with it anyone could sign certificates
+// trusted by the browsers of this machine.
+var exportedCerts = []string{"ca.cert.pem", "ca.cert.cer", "key.pem", "cert.pem", "cert.cer"}
+
+// privateKeyCert is the private key of the certificate, written readable only by the user
+const privateKeyCert = "key.pem"
+
+// isSecretConfig tells if the value of the flag must not be exported, e.g. the proxies with a password.
+// The secrets must be set again after the import.
+func isSecretConfig(key, value string) bool {
+	switch key {
+	case "adminToken":
+		return value != ""
+	case "httpProxy", "httpsProxy":
+		u, err := url.Parse(value)
+		return err == nil && u.User != nil
+	}
+	return false
+}
+
+// exportConfig creates a zip archive with the config.ini containing the values of the flags
+// set by the config files, merging the additional configs, and optionally the certificates.
+func exportConfig(w io.Writer, certsDir *paths.Path) error {
+	cfg := ini.Empty()
+	var secrets []string
+	for _, entry := range getConfig() {
+		// the values of the additional configs are merged: their paths are valid only on this
+		// machine and they are set with the additional-config flag, which is not an ini flag
+		if entry.Source == "default" {
+			continue
+		}
+		f := iniConf.Lookup(entry.Key)
+		if isSecretConfig(f.Name, f.Value.String()) {
+			secrets = append(secrets, f.Name)
+			continue
+		}
+		if _, err := cfg.Section("").NewKey(f.Name, f.Value.String()); err != nil {
+			return err
+		}
+	}
+
+	var configIni bytes.Buffer
+	if _, err := cfg.WriteTo(&configIni); err != nil {
+		return err
+	}
+	for _, key := range secrets {
+		fmt.Fprintf(&configIni, "# %s is not exported, set it again after the import\n", key)
+	}
+
+	archive := zip.NewWriter(w)
+	file, err := archive.Create("config.ini")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(configIni.Bytes()); err != nil {
+		return err
+	}
+	if certsDir != nil {
+		for _, name := range exportedCerts {
+			data, err := certsDir.Join(name).ReadFile()
+			if err != nil {
+				continue
+			}
+			if file, err = archive.Create(path.Join("certificates", name)); err != nil {
+				return err
+			}
+			if _, err := file.Write(data); err != nil {
+				return err
+			}
+		}
+	}
+	return archive.Close()
+}
+
+// validateConfig checks that the config contains only known flags with valid values,
+// parsing it with a copy of the ini flags, so that the running config is not changed
+func validateConfig(configIni []byte) error {
+	args, err := parseIni(configIni)
+	if err != nil {
+		return err
+	}
+	fs := scratchConfig("import")
+	return fs.Parse(args)
+}
+
+// importConfig replaces the config with the one in the archive, keeping a backup of
+// the old one in config.ini.bak, and the certificates if the archive contains them.
+// Everything is validated before changing any file.
+func importConfig(data []byte, configPath, certsDir *paths.Path) error {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("invalid archive: %w", err)
+	}
+	var configIni []byte
+	certs := map[string][]byte{}
+	for _, file := range archive.File {
+		dir, name := path.Split(file.Name)
+		if file.Name != "config.ini" && (dir != "certificates/" || !slices.Contains(exportedCerts, name)) {
+			return fmt.Errorf("unexpected file %s in the archive", file.Name)
+		}
+		r, err := file.Open()
+		if err != nil {
+			return err
+		}
+		content, err := io.ReadAll(io.LimitReader(r, maxExportedFileSize+1))
+		r.Close()
+		if err != nil {
+			return err
+		}
+		if len(content) > maxExportedFileSize {
+			return fmt.Errorf("the file %s is too big", file.Name)
+		}
+		if file.Name == "config.ini" {
+			configIni = content
+		} else {
+			certs[name] = content
+		}
+	}
+	if configIni == nil {
+		return errors.New("the archive doesn't contain the config.ini")
+	}
+	if err := validateConfig(configIni); err != nil {
+		return fmt.Errorf("invalid config.ini: %w", err)
+	}
+
+	if configPath.Exist() {
+		if err := configPath.CopyTo(configPath.Parent().Join(configPath.Base() + ".bak")); err != nil {
+			return err
+		}
+	}
+	if err := configPath.WriteFile(configIni); err != nil {
+		return err
+	}
+	if len(certs) > 0 {
+		if err := certsDir.MkdirAll(); err != nil {
+			return err
+		}
+	}
+	for name, content := range certs {
+		file := certsDir.Join(name)
+		if name != privateKeyCert {
+			if err := file.WriteFile(content); err != nil {
+				return err
+			}
+			continue
+		}
+		// os.WriteFile keeps the permissions of an existing file
+		if file.Exist() {
+			if err := file.Chmod(0600); err != nil {
+				return err
+			}
+		}
+		if err := os.WriteFile(file.String(), content, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportConfigHandler returns the archive with the config, and the certificates with certs=true
+func exportConfigHandler(c *gin.Context) {
+	var certsDir *paths.Path
+	if c.Query("certs") == "true" {
+		certsDir = config.GetCertificatesDir()
+	}
+	var archive bytes.Buffer
+	if err := exportConfig(&archive, certsDir); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="arduino-create-agent-config.zip"`)
+	c.Data(http.StatusOK, "application/zip", archive.Bytes())
+}
+
+// importConfigHandler applies the config in the archive sent as body, restarting the agent
+func importConfigHandler(configPath *paths.Path) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if configPath == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "the agent is using the default config in read-only mode"})
+			return
+		}
+		data, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := importConfig(data, configPath, config.GetCertificatesDir()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Infof("imported the config in %s, restarting", configPath)
+		c.JSON(http.StatusOK, gin.H{"success": "Please wait a moment while the agent restarts with the imported config"})
+		Systray.Restart()
+	}
+}
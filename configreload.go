@@ -0,0 +1,331 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/arduino/arduino-create-agent/config"
+	"github.com/arduino/arduino-create-agent/upload"
+	"github.com/arduino/go-paths-helper"
+	log "github.com/sirupsen/logrus"
+)
+
+// The reloadable ini flags are applied without restarting the agent when the config is
+// reloaded, the changes of the other ones are ignored until the next start. Their values
+// are changed while the agent runs, so they must be read with Load.
+
+// atomicString is the value of a reloadable string flag
+type atomicString struct {
+	v atomic.Pointer[string]
+}
+
+func (s *atomicString) Load() string {
+	if v := s.v.Load(); v != nil {
+		return *v
+	}
+	return ""
+}
+
+func (s *atomicString) Store(v string)     { s.v.Store(&v) }
+func (s *atomicString) Set(v string) error { s.Store(v); return nil }
+func (s *atomicString) String() string     { return s.Load() }
+func (s *atomicString) Get() interface{}   { return s.Load() }
+
+// atomicBool is the value of a reloadable bool flag
+type atomicBool struct {
+	v atomic.Bool
+}
+
+func (b *atomicBool) Load() bool       { return b.v.Load() }
+func (b *atomicBool) Store(v bool)     { b.v.Store(v) }
+func (b *atomicBool) String() string   { return strconv.FormatBool(b.Load()) }
+func (b *atomicBool) Get() interface{} { return b.Load() }
+func (b *atomicBool) IsBoolFlag() bool { return true }
+
+func (b *atomicBool) Set(v string) error {
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	b.Store(parsed)
+	return nil
+}
+
+// atomicInt is the value of a reloadable int flag
+type atomicInt struct {
+	v atomic.Int64
+}
+
+func (i *atomicInt) Load() int        { return int(i.v.Load()) }
+func (i *atomicInt) Store(v int)      { i.v.Store(int64(v)) }
+func (i *atomicInt) String() string   { return strconv.Itoa(i.Load()) }
+func (i *atomicInt) Get() interface{} { return i.Load() }
+
+func (i *atomicInt) Set(v string) error {
+	parsed, err := strconv.ParseInt(v, 0, strconv.IntSize)
+	if err != nil {
+		return err
+	}
+	i.Store(int(parsed))
+	return nil
+}
+
+// reloadableString defines a string ini flag applied when the config is reloaded
+func reloadableString(name, value, usage string) *atomicString {
+	s := &atomicString{}
+	s.Store(value)
+	iniConf.Var(s, name, usage)
+	return s
+}
+
+// reloadableBool defines a bool ini flag applied when the config is reloaded
+func reloadableBool(name string, value bool, usage string) *atomicBool {
+	b := &atomicBool{}
+	b.Store(value)
+	iniConf.Var(b, name, usage)
+	return b
+}
+
+// reloadableInt defines an int ini flag applied when the config is reloaded
+func reloadableInt(name string, value int, usage string) *atomicInt {
+	i := &atomicInt{}
+	i.Store(value)
+	iniConf.Var(i, name, usage)
+	return i
+}
+
+func isReloadable(f *flag.Flag) bool {
+	switch f.Value.(type) {
+	case *atomicString, *atomicBool, *atomicInt:
+		return true
+	}
+	return false
+}
+
+var (
+	// reloadConfigPath is the config file read at startup, nil when the default config is used
+	reloadConfigPath *paths.Path
+	// configLoaded is set once the config has been read at startup, the reloads are ignored before
+	configLoaded bool
+	reloadMu     sync.Mutex
+)
+
+// scratchConfig returns a copy of the ini flags with their default values, to parse
+// a config without changing the running one
+func scratchConfig(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	iniConf.VisitAll(func(f *flag.Flag) {
+		switch f.Value.(flag.Getter).Get().(type) {
+		case bool:
+			fs.Bool(f.Name, false, f.Usage)
+		case int:
+			fs.Int(f.Name, 0, f.Usage)
+		case int64:
+			fs.Int64(f.Name, 0, f.Usage)
+		default:
+			fs.String(f.Name, "", f.Usage)
+		}
+		fs.Lookup(f.Name).Value.Set(f.DefValue)
+	})
+	return fs
+}
+
+// readConfig parses in fs the config file, or the default config if configPath is nil,
+// and then the additional configs, each one overriding the values of the previous ones.
+// It returns the config file setting each flag.
+func readConfig(fs *flag.FlagSet, configPath *paths.Path) (map[string]string, error) {
+	sources := map[string]string{}
+	var args []string
+	var err error
+	if configPath != nil {
+		args, err = parseIni(configPath.String())
+	} else {
+		args, err = parseIni(config.DefaultConfig())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config.ini cannot be parsed: %w", err)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("cannot parse arguments: %w", err)
+	}
+	if configPath != nil {
+		addConfigSource(sources, args, configPath.String())
+	} else {
+		addConfigSource(sources, args, "default config")
+	}
+
+	// Parse the additional ini configs if defined, a comma separated list can be used
+	// to layer them: each one overrides the values of the previous ones
+	for _, additional := range strings.Split(*additionalConfig, ",") {
+		if strings.TrimSpace(additional) == "" {
+			continue
+		}
+		additionalConfigPath := paths.New(strings.TrimSpace(additional))
+		if additionalConfigPath.NotExist() {
+			log.Infof("additional config file not found in %s", additionalConfigPath.String())
+			continue
+		}
+		args, err = parseIni(additionalConfigPath.String())
+		if err != nil {
+			return nil, fmt.Errorf("additional config cannot be parsed: %w", err)
+		}
+		if err := fs.Parse(args); err != nil {
+			return nil, fmt.Errorf("cannot parse arguments: %w", err)
+		}
+		addConfigSource(sources, args, additionalConfigPath.String())
+		log.Infof("using additional config from %s", additionalConfigPath.String())
+	}
+	return sources, nil
+}
+
+// compilePortsFilter compiles the regex filtering the serial ports, nil if it's empty
+func compilePortsFilter(expr string) (*regexp.Regexp, error) {
+	if len(expr) == 0 {
+		return nil, nil
+	}
+	filter, err := regexp.Compile("(?i)" + expr)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling the regex filter: %w", err)
+	}
+	return filter, nil
+}
+
+// checkConfig validates the settings parsed in fs, replacing the ones having
+// a fallback value, so that they can be applied
+func checkConfig(fs *flag.FlagSet) error {
+	if name := fs.Lookup("hostname").Value; name.String() == "unknown-hostname" {
+		hostname, _ := os.Hostname()
+		name.Set(hostname)
+	}
+	size := fs.Lookup("serialBufferSize").Value
+	if valid, err := validSerialBufferSize(size.(flag.Getter).Get().(int)); err != nil {
+		log.Error(err)
+		size.Set(strconv.Itoa(valid))
+	}
+	_, err := compilePortsFilter(fs.Lookup("regex").Value.String())
+	return err
+}
+
+// applyConfig applies the settings that don't need the agent to restart, it's called at
+// startup and every time the config is reloaded
+func applyConfig() error {
+	if err := checkConfig(iniConf); err != nil {
+		return err
+	}
+
+	// turn off garbage collection
+	// this is dangerous, as u could overflow memory
+	// the unknown modes have always turned it off
+	if err := setGCMode(gcType.Load()); err != nil {
+		log.Error(err)
+		setGCMode(gcOff)
+	}
+
+	if err := upload.SetPriority(uploadPriority.Load()); err != nil {
+		log.Error(err)
+	}
+
+	// see if they provided a regex filter
+	filter, _ := compilePortsFilter(portsFilterRegexp.Load())
+	if filter != nil {
+		log.Printf("You specified a serial port regular expression filter: %v\n", portsFilterRegexp.Load())
+	}
+	portsFilter.Store(filter)
+
+	if err := loadCommandlineOverrides(cmdOverridesFile.Load()); err != nil {
+		log.Errorf("cannot load the commandline overrides, none will be used: %s", err)
+	}
+
+	if !verbose.Load() {
+		log.Println("You can enter verbose mode to see all logging by setting the v key in the configuration file to true.")
+		log.SetOutput(io.Discard)
+	} else {
+		log.SetOutput(logOutput)
+	}
+	return nil
+}
+
+// setConfigLoaded enables the reloads of the config, once it has been read and applied at startup
+func setConfigLoaded(configPath *paths.Path) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadConfigPath = configPath
+	configLoaded = true
+}
+
+// reloadConfig reads the config files again and applies the reloadable settings,
+// it's called on SIGHUP when the agent runs as a service. The settings not found in
+// the config files go back to their default value. The config is parsed and checked
+// in a copy of the flags, if it's not valid the previous settings are kept.
+func reloadConfig() {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if !configLoaded {
+		log.Info("the config is not loaded yet, nothing to reload")
+		return
+	}
+	log.Info("reloading the configuration")
+
+	next := scratchConfig("reload")
+	sources, err := readConfig(next, reloadConfigPath)
+	if err == nil {
+		err = checkConfig(next)
+	}
+	if err != nil {
+		log.Errorf("cannot reload the configuration, the previous one is kept: %s", err)
+		return
+	}
+
+	// only the reloadable settings are changed, each one goes straight from the
+	// previous value to the new one
+	configSourcesMu.Lock()
+	previousSources := configSources
+	configSourcesMu.Unlock()
+	newSources := map[string]string{}
+	iniConf.VisitAll(func(f *flag.Flag) {
+		value := next.Lookup(f.Name).Value.String()
+		source, ok := sources[f.Name]
+		if isReloadable(f) {
+			f.Value.Set(value)
+		} else {
+			if value != f.Value.String() {
+				log.Warnf("the changes of %s will be applied at the next start of the agent", f.Name)
+			}
+			source, ok = previousSources[f.Name]
+		}
+		if ok {
+			newSources[f.Name] = source
+		}
+	})
+	setConfigSources(newSources)
+
+	if err := applyConfig(); err != nil {
+		log.Errorf("cannot apply the configuration: %s", err)
+	}
+	agentOrigins.setCustom(parseOrigins(origins.Load()))
+	agentOrigins.setStrict(strictOrigins.Load())
+	log.Info("the configuration has been reloaded")
+}
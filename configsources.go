@@ -0,0 +1,86 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigEntry is the effective value of an ini flag, with the config file setting it
+type ConfigEntry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+var (
+	// configSources maps the ini flags to the last config file setting them
+	configSources   = map[string]string{}
+	configSourcesMu sync.Mutex
+)
+
+// addConfigSource records source as the origin of the flags in args, as returned by parseIni
+func addConfigSource(sources map[string]string, args []string, source string) {
+	for _, arg := range args {
+		key, _, _ := strings.Cut(strings.TrimPrefix(arg, "-"), "=")
+		sources[key] = source
+	}
+}
+
+// setConfigSources replaces the origins of the flags of the running config,
+// the map must not be changed afterwards
+func setConfigSources(sources map[string]string) {
+	configSourcesMu.Lock()
+	defer configSourcesMu.Unlock()
+	configSources = sources
+}
+
+// redactConfigValue hides the password of the proxies
+func redactConfigValue(key, value string) string {
+	if key != "httpProxy" && key != "httpsProxy" {
+		return value
+	}
+	if u, err := url.Parse(value); err == nil {
+		return u.Redacted()
+	}
+	return value
+}
+
+// getConfig returns the effective value of every ini flag, the ones not set by a
+// config file have the default value
+func getConfig() []ConfigEntry {
+	configSourcesMu.Lock()
+	defer configSourcesMu.Unlock()
+	entries := []ConfigEntry{}
+	iniConf.VisitAll(func(f *flag.Flag) {
+		source, ok := configSources[f.Name]
+		if !ok {
+			source = "default"
+		}
+		entries = append(entries, ConfigEntry{Key: f.Name, Value: redactConfigValue(f.Name, f.Value.String()), Source: source})
+	})
+	return entries
+}
+
+func configHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, getConfig())
+}
@@ -26,6 +26,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/arduino/arduino-create-agent/upload"
 	"github.com/arduino/arduino-create-agent/utilities"
@@ -39,18 +41,59 @@ type connection struct {
 	ws socketio.Socket
 
 	// Buffered channel of outbound messages.
-	send chan []byte
+	send chan hubMessage
+
+	// The client asked to replay the system messages following the since sequence number.
+	// The sequence number of each system message is sent as second argument of the event.
+	replay bool
+	since  uint64
+
+	// The origin of the client and when it connected, see Session
+	origin      string
+	connectedAt time.Time
+
+	// The time the client has to receive a message before being disconnected, 0 to wait forever
+	writeTimeout time.Duration
+
+	// The client receives the serial data as binary, see serialMessage
+	binary bool
 }
 
 func (c *connection) writer() {
+	// a panic closes only this connection
+	defer func() {
+		if r := recover(); r != nil {
+			logPanic("websocket writer", r)
+			c.ws.Disconnect()
+		}
+	}()
+
 	for message := range c.send {
-		err := c.ws.Emit("message", string(message))
-		if err != nil {
+		if err := c.emit(message); err != nil {
 			break
 		}
 	}
 }
 
+// emit sends the message to the client. A client not receiving it within the write timeout
+// is disconnected, otherwise it would stall the writer forever.
+func (c *connection) emit(message hubMessage) error {
+	if c.writeTimeout > 0 {
+		timer := time.AfterFunc(c.writeTimeout, func() {
+			log.Errorf("the websocket client %s is not receiving the messages, disconnecting it", c.ws.Id())
+			c.ws.Disconnect()
+		})
+		defer timer.Stop()
+	}
+	if c.binary && message.serial != nil {
+		return c.emitBinary(message)
+	}
+	if c.replay && message.seq > 0 {
+		return c.ws.Emit("message", string(message.data), message.seq)
+	}
+	return c.ws.Emit("message", string(message.data))
+}
+
 // WsServer overrides socket.io server to set the CORS
 type WsServer struct {
 	Server *socketio.Server
@@ -76,14 +119,39 @@ type Upload struct {
 	Hex         []byte           `json:"hex"`
 	Filename    string           `json:"filename"`
 	ExtraFiles  []additionalFile `json:"extrafiles"`
+	Retries     int              `json:"retries"`
+	// Verify reads back the flash after the upload, if the tool supports it
+	Verify bool `json:"verify"`
+	// Monitor are the settings of the port reopened after the upload, used only by uploadAndMonitorHandler
+	Monitor *MonitorOptions `json:"monitor"`
+
+	// CommandlineOverride replaces the commandline derived from the index, see getCommandlineOverride
+	CommandlineOverride          string `json:"commandline_override"`
+	CommandlineOverrideSignature string `json:"commandline_override_signature"`
 }
 
 var uploadStatusStr = "ProgrammerStatus"
 
-func uploadHandler(pubKey *rsa.PublicKey) func(*gin.Context) {
+func uploadHandler(pubKeys []*rsa.PublicKey) func(*gin.Context) {
+	return handleUpload(pubKeys, false)
+}
+
+// uploadAndMonitorHandler closes the port, if it's open, uploads the sketch and then waits for
+// the port to reappear (it could be renamed) to open it again with the settings in Upload.Monitor.
+// The stages are reported with the UploadAndMonitor messages, see sendMonitorStage.
+func uploadAndMonitorHandler(pubKeys []*rsa.PublicKey) func(*gin.Context) {
+	return handleUpload(pubKeys, true)
+}
+
+func handleUpload(pubKeys []*rsa.PublicKey, monitor bool) func(*gin.Context) {
 	return func(c *gin.Context) {
 		data := new(Upload)
-		if err := c.BindJSON(data); err != nil {
+		if err := c.ShouldBindJSON(data); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("the payload exceeds the maximum size of %d bytes", maxBytesErr.Limit))
+				return
+			}
 			c.String(http.StatusBadRequest, fmt.Sprintf("err with the payload. %v", err.Error()))
 			return
 		}
@@ -101,7 +169,28 @@ func uploadHandler(pubKey *rsa.PublicKey) func(*gin.Context) {
 			return
 		}
 
-		if !data.Extra.Network {
+		if data.Retries < 0 {
+			c.String(http.StatusBadRequest, "retries must be a positive number")
+			return
+		}
+
+		if monitor {
+			if data.Monitor == nil {
+				data.Monitor = &MonitorOptions{}
+			}
+			if err := data.Monitor.validate(); err != nil {
+				c.String(http.StatusBadRequest, err.Error())
+				return
+			}
+			// the port is reopened as done by the open command, so the same restrictions apply
+			if !commandAllowed("open") {
+				c.String(http.StatusForbidden, "the open command is not allowed by the agent configuration")
+				return
+			}
+		}
+
+		// the network uploads don't run the commandline, it's verified only if the signature is required
+		if !data.Extra.Network || requireSignature.Load() {
 			if data.Signature == "" {
 				c.String(http.StatusBadRequest, "signature is required")
 				return
@@ -112,7 +201,7 @@ func uploadHandler(pubKey *rsa.PublicKey) func(*gin.Context) {
 				return
 			}
 
-			err := utilities.VerifyInput(data.Commandline, data.Signature, pubKey)
+			err := utilities.VerifyInput(data.Commandline, data.Signature, pubKeys)
 
 			if err != nil {
 				log.WithField("err", err).Error("Error verifying the command")
@@ -121,15 +210,31 @@ func uploadHandler(pubKey *rsa.PublicKey) func(*gin.Context) {
 			}
 		}
 
-		buffer := bytes.NewBuffer(data.Hex)
-
-		filePath, err := utilities.SaveFileonTempDir(data.Filename, buffer)
+		uploadDir, err := newUploadDir()
 		if err != nil {
-			c.String(http.StatusBadRequest, err.Error())
+			c.String(http.StatusBadRequest, "Could not create the directory to store the upload files: "+err.Error())
 			return
 		}
+		// the upload dir is removed when the upload completes, or right away if the request is not valid
+		uploadStarted := false
+		defer func() {
+			if !uploadStarted {
+				os.RemoveAll(uploadDir)
+			}
+		}()
+
+		buffer := bytes.NewBuffer(data.Hex)
+
+		sketchDir := filepath.Join(uploadDir, "sketch")
+		tmpdir := filepath.Join(uploadDir, "extrafiles")
+		for _, dir := range []string{sketchDir, tmpdir} {
+			if err := os.Mkdir(dir, 0755); err != nil {
+				c.String(http.StatusBadRequest, err.Error())
+				return
+			}
+		}
 
-		tmpdir, err := os.MkdirTemp("", "extrafiles")
+		filePath, err := utilities.SaveFileonDir(sketchDir, data.Filename, buffer)
 		if err != nil {
 			c.String(http.StatusBadRequest, err.Error())
 			return
@@ -160,10 +265,71 @@ func uploadHandler(pubKey *rsa.PublicKey) func(*gin.Context) {
 			data.Board = data.Rewrite
 		}
 
+		override, err := getCommandlineOverride(*data, pubKeys)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		if override != "" {
+			log.Printf("Using the commandline override for %s: %s", data.Board, override)
+			data.Commandline = override
+		}
+
+		data.Commandline, err = upload.ResolveVerify(data.Commandline, data.Verify)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// the port is monitored with its name in the request, even if the upload is done on another one
+		monitoredPort := data.Port
+		if groupPorts.Load() {
+			if uploadPort := serialPorts.GetUploadPort(data.Port); uploadPort != data.Port {
+				msg := "The port " + data.Port + " is not connected anymore, uploading on " + uploadPort + " of the same board"
+				log.Print(msg)
+				send(map[string]string{uploadStatusStr: "PortChanged", "Port": uploadPort, "RequestedPort": data.Port, "Msg": msg})
+				data.Port = uploadPort
+			}
+		}
+
+		uploadStarted = true
+		currentUpload.start(data.Port, data.Board)
 		go func() {
+			if monitor {
+				identity := closeMonitoredPort(monitoredPort)
+				defer reopenMonitoredPort(monitoredPort, identity, *data.Monitor)
+			}
+			defer os.RemoveAll(uploadDir)
+			defer currentUpload.done()
+
+			record := UploadRecord{Board: data.Board, Tool: uploadToolName(data.Commandline), StartTime: time.Now()}
+			var uploadErr error
+			defer func() {
+				record.Success = uploadErr == nil
+				if uploadErr != nil {
+					record.Error = uploadErr.Error()
+				}
+				record.DurationSeconds = time.Since(record.StartTime).Seconds()
+				recentUploads.add(data.Port, record, uploadErr)
+			}()
+
+			// The virtual board accepts any upload, there's no tool to run
+			if isVirtualPort(data.Port) {
+				send(map[string]string{uploadStatusStr: "Starting", "Cmd": "Serial"})
+				send(map[string]string{uploadStatusStr: "Done", "Flash": "Ok"})
+				return
+			}
+
 			// Resolve commandline
 			commandline, err := upload.PartiallyResolve(data.Board, filePath, tmpdir, data.Commandline, data.Extra, Tools)
+			if err == nil && override != "" {
+				var toolDirs []string
+				if toolDirs, err = Tools.InstalledLocations(); err == nil {
+					err = checkExecutable(commandline, toolDirs)
+				}
+			}
 			if err != nil {
+				uploadErr = err
 				send(map[string]string{uploadStatusStr: "Error", "Msg": err.Error()})
 				return
 			}
@@ -175,21 +341,45 @@ func uploadHandler(pubKey *rsa.PublicKey) func(*gin.Context) {
 				err = errors.New("network upload is not supported anymore, pease use OTA instead")
 			} else {
 				send(map[string]string{uploadStatusStr: "Starting", "Cmd": "Serial"})
-				err = upload.Serial(data.Port, commandline, data.Extra, l)
+				err = upload.SerialWithRetries(data.Port, commandline, data.Extra, data.Retries, l)
 			}
 
 			// Handle result
+			uploadErr = err
 			if err != nil {
-				send(map[string]string{uploadStatusStr: "Error", "Msg": err.Error()})
+				msg := map[string]string{uploadStatusStr: "Error", "Msg": err.Error()}
+				if upload.IsVerifyError(err) {
+					// the flash has been written, but it doesn't match the sketch
+					msg["Flash"] = "Ok"
+					msg["Verify"] = "Failed"
+				}
+				send(msg)
 				return
 			}
-			send(map[string]string{uploadStatusStr: "Done", "Flash": "Ok"})
+			done := map[string]string{uploadStatusStr: "Done", "Flash": "Ok"}
+			if data.Verify {
+				done["Verify"] = "Ok"
+			}
+			send(done)
 		}()
 
 		c.String(http.StatusAccepted, "")
 	}
 }
 
+// limitBodySize rejects the requests with a body bigger than maxSize, before reading it
+func limitBodySize(maxSize int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxSize {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("the payload exceeds the maximum size of %d bytes", maxSize)})
+			return
+		}
+		// the content length could be missing (chunked requests), so we limit the reads as well
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+		c.Next()
+	}
+}
+
 // PLogger sends the info from the upload to the websocket
 type PLogger struct {
 	Verbose bool
@@ -206,6 +396,7 @@ func (l PLogger) Debug(args ...interface{}) {
 func (l PLogger) Info(args ...interface{}) {
 	output := fmt.Sprint(args...)
 	log.Println(output)
+	currentUpload.setProgress(output)
 	send(map[string]string{uploadStatusStr: "Busy", "Msg": output})
 }
 
@@ -219,16 +410,33 @@ func wsHandler() *WsServer {
 	if err != nil {
 		log.Fatal(err)
 	}
+	// the clients send a ping every ping interval: a client not sending them
+	// within the read timeout is disconnected
+	if timeout := wsReadTimeout.Load(); timeout > 0 {
+		readTimeout := time.Duration(timeout) * time.Second
+		server.SetPingTimeout(readTimeout)
+		server.SetPingInterval(min(25*time.Second, readTimeout/2))
+	}
+	writeTimeout := time.Duration(max(wsWriteTimeout.Load(), 0)) * time.Second
 
 	server.On("connection", func(so socketio.Socket) {
-		c := &connection{send: make(chan []byte, 256*10), ws: so}
-		h.register <- c
+		c := &connection{send: make(chan hubMessage, 256*10), ws: so, origin: so.Request().Header.Get("Origin"), connectedAt: time.Now(), writeTimeout: writeTimeout}
+		if since, err := strconv.ParseUint(so.Request().URL.Query().Get("since"), 10, 64); err == nil {
+			c.replay = true
+			c.since = since
+		}
+		c.binary, _ = strconv.ParseBool(so.Request().URL.Query().Get("binary"))
+		if !h.request(h.register, c) {
+			// the agent is quitting
+			so.Disconnect()
+			return
+		}
 		so.On("command", func(message string) {
-			h.broadcast <- []byte(message)
+			h.command([]byte(message))
 		})
 
 		so.On("disconnection", func() {
-			h.unregister <- c
+			h.request(h.unregister, c)
 		})
 		go c.writer()
 	})
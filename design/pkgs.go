@@ -43,6 +43,15 @@ var _ = Service("tools", func() {
 		})
 	})
 
+	Method("installedversions", func() {
+		Description("List the installed tools grouped by name, with their versions and the folder where they are installed")
+		Result(CollectionOf(InstalledTool))
+		HTTP(func() {
+			GET("/pkgs/tools/installed/versions")
+			Response(StatusOK)
+		})
+	})
+
 	Method("install", func() {
 		Error("not_found", ErrorResult, "tool not found")
 		HTTP(func() {
@@ -112,6 +121,23 @@ var Tool = ResultType("application/vnd.arduino.tool", func() {
 	Required("name", "version", "packager")
 })
 
+var InstalledTool = ResultType("application/vnd.arduino.installed-tool", func() {
+	Description("A tool installed in the tools folder, with all its installed versions.")
+	TypeName("InstalledTool")
+	Reference(ToolPayload)
+
+	Attribute("name")
+	Attribute("packager")
+	Attribute("versions", ArrayOf(String), "The installed versions of the tool", func() {
+		Example([]string{"1.7.0", "1.9.1-arduino2"})
+	})
+	Attribute("path", String, "The folder of the tool, each version is installed in a subfolder named after it", func() {
+		Example("/home/user/.arduino-create/arduino/bossac")
+	})
+
+	Required("name", "packager", "versions", "path")
+})
+
 var Operation = ResultType("application/vnd.arduino.operation", func() {
 	Description("Describes the result of an operation.")
 	TypeName("Operation")
@@ -0,0 +1,83 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package design
+
+import . "goa.design/goa/v3/dsl"
+
+var _ = Service("serial", func() {
+	Description(`The serial service opens and closes the serial ports for the clients not using the websocket.
+	The data of the open ports is still streamed on the websocket`)
+
+	Error("invalid_request", ErrorResult, "the request is not valid")
+	Error("not_found", ErrorResult, "port not found")
+	Error("already_open", ErrorResult, "port already open")
+	Error("not_allowed", ErrorResult, "the command is disabled by the agent configuration")
+	HTTP(func() {
+		Path("/serial")
+		Response("invalid_request", StatusBadRequest)
+		Response("not_found", StatusNotFound)
+		Response("already_open", StatusConflict)
+		Response("not_allowed", StatusForbidden)
+	})
+
+	Method("open", func() {
+		Payload(SerialOpenPayload)
+		Result(Operation)
+		HTTP(func() {
+			POST("/open")
+			Response(StatusOK)
+		})
+	})
+
+	Method("close", func() {
+		Payload(SerialClosePayload)
+		Result(Operation)
+		HTTP(func() {
+			POST("/close")
+			Response(StatusOK)
+		})
+	})
+})
+
+var SerialOpenPayload = Type("arduino.serial.open", func() {
+	Description("The serial port to open, the port is registered before answering so that it can be used right away")
+	TypeName("SerialOpenPayload")
+
+	Attribute("port", String, "The name of the port", func() {
+		Example("/dev/ttyACM0")
+	})
+	Attribute("baud", Int, "The baud rate", func() {
+		Minimum(1)
+		Example(9600)
+	})
+	Attribute("buffer", String, "The buffer type, the same of the open command of the websocket", func() {
+		Enum("default", "timed", "timedraw")
+		Default("default")
+	})
+
+	Required("port", "baud")
+})
+
+var SerialClosePayload = Type("arduino.serial.close", func() {
+	Description("The serial port to close")
+	TypeName("SerialClosePayload")
+
+	Attribute("port", String, "The name of the port", func() {
+		Example("/dev/ttyACM0")
+	})
+
+	Required("port")
+})
@@ -0,0 +1,62 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// portTypeSerial is the type of the serial ports. The network and BLE ports are
+// not supported, when they are they will be listed by /discover with their own types.
+const portTypeSerial = "serial"
+
+// DiscoveredEndpoint is a target the clients can connect to, whatever its transport.
+// The properties depend on the type, for the serial ports they are the USB identifiers.
+type DiscoveredEndpoint struct {
+	Type       string            `json:"type"`
+	Address    string            `json:"address"`
+	Label      string            `json:"label"`
+	Properties map[string]string `json:"properties"`
+}
+
+func serialEndpoint(port *SpPortItem) DiscoveredEndpoint {
+	return DiscoveredEndpoint{
+		Type:    portTypeSerial,
+		Address: port.Name,
+		Label:   port.Name,
+		Properties: map[string]string{
+			"vid":          port.VendorID,
+			"pid":          port.ProductID,
+			"serialNumber": port.SerialNumber,
+			"available":    strconv.FormatBool(port.Available),
+		},
+	}
+}
+
+// discoverHandler returns all the connectable targets in a single list.
+// The per-type lists, like the list command for the serial ports, are still available.
+func discoverHandler(c *gin.Context) {
+	endpoints := []DiscoveredEndpoint{}
+	serialPorts.portsLock.Lock()
+	for _, port := range serialPorts.Ports {
+		endpoints = append(endpoints, serialEndpoint(port))
+	}
+	serialPorts.portsLock.Unlock()
+	c.JSON(http.StatusOK, endpoints)
+}
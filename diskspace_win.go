@@ -0,0 +1,33 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build windows
+
+package main
+
+import (
+	"github.com/arduino/go-paths-helper"
+	"golang.org/x/sys/windows"
+)
+
+// diskSpace returns the free and the total bytes of the volume containing dir
+func diskSpace(dir *paths.Path) (free, total uint64, err error) {
+	dirPtr, err := windows.UTF16PtrFromString(dir.String())
+	if err != nil {
+		return 0, 0, err
+	}
+	err = windows.GetDiskFreeSpaceEx(dirPtr, &free, &total, nil)
+	return free, total, err
+}
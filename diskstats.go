@@ -0,0 +1,86 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/arduino/arduino-create-agent/config"
+	"github.com/arduino/go-paths-helper"
+	"github.com/gin-gonic/gin"
+)
+
+// lowDiskSpace is the free space under which the disk stats warn the user
+const lowDiskSpace = 500 * 1024 * 1024
+
+// DiskStats is the space on the volume of the data dir, and how the data dir uses it
+type DiskStats struct {
+	DataDir string `json:"dataDir"`
+	Free    uint64 `json:"free"`
+	Total   uint64 `json:"total"`
+	// Usage is the size of the content of the data dir: tools, logs, uploads and index
+	Usage   map[string]int64 `json:"usage"`
+	Warning string           `json:"warning,omitempty"`
+}
+
+// dataDirUsage returns the size of the content of the data dir. The index is made of
+// the json files (and their signatures) in the root, the tools are the other dirs.
+func dataDirUsage(dataDir *paths.Path) (map[string]int64, error) {
+	usage := map[string]int64{"tools": 0, "logs": 0, "uploads": 0, "index": 0}
+	entries, err := dataDir.ReadDir()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		switch {
+		case entry.Base() == "logs":
+			usage["logs"] += dirSize(entry)
+		case entry.Base() == "uploads":
+			usage["uploads"] += dirSize(entry)
+		case entry.IsDir():
+			usage["tools"] += dirSize(entry)
+		case strings.HasSuffix(entry.Base(), ".json") || strings.HasSuffix(entry.Base(), ".sig"):
+			usage["index"] += dirSize(entry)
+		}
+	}
+	return usage, nil
+}
+
+func diskStatsHandler(c *gin.Context) {
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	free, total, err := diskSpace(dataDir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	usage, err := dataDirUsage(dataDir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	stats := DiskStats{DataDir: dataDir.String(), Free: free, Total: total, Usage: usage}
+	if free < lowDiskSpace {
+		stats.Warning = fmt.Sprintf("the free space is below %d MB: the downloads of the tools could fail, please remove the unused tools and the logs", lowDiskSpace/1024/1024)
+	}
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,111 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// The garbage collection modes, see the gc flag
+const (
+	gcStd = "std"
+	gcOff = "off"
+	gcMax = "max"
+)
+
+var gcModes = []string{gcStd, gcOff, gcMax}
+
+// GCMode is the garbage collection mode used by the agent
+type GCMode struct {
+	Mode string `json:"mode"`
+}
+
+var currentGCMode atomic.Value
+
+// maxGCInterval is the shortest time between the garbage collections forced by the max mode,
+// so that a port receiving a lot of small reads doesn't spend all its time collecting
+const maxGCInterval = 100 * time.Millisecond
+
+// lastMaxGC is the time of the last garbage collection forced by the max mode, in unix nanoseconds
+var lastMaxGC atomic.Int64
+
+// setGCMode changes the garbage collection mode: it can be changed at runtime,
+// e.g. to turn it off during a long CNC job and back on at the end
+func setGCMode(mode string) error {
+	if !slices.Contains(gcModes, mode) {
+		return fmt.Errorf("invalid garbage collection mode %s, it must be one of %v", mode, gcModes)
+	}
+	switch mode {
+	case gcStd:
+		log.Println("Garbage collection is on using Standard mode, meaning we just let Golang determine when to garbage collect.")
+		debug.SetGCPercent(100)
+	case gcMax:
+		log.Println("Garbage collection is on for MAXIMUM real-time collecting on the send/recv from serial port, at most every 100ms. Higher CPU, but less stopping of the world to garbage collect since it is being done on a constant basis.")
+		debug.SetGCPercent(100)
+	case gcOff:
+		log.Println("Garbage collection is off. Memory use will grow unbounded. You WILL RUN OUT OF RAM unless you send in the gc command to manually force garbage collection. Lower CPU, but progressive memory footprint.")
+		debug.SetGCPercent(-1)
+	}
+	currentGCMode.Store(mode)
+	return nil
+}
+
+func getGCMode() string {
+	if mode, ok := currentGCMode.Load().(string); ok {
+		return mode
+	}
+	return gcStd
+}
+
+// maxGC forces a garbage collection when the mode is max, it's called on each send/recv on a serial port
+// but collects at most once every maxGCInterval
+func maxGC() {
+	if getGCMode() != gcMax {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := lastMaxGC.Load()
+	if now-last < int64(maxGCInterval) || !lastMaxGC.CompareAndSwap(last, now) {
+		return
+	}
+	runtime.GC()
+}
+
+func gcModeHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, GCMode{Mode: getGCMode()})
+}
+
+func setGCModeHandler(c *gin.Context) {
+	var data GCMode
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := setGCMode(data.Mode); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GCMode{Mode: getGCMode()})
+}
@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"os"
 
+	serialc "github.com/arduino/arduino-create-agent/gen/http/serial/client"
 	toolsc "github.com/arduino/arduino-create-agent/gen/http/tools/client"
 	goahttp "goa.design/goa/v3/http"
 	goa "goa.design/goa/v3/pkg"
@@ -22,13 +23,19 @@ import (
 //
 //	command (subcommand1|subcommand2|...)
 func UsageCommands() string {
-	return `tools (available|installedhead|installed|install|remove)
+	return `tools (available|installedhead|installed|installedversions|install|remove)
+serial (open|close)
 `
 }
 
 // UsageExamples produces an example of a valid invocation of the CLI tool.
 func UsageExamples() string {
 	return os.Args[0] + ` tools available` + "\n" +
+		os.Args[0] + ` serial open --body '{
+      "baud": 9600,
+      "buffer": "timedraw",
+      "port": "/dev/ttyACM0"
+   }'` + "\n" +
 		""
 }
 
@@ -50,6 +57,8 @@ func ParseEndpoint(
 
 		toolsInstalledFlags = flag.NewFlagSet("installed", flag.ExitOnError)
 
+		toolsInstalledversionsFlags = flag.NewFlagSet("installedversions", flag.ExitOnError)
+
 		toolsInstallFlags    = flag.NewFlagSet("install", flag.ExitOnError)
 		toolsInstallBodyFlag = toolsInstallFlags.String("body", "REQUIRED", "")
 
@@ -58,14 +67,27 @@ func ParseEndpoint(
 		toolsRemovePackagerFlag = toolsRemoveFlags.String("packager", "REQUIRED", "The packager of the tool")
 		toolsRemoveNameFlag     = toolsRemoveFlags.String("name", "REQUIRED", "The name of the tool")
 		toolsRemoveVersionFlag  = toolsRemoveFlags.String("version", "REQUIRED", "The version of the tool")
+
+		serialFlags = flag.NewFlagSet("serial", flag.ContinueOnError)
+
+		serialOpenFlags    = flag.NewFlagSet("open", flag.ExitOnError)
+		serialOpenBodyFlag = serialOpenFlags.String("body", "REQUIRED", "")
+
+		serialCloseFlags    = flag.NewFlagSet("close", flag.ExitOnError)
+		serialCloseBodyFlag = serialCloseFlags.String("body", "REQUIRED", "")
 	)
 	toolsFlags.Usage = toolsUsage
 	toolsAvailableFlags.Usage = toolsAvailableUsage
 	toolsInstalledheadFlags.Usage = toolsInstalledheadUsage
 	toolsInstalledFlags.Usage = toolsInstalledUsage
+	toolsInstalledversionsFlags.Usage = toolsInstalledversionsUsage
 	toolsInstallFlags.Usage = toolsInstallUsage
 	toolsRemoveFlags.Usage = toolsRemoveUsage
 
+	serialFlags.Usage = serialUsage
+	serialOpenFlags.Usage = serialOpenUsage
+	serialCloseFlags.Usage = serialCloseUsage
+
 	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
 		return nil, nil, err
 	}
@@ -83,6 +105,8 @@ func ParseEndpoint(
 		switch svcn {
 		case "tools":
 			svcf = toolsFlags
+		case "serial":
+			svcf = serialFlags
 		default:
 			return nil, nil, fmt.Errorf("unknown service %q", svcn)
 		}
@@ -109,6 +133,9 @@ func ParseEndpoint(
 			case "installed":
 				epf = toolsInstalledFlags
 
+			case "installedversions":
+				epf = toolsInstalledversionsFlags
+
 			case "install":
 				epf = toolsInstallFlags
 
@@ -117,6 +144,16 @@ func ParseEndpoint(
 
 			}
 
+		case "serial":
+			switch epn {
+			case "open":
+				epf = serialOpenFlags
+
+			case "close":
+				epf = serialCloseFlags
+
+			}
+
 		}
 	}
 	if epf == nil {
@@ -149,6 +186,9 @@ func ParseEndpoint(
 			case "installed":
 				endpoint = c.Installed()
 				data = nil
+			case "installedversions":
+				endpoint = c.Installedversions()
+				data = nil
 			case "install":
 				endpoint = c.Install()
 				data, err = toolsc.BuildInstallPayload(*toolsInstallBodyFlag)
@@ -156,6 +196,16 @@ func ParseEndpoint(
 				endpoint = c.Remove()
 				data, err = toolsc.BuildRemovePayload(*toolsRemoveBodyFlag, *toolsRemovePackagerFlag, *toolsRemoveNameFlag, *toolsRemoveVersionFlag)
 			}
+		case "serial":
+			c := serialc.NewClient(scheme, host, doer, enc, dec, restore)
+			switch epn {
+			case "open":
+				endpoint = c.Open()
+				data, err = serialc.BuildOpenPayload(*serialOpenBodyFlag)
+			case "close":
+				endpoint = c.Close()
+				data, err = serialc.BuildClosePayload(*serialCloseBodyFlag)
+			}
 		}
 	}
 	if err != nil {
@@ -175,6 +225,7 @@ COMMAND:
     available: Available implements available.
     installedhead: Installedhead implements installedhead.
     installed: Installed implements installed.
+    installedversions: List the installed tools grouped by name, with their versions and the folder where they are installed
     install: Install implements install.
     remove: Remove implements remove.
 
@@ -212,6 +263,16 @@ Example:
 `, os.Args[0])
 }
 
+func toolsInstalledversionsUsage() {
+	fmt.Fprintf(os.Stderr, `%[1]s [flags] tools installedversions
+
+List the installed tools grouped by name, with their versions and the folder where they are installed
+
+Example:
+    %[1]s tools installedversions
+`, os.Args[0])
+}
+
 func toolsInstallUsage() {
 	fmt.Fprintf(os.Stderr, `%[1]s [flags] tools install -body JSON
 
@@ -247,3 +308,46 @@ Example:
    }' --packager "arduino" --name "bossac" --version "1.7.0-arduino3"
 `, os.Args[0])
 }
+
+// serialUsage displays the usage of the serial command and its subcommands.
+func serialUsage() {
+	fmt.Fprintf(os.Stderr, `The serial service opens and closes the serial ports for the clients not using the websocket.
+		The data of the open ports is still streamed on the websocket
+Usage:
+    %[1]s [globalflags] serial COMMAND [flags]
+
+COMMAND:
+    open: Open implements open.
+    close: Close implements close.
+
+Additional help:
+    %[1]s serial COMMAND --help
+`, os.Args[0])
+}
+func serialOpenUsage() {
+	fmt.Fprintf(os.Stderr, `%[1]s [flags] serial open -body JSON
+
+Open implements open.
+    -body JSON: 
+
+Example:
+    %[1]s serial open --body '{
+      "baud": 9600,
+      "buffer": "timedraw",
+      "port": "/dev/ttyACM0"
+   }'
+`, os.Args[0])
+}
+
+func serialCloseUsage() {
+	fmt.Fprintf(os.Stderr, `%[1]s [flags] serial close -body JSON
+
+Close implements close.
+    -body JSON: 
+
+Example:
+    %[1]s serial close --body '{
+      "port": "/dev/ttyACM0"
+   }'
+`, os.Args[0])
+}
@@ -0,0 +1,69 @@
+// Code generated by goa v3.16.1, DO NOT EDIT.
+//
+// serial HTTP client CLI support package
+//
+// Command:
+// $ goa gen github.com/arduino/arduino-create-agent/design
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	serial "github.com/arduino/arduino-create-agent/gen/serial"
+	goa "goa.design/goa/v3/pkg"
+)
+
+// BuildOpenPayload builds the payload for the serial open endpoint from CLI
+// flags.
+func BuildOpenPayload(serialOpenBody string) (*serial.SerialOpenPayload, error) {
+	var err error
+	var body OpenRequestBody
+	{
+		err = json.Unmarshal([]byte(serialOpenBody), &body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON for body, \nerror: %s, \nexample of valid JSON:\n%s", err, "'{\n      \"baud\": 9600,\n      \"buffer\": \"timedraw\",\n      \"port\": \"/dev/ttyACM0\"\n   }'")
+		}
+		if body.Baud < 1 {
+			err = goa.MergeErrors(err, goa.InvalidRangeError("body.baud", body.Baud, 1, true))
+		}
+		if !(body.Buffer == "default" || body.Buffer == "timed" || body.Buffer == "timedraw") {
+			err = goa.MergeErrors(err, goa.InvalidEnumValueError("body.buffer", body.Buffer, []any{"default", "timed", "timedraw"}))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	v := &serial.SerialOpenPayload{
+		Port:   body.Port,
+		Baud:   body.Baud,
+		Buffer: body.Buffer,
+	}
+	{
+		var zero string
+		if v.Buffer == zero {
+			v.Buffer = "default"
+		}
+	}
+
+	return v, nil
+}
+
+// BuildClosePayload builds the payload for the serial close endpoint from CLI
+// flags.
+func BuildClosePayload(serialCloseBody string) (*serial.SerialClosePayload, error) {
+	var err error
+	var body CloseRequestBody
+	{
+		err = json.Unmarshal([]byte(serialCloseBody), &body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON for body, \nerror: %s, \nexample of valid JSON:\n%s", err, "'{\n      \"port\": \"/dev/ttyACM0\"\n   }'")
+		}
+	}
+	v := &serial.SerialClosePayload{
+		Port: body.Port,
+	}
+
+	return v, nil
+}
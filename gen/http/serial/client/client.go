@@ -0,0 +1,102 @@
+// Code generated by goa v3.16.1, DO NOT EDIT.
+//
+// serial client HTTP transport
+//
+// Command:
+// $ goa gen github.com/arduino/arduino-create-agent/design
+
+package client
+
+import (
+	"context"
+	"net/http"
+
+	goahttp "goa.design/goa/v3/http"
+	goa "goa.design/goa/v3/pkg"
+)
+
+// Client lists the serial service endpoint HTTP clients.
+type Client struct {
+	// Open Doer is the HTTP client used to make requests to the open endpoint.
+	OpenDoer goahttp.Doer
+
+	// Close Doer is the HTTP client used to make requests to the close endpoint.
+	CloseDoer goahttp.Doer
+
+	// RestoreResponseBody controls whether the response bodies are reset after
+	// decoding so they can be read again.
+	RestoreResponseBody bool
+
+	scheme  string
+	host    string
+	encoder func(*http.Request) goahttp.Encoder
+	decoder func(*http.Response) goahttp.Decoder
+}
+
+// NewClient instantiates HTTP clients for all the serial service servers.
+func NewClient(
+	scheme string,
+	host string,
+	doer goahttp.Doer,
+	enc func(*http.Request) goahttp.Encoder,
+	dec func(*http.Response) goahttp.Decoder,
+	restoreBody bool,
+) *Client {
+	return &Client{
+		OpenDoer:            doer,
+		CloseDoer:           doer,
+		RestoreResponseBody: restoreBody,
+		scheme:              scheme,
+		host:                host,
+		decoder:             dec,
+		encoder:             enc,
+	}
+}
+
+// Open returns an endpoint that makes HTTP requests to the serial service open
+// server.
+func (c *Client) Open() goa.Endpoint {
+	var (
+		encodeRequest  = EncodeOpenRequest(c.encoder)
+		decodeResponse = DecodeOpenResponse(c.decoder, c.RestoreResponseBody)
+	)
+	return func(ctx context.Context, v any) (any, error) {
+		req, err := c.BuildOpenRequest(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		err = encodeRequest(req, v)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.OpenDoer.Do(req)
+		if err != nil {
+			return nil, goahttp.ErrRequestError("serial", "open", err)
+		}
+		return decodeResponse(resp)
+	}
+}
+
+// Close returns an endpoint that makes HTTP requests to the serial service
+// close server.
+func (c *Client) Close() goa.Endpoint {
+	var (
+		encodeRequest  = EncodeCloseRequest(c.encoder)
+		decodeResponse = DecodeCloseResponse(c.decoder, c.RestoreResponseBody)
+	)
+	return func(ctx context.Context, v any) (any, error) {
+		req, err := c.BuildCloseRequest(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		err = encodeRequest(req, v)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.CloseDoer.Do(req)
+		if err != nil {
+			return nil, goahttp.ErrRequestError("serial", "close", err)
+		}
+		return decodeResponse(resp)
+	}
+}
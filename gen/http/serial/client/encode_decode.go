@@ -0,0 +1,290 @@
+// Code generated by goa v3.16.1, DO NOT EDIT.
+//
+// serial HTTP client encoders and decoders
+//
+// Command:
+// $ goa gen github.com/arduino/arduino-create-agent/design
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+
+	serial "github.com/arduino/arduino-create-agent/gen/serial"
+	serialviews "github.com/arduino/arduino-create-agent/gen/serial/views"
+	goahttp "goa.design/goa/v3/http"
+)
+
+// BuildOpenRequest instantiates a HTTP request object with method and path set
+// to call the "serial" service "open" endpoint
+func (c *Client) BuildOpenRequest(ctx context.Context, v any) (*http.Request, error) {
+	u := &url.URL{Scheme: c.scheme, Host: c.host, Path: OpenSerialPath()}
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return nil, goahttp.ErrInvalidURL("serial", "open", u.String(), err)
+	}
+	if ctx != nil {
+		req = req.WithContext(ctx)
+	}
+
+	return req, nil
+}
+
+// EncodeOpenRequest returns an encoder for requests sent to the serial open
+// server.
+func EncodeOpenRequest(encoder func(*http.Request) goahttp.Encoder) func(*http.Request, any) error {
+	return func(req *http.Request, v any) error {
+		p, ok := v.(*serial.SerialOpenPayload)
+		if !ok {
+			return goahttp.ErrInvalidType("serial", "open", "*serial.SerialOpenPayload", v)
+		}
+		body := NewOpenRequestBody(p)
+		if err := encoder(req).Encode(&body); err != nil {
+			return goahttp.ErrEncodingError("serial", "open", err)
+		}
+		return nil
+	}
+}
+
+// DecodeOpenResponse returns a decoder for responses returned by the serial
+// open endpoint. restoreBody controls whether the response body should be
+// restored after having been read.
+// DecodeOpenResponse may return the following errors:
+//   - "invalid_request" (type *goa.ServiceError): http.StatusBadRequest
+//   - "not_found" (type *goa.ServiceError): http.StatusNotFound
+//   - "already_open" (type *goa.ServiceError): http.StatusConflict
+//   - "not_allowed" (type *goa.ServiceError): http.StatusForbidden
+//   - error: internal error
+func DecodeOpenResponse(decoder func(*http.Response) goahttp.Decoder, restoreBody bool) func(*http.Response) (any, error) {
+	return func(resp *http.Response) (any, error) {
+		if restoreBody {
+			b, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = io.NopCloser(bytes.NewBuffer(b))
+			defer func() {
+				resp.Body = io.NopCloser(bytes.NewBuffer(b))
+			}()
+		} else {
+			defer resp.Body.Close()
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			var (
+				body OpenResponseBody
+				err  error
+			)
+			err = decoder(resp).Decode(&body)
+			if err != nil {
+				return nil, goahttp.ErrDecodingError("serial", "open", err)
+			}
+			p := NewOpenOperationOK(&body)
+			view := "default"
+			vres := &serialviews.Operation{Projected: p, View: view}
+			if err = serialviews.ValidateOperation(vres); err != nil {
+				return nil, goahttp.ErrValidationError("serial", "open", err)
+			}
+			res := serial.NewOperation(vres)
+			return res, nil
+		case http.StatusBadRequest:
+			var (
+				body OpenInvalidRequestResponseBody
+				err  error
+			)
+			err = decoder(resp).Decode(&body)
+			if err != nil {
+				return nil, goahttp.ErrDecodingError("serial", "open", err)
+			}
+			err = ValidateOpenInvalidRequestResponseBody(&body)
+			if err != nil {
+				return nil, goahttp.ErrValidationError("serial", "open", err)
+			}
+			return nil, NewOpenInvalidRequest(&body)
+		case http.StatusNotFound:
+			var (
+				body OpenNotFoundResponseBody
+				err  error
+			)
+			err = decoder(resp).Decode(&body)
+			if err != nil {
+				return nil, goahttp.ErrDecodingError("serial", "open", err)
+			}
+			err = ValidateOpenNotFoundResponseBody(&body)
+			if err != nil {
+				return nil, goahttp.ErrValidationError("serial", "open", err)
+			}
+			return nil, NewOpenNotFound(&body)
+		case http.StatusConflict:
+			var (
+				body OpenAlreadyOpenResponseBody
+				err  error
+			)
+			err = decoder(resp).Decode(&body)
+			if err != nil {
+				return nil, goahttp.ErrDecodingError("serial", "open", err)
+			}
+			err = ValidateOpenAlreadyOpenResponseBody(&body)
+			if err != nil {
+				return nil, goahttp.ErrValidationError("serial", "open", err)
+			}
+			return nil, NewOpenAlreadyOpen(&body)
+		case http.StatusForbidden:
+			var (
+				body OpenNotAllowedResponseBody
+				err  error
+			)
+			err = decoder(resp).Decode(&body)
+			if err != nil {
+				return nil, goahttp.ErrDecodingError("serial", "open", err)
+			}
+			err = ValidateOpenNotAllowedResponseBody(&body)
+			if err != nil {
+				return nil, goahttp.ErrValidationError("serial", "open", err)
+			}
+			return nil, NewOpenNotAllowed(&body)
+		default:
+			body, _ := io.ReadAll(resp.Body)
+			return nil, goahttp.ErrInvalidResponse("serial", "open", resp.StatusCode, string(body))
+		}
+	}
+}
+
+// BuildCloseRequest instantiates a HTTP request object with method and path
+// set to call the "serial" service "close" endpoint
+func (c *Client) BuildCloseRequest(ctx context.Context, v any) (*http.Request, error) {
+	u := &url.URL{Scheme: c.scheme, Host: c.host, Path: CloseSerialPath()}
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return nil, goahttp.ErrInvalidURL("serial", "close", u.String(), err)
+	}
+	if ctx != nil {
+		req = req.WithContext(ctx)
+	}
+
+	return req, nil
+}
+
+// EncodeCloseRequest returns an encoder for requests sent to the serial close
+// server.
+func EncodeCloseRequest(encoder func(*http.Request) goahttp.Encoder) func(*http.Request, any) error {
+	return func(req *http.Request, v any) error {
+		p, ok := v.(*serial.SerialClosePayload)
+		if !ok {
+			return goahttp.ErrInvalidType("serial", "close", "*serial.SerialClosePayload", v)
+		}
+		body := NewCloseRequestBody(p)
+		if err := encoder(req).Encode(&body); err != nil {
+			return goahttp.ErrEncodingError("serial", "close", err)
+		}
+		return nil
+	}
+}
+
+// DecodeCloseResponse returns a decoder for responses returned by the serial
+// close endpoint. restoreBody controls whether the response body should be
+// restored after having been read.
+// DecodeCloseResponse may return the following errors:
+//   - "invalid_request" (type *goa.ServiceError): http.StatusBadRequest
+//   - "not_found" (type *goa.ServiceError): http.StatusNotFound
+//   - "already_open" (type *goa.ServiceError): http.StatusConflict
+//   - "not_allowed" (type *goa.ServiceError): http.StatusForbidden
+//   - error: internal error
+func DecodeCloseResponse(decoder func(*http.Response) goahttp.Decoder, restoreBody bool) func(*http.Response) (any, error) {
+	return func(resp *http.Response) (any, error) {
+		if restoreBody {
+			b, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = io.NopCloser(bytes.NewBuffer(b))
+			defer func() {
+				resp.Body = io.NopCloser(bytes.NewBuffer(b))
+			}()
+		} else {
+			defer resp.Body.Close()
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			var (
+				body CloseResponseBody
+				err  error
+			)
+			err = decoder(resp).Decode(&body)
+			if err != nil {
+				return nil, goahttp.ErrDecodingError("serial", "close", err)
+			}
+			p := NewCloseOperationOK(&body)
+			view := "default"
+			vres := &serialviews.Operation{Projected: p, View: view}
+			if err = serialviews.ValidateOperation(vres); err != nil {
+				return nil, goahttp.ErrValidationError("serial", "close", err)
+			}
+			res := serial.NewOperation(vres)
+			return res, nil
+		case http.StatusBadRequest:
+			var (
+				body CloseInvalidRequestResponseBody
+				err  error
+			)
+			err = decoder(resp).Decode(&body)
+			if err != nil {
+				return nil, goahttp.ErrDecodingError("serial", "close", err)
+			}
+			err = ValidateCloseInvalidRequestResponseBody(&body)
+			if err != nil {
+				return nil, goahttp.ErrValidationError("serial", "close", err)
+			}
+			return nil, NewCloseInvalidRequest(&body)
+		case http.StatusNotFound:
+			var (
+				body CloseNotFoundResponseBody
+				err  error
+			)
+			err = decoder(resp).Decode(&body)
+			if err != nil {
+				return nil, goahttp.ErrDecodingError("serial", "close", err)
+			}
+			err = ValidateCloseNotFoundResponseBody(&body)
+			if err != nil {
+				return nil, goahttp.ErrValidationError("serial", "close", err)
+			}
+			return nil, NewCloseNotFound(&body)
+		case http.StatusConflict:
+			var (
+				body CloseAlreadyOpenResponseBody
+				err  error
+			)
+			err = decoder(resp).Decode(&body)
+			if err != nil {
+				return nil, goahttp.ErrDecodingError("serial", "close", err)
+			}
+			err = ValidateCloseAlreadyOpenResponseBody(&body)
+			if err != nil {
+				return nil, goahttp.ErrValidationError("serial", "close", err)
+			}
+			return nil, NewCloseAlreadyOpen(&body)
+		case http.StatusForbidden:
+			var (
+				body CloseNotAllowedResponseBody
+				err  error
+			)
+			err = decoder(resp).Decode(&body)
+			if err != nil {
+				return nil, goahttp.ErrDecodingError("serial", "close", err)
+			}
+			err = ValidateCloseNotAllowedResponseBody(&body)
+			if err != nil {
+				return nil, goahttp.ErrValidationError("serial", "close", err)
+			}
+			return nil, NewCloseNotAllowed(&body)
+		default:
+			body, _ := io.ReadAll(resp.Body)
+			return nil, goahttp.ErrInvalidResponse("serial", "close", resp.StatusCode, string(body))
+		}
+	}
+}
@@ -0,0 +1,18 @@
+// Code generated by goa v3.16.1, DO NOT EDIT.
+//
+// HTTP request path constructors for the serial service.
+//
+// Command:
+// $ goa gen github.com/arduino/arduino-create-agent/design
+
+package server
+
+// OpenSerialPath returns the URL path to the serial service open HTTP endpoint.
+func OpenSerialPath() string {
+	return "/v2/serial/open"
+}
+
+// CloseSerialPath returns the URL path to the serial service close HTTP endpoint.
+func CloseSerialPath() string {
+	return "/v2/serial/close"
+}
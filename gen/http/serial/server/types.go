@@ -0,0 +1,374 @@
+// Code generated by goa v3.16.1, DO NOT EDIT.
+//
+// serial HTTP server types
+//
+// Command:
+// $ goa gen github.com/arduino/arduino-create-agent/design
+
+package server
+
+import (
+	serial "github.com/arduino/arduino-create-agent/gen/serial"
+	serialviews "github.com/arduino/arduino-create-agent/gen/serial/views"
+	goa "goa.design/goa/v3/pkg"
+)
+
+// OpenRequestBody is the type of the "serial" service "open" endpoint HTTP
+// request body.
+type OpenRequestBody struct {
+	// The name of the port
+	Port *string `form:"port,omitempty" json:"port,omitempty" xml:"port,omitempty"`
+	// The baud rate
+	Baud *int `form:"baud,omitempty" json:"baud,omitempty" xml:"baud,omitempty"`
+	// The buffer type, the same of the open command of the websocket
+	Buffer *string `form:"buffer,omitempty" json:"buffer,omitempty" xml:"buffer,omitempty"`
+}
+
+// CloseRequestBody is the type of the "serial" service "close" endpoint HTTP
+// request body.
+type CloseRequestBody struct {
+	// The name of the port
+	Port *string `form:"port,omitempty" json:"port,omitempty" xml:"port,omitempty"`
+}
+
+// OpenResponseBody is the type of the "serial" service "open" endpoint HTTP
+// response body.
+type OpenResponseBody struct {
+	// The status of the operation
+	Status string `form:"status" json:"status" xml:"status"`
+}
+
+// CloseResponseBody is the type of the "serial" service "close" endpoint HTTP
+// response body.
+type CloseResponseBody struct {
+	// The status of the operation
+	Status string `form:"status" json:"status" xml:"status"`
+}
+
+// OpenInvalidRequestResponseBody is the type of the "serial" service "open"
+// endpoint HTTP response body for the "invalid_request" error.
+type OpenInvalidRequestResponseBody struct {
+	// Name is the name of this class of errors.
+	Name string `form:"name" json:"name" xml:"name"`
+	// ID is a unique identifier for this particular occurrence of the problem.
+	ID string `form:"id" json:"id" xml:"id"`
+	// Message is a human-readable explanation specific to this occurrence of the
+	// problem.
+	Message string `form:"message" json:"message" xml:"message"`
+	// Is the error temporary?
+	Temporary bool `form:"temporary" json:"temporary" xml:"temporary"`
+	// Is the error a timeout?
+	Timeout bool `form:"timeout" json:"timeout" xml:"timeout"`
+	// Is the error a server-side fault?
+	Fault bool `form:"fault" json:"fault" xml:"fault"`
+}
+
+// OpenNotFoundResponseBody is the type of the "serial" service "open" endpoint
+// HTTP response body for the "not_found" error.
+type OpenNotFoundResponseBody struct {
+	// Name is the name of this class of errors.
+	Name string `form:"name" json:"name" xml:"name"`
+	// ID is a unique identifier for this particular occurrence of the problem.
+	ID string `form:"id" json:"id" xml:"id"`
+	// Message is a human-readable explanation specific to this occurrence of the
+	// problem.
+	Message string `form:"message" json:"message" xml:"message"`
+	// Is the error temporary?
+	Temporary bool `form:"temporary" json:"temporary" xml:"temporary"`
+	// Is the error a timeout?
+	Timeout bool `form:"timeout" json:"timeout" xml:"timeout"`
+	// Is the error a server-side fault?
+	Fault bool `form:"fault" json:"fault" xml:"fault"`
+}
+
+// OpenAlreadyOpenResponseBody is the type of the "serial" service "open"
+// endpoint HTTP response body for the "already_open" error.
+type OpenAlreadyOpenResponseBody struct {
+	// Name is the name of this class of errors.
+	Name string `form:"name" json:"name" xml:"name"`
+	// ID is a unique identifier for this particular occurrence of the problem.
+	ID string `form:"id" json:"id" xml:"id"`
+	// Message is a human-readable explanation specific to this occurrence of the
+	// problem.
+	Message string `form:"message" json:"message" xml:"message"`
+	// Is the error temporary?
+	Temporary bool `form:"temporary" json:"temporary" xml:"temporary"`
+	// Is the error a timeout?
+	Timeout bool `form:"timeout" json:"timeout" xml:"timeout"`
+	// Is the error a server-side fault?
+	Fault bool `form:"fault" json:"fault" xml:"fault"`
+}
+
+// OpenNotAllowedResponseBody is the type of the "serial" service "open"
+// endpoint HTTP response body for the "not_allowed" error.
+type OpenNotAllowedResponseBody struct {
+	// Name is the name of this class of errors.
+	Name string `form:"name" json:"name" xml:"name"`
+	// ID is a unique identifier for this particular occurrence of the problem.
+	ID string `form:"id" json:"id" xml:"id"`
+	// Message is a human-readable explanation specific to this occurrence of the
+	// problem.
+	Message string `form:"message" json:"message" xml:"message"`
+	// Is the error temporary?
+	Temporary bool `form:"temporary" json:"temporary" xml:"temporary"`
+	// Is the error a timeout?
+	Timeout bool `form:"timeout" json:"timeout" xml:"timeout"`
+	// Is the error a server-side fault?
+	Fault bool `form:"fault" json:"fault" xml:"fault"`
+}
+
+// CloseInvalidRequestResponseBody is the type of the "serial" service "close"
+// endpoint HTTP response body for the "invalid_request" error.
+type CloseInvalidRequestResponseBody struct {
+	// Name is the name of this class of errors.
+	Name string `form:"name" json:"name" xml:"name"`
+	// ID is a unique identifier for this particular occurrence of the problem.
+	ID string `form:"id" json:"id" xml:"id"`
+	// Message is a human-readable explanation specific to this occurrence of the
+	// problem.
+	Message string `form:"message" json:"message" xml:"message"`
+	// Is the error temporary?
+	Temporary bool `form:"temporary" json:"temporary" xml:"temporary"`
+	// Is the error a timeout?
+	Timeout bool `form:"timeout" json:"timeout" xml:"timeout"`
+	// Is the error a server-side fault?
+	Fault bool `form:"fault" json:"fault" xml:"fault"`
+}
+
+// CloseNotFoundResponseBody is the type of the "serial" service "close"
+// endpoint HTTP response body for the "not_found" error.
+type CloseNotFoundResponseBody struct {
+	// Name is the name of this class of errors.
+	Name string `form:"name" json:"name" xml:"name"`
+	// ID is a unique identifier for this particular occurrence of the problem.
+	ID string `form:"id" json:"id" xml:"id"`
+	// Message is a human-readable explanation specific to this occurrence of the
+	// problem.
+	Message string `form:"message" json:"message" xml:"message"`
+	// Is the error temporary?
+	Temporary bool `form:"temporary" json:"temporary" xml:"temporary"`
+	// Is the error a timeout?
+	Timeout bool `form:"timeout" json:"timeout" xml:"timeout"`
+	// Is the error a server-side fault?
+	Fault bool `form:"fault" json:"fault" xml:"fault"`
+}
+
+// CloseAlreadyOpenResponseBody is the type of the "serial" service "close"
+// endpoint HTTP response body for the "already_open" error.
+type CloseAlreadyOpenResponseBody struct {
+	// Name is the name of this class of errors.
+	Name string `form:"name" json:"name" xml:"name"`
+	// ID is a unique identifier for this particular occurrence of the problem.
+	ID string `form:"id" json:"id" xml:"id"`
+	// Message is a human-readable explanation specific to this occurrence of the
+	// problem.
+	Message string `form:"message" json:"message" xml:"message"`
+	// Is the error temporary?
+	Temporary bool `form:"temporary" json:"temporary" xml:"temporary"`
+	// Is the error a timeout?
+	Timeout bool `form:"timeout" json:"timeout" xml:"timeout"`
+	// Is the error a server-side fault?
+	Fault bool `form:"fault" json:"fault" xml:"fault"`
+}
+
+// CloseNotAllowedResponseBody is the type of the "serial" service "close"
+// endpoint HTTP response body for the "not_allowed" error.
+type CloseNotAllowedResponseBody struct {
+	// Name is the name of this class of errors.
+	Name string `form:"name" json:"name" xml:"name"`
+	// ID is a unique identifier for this particular occurrence of the problem.
+	ID string `form:"id" json:"id" xml:"id"`
+	// Message is a human-readable explanation specific to this occurrence of the
+	// problem.
+	Message string `form:"message" json:"message" xml:"message"`
+	// Is the error temporary?
+	Temporary bool `form:"temporary" json:"temporary" xml:"temporary"`
+	// Is the error a timeout?
+	Timeout bool `form:"timeout" json:"timeout" xml:"timeout"`
+	// Is the error a server-side fault?
+	Fault bool `form:"fault" json:"fault" xml:"fault"`
+}
+
+// NewOpenResponseBody builds the HTTP response body from the result of the
+// "open" endpoint of the "serial" service.
+func NewOpenResponseBody(res *serialviews.OperationView) *OpenResponseBody {
+	body := &OpenResponseBody{
+		Status: *res.Status,
+	}
+	return body
+}
+
+// NewCloseResponseBody builds the HTTP response body from the result of the
+// "close" endpoint of the "serial" service.
+func NewCloseResponseBody(res *serialviews.OperationView) *CloseResponseBody {
+	body := &CloseResponseBody{
+		Status: *res.Status,
+	}
+	return body
+}
+
+// NewOpenInvalidRequestResponseBody builds the HTTP response body from the
+// result of the "open" endpoint of the "serial" service.
+func NewOpenInvalidRequestResponseBody(res *goa.ServiceError) *OpenInvalidRequestResponseBody {
+	body := &OpenInvalidRequestResponseBody{
+		Name:      res.Name,
+		ID:        res.ID,
+		Message:   res.Message,
+		Temporary: res.Temporary,
+		Timeout:   res.Timeout,
+		Fault:     res.Fault,
+	}
+	return body
+}
+
+// NewOpenNotFoundResponseBody builds the HTTP response body from the result of
+// the "open" endpoint of the "serial" service.
+func NewOpenNotFoundResponseBody(res *goa.ServiceError) *OpenNotFoundResponseBody {
+	body := &OpenNotFoundResponseBody{
+		Name:      res.Name,
+		ID:        res.ID,
+		Message:   res.Message,
+		Temporary: res.Temporary,
+		Timeout:   res.Timeout,
+		Fault:     res.Fault,
+	}
+	return body
+}
+
+// NewOpenAlreadyOpenResponseBody builds the HTTP response body from the result
+// of the "open" endpoint of the "serial" service.
+func NewOpenAlreadyOpenResponseBody(res *goa.ServiceError) *OpenAlreadyOpenResponseBody {
+	body := &OpenAlreadyOpenResponseBody{
+		Name:      res.Name,
+		ID:        res.ID,
+		Message:   res.Message,
+		Temporary: res.Temporary,
+		Timeout:   res.Timeout,
+		Fault:     res.Fault,
+	}
+	return body
+}
+
+// NewOpenNotAllowedResponseBody builds the HTTP response body from the result
+// of the "open" endpoint of the "serial" service.
+func NewOpenNotAllowedResponseBody(res *goa.ServiceError) *OpenNotAllowedResponseBody {
+	body := &OpenNotAllowedResponseBody{
+		Name:      res.Name,
+		ID:        res.ID,
+		Message:   res.Message,
+		Temporary: res.Temporary,
+		Timeout:   res.Timeout,
+		Fault:     res.Fault,
+	}
+	return body
+}
+
+// NewCloseInvalidRequestResponseBody builds the HTTP response body from the
+// result of the "close" endpoint of the "serial" service.
+func NewCloseInvalidRequestResponseBody(res *goa.ServiceError) *CloseInvalidRequestResponseBody {
+	body := &CloseInvalidRequestResponseBody{
+		Name:      res.Name,
+		ID:        res.ID,
+		Message:   res.Message,
+		Temporary: res.Temporary,
+		Timeout:   res.Timeout,
+		Fault:     res.Fault,
+	}
+	return body
+}
+
+// NewCloseNotFoundResponseBody builds the HTTP response body from the result
+// of the "close" endpoint of the "serial" service.
+func NewCloseNotFoundResponseBody(res *goa.ServiceError) *CloseNotFoundResponseBody {
+	body := &CloseNotFoundResponseBody{
+		Name:      res.Name,
+		ID:        res.ID,
+		Message:   res.Message,
+		Temporary: res.Temporary,
+		Timeout:   res.Timeout,
+		Fault:     res.Fault,
+	}
+	return body
+}
+
+// NewCloseAlreadyOpenResponseBody builds the HTTP response body from the
+// result of the "close" endpoint of the "serial" service.
+func NewCloseAlreadyOpenResponseBody(res *goa.ServiceError) *CloseAlreadyOpenResponseBody {
+	body := &CloseAlreadyOpenResponseBody{
+		Name:      res.Name,
+		ID:        res.ID,
+		Message:   res.Message,
+		Temporary: res.Temporary,
+		Timeout:   res.Timeout,
+		Fault:     res.Fault,
+	}
+	return body
+}
+
+// NewCloseNotAllowedResponseBody builds the HTTP response body from the result
+// of the "close" endpoint of the "serial" service.
+func NewCloseNotAllowedResponseBody(res *goa.ServiceError) *CloseNotAllowedResponseBody {
+	body := &CloseNotAllowedResponseBody{
+		Name:      res.Name,
+		ID:        res.ID,
+		Message:   res.Message,
+		Temporary: res.Temporary,
+		Timeout:   res.Timeout,
+		Fault:     res.Fault,
+	}
+	return body
+}
+
+// NewOpenSerialOpenPayload builds a serial service open endpoint payload.
+func NewOpenSerialOpenPayload(body *OpenRequestBody) *serial.SerialOpenPayload {
+	v := &serial.SerialOpenPayload{
+		Port: *body.Port,
+		Baud: *body.Baud,
+	}
+	if body.Buffer != nil {
+		v.Buffer = *body.Buffer
+	}
+	if body.Buffer == nil {
+		v.Buffer = "default"
+	}
+
+	return v
+}
+
+// NewCloseSerialClosePayload builds a serial service close endpoint payload.
+func NewCloseSerialClosePayload(body *CloseRequestBody) *serial.SerialClosePayload {
+	v := &serial.SerialClosePayload{
+		Port: *body.Port,
+	}
+
+	return v
+}
+
+// ValidateOpenRequestBody runs the validations defined on OpenRequestBody
+func ValidateOpenRequestBody(body *OpenRequestBody) (err error) {
+	if body.Port == nil {
+		err = goa.MergeErrors(err, goa.MissingFieldError("port", "body"))
+	}
+	if body.Baud == nil {
+		err = goa.MergeErrors(err, goa.MissingFieldError("baud", "body"))
+	}
+	if body.Baud != nil {
+		if *body.Baud < 1 {
+			err = goa.MergeErrors(err, goa.InvalidRangeError("body.baud", *body.Baud, 1, true))
+		}
+	}
+	if body.Buffer != nil {
+		if !(*body.Buffer == "default" || *body.Buffer == "timed" || *body.Buffer == "timedraw") {
+			err = goa.MergeErrors(err, goa.InvalidEnumValueError("body.buffer", *body.Buffer, []any{"default", "timed", "timedraw"}))
+		}
+	}
+	return
+}
+
+// ValidateCloseRequestBody runs the validations defined on CloseRequestBody
+func ValidateCloseRequestBody(body *CloseRequestBody) (err error) {
+	if body.Port == nil {
+		err = goa.MergeErrors(err, goa.MissingFieldError("port", "body"))
+	}
+	return
+}
@@ -29,6 +29,10 @@ type Client struct {
 	// endpoint.
 	InstalledDoer goahttp.Doer
 
+	// Installedversions Doer is the HTTP client used to make requests to the
+	// installedversions endpoint.
+	InstalledversionsDoer goahttp.Doer
+
 	// Install Doer is the HTTP client used to make requests to the install
 	// endpoint.
 	InstallDoer goahttp.Doer
@@ -56,16 +60,17 @@ func NewClient(
 	restoreBody bool,
 ) *Client {
 	return &Client{
-		AvailableDoer:       doer,
-		InstalledheadDoer:   doer,
-		InstalledDoer:       doer,
-		InstallDoer:         doer,
-		RemoveDoer:          doer,
-		RestoreResponseBody: restoreBody,
-		scheme:              scheme,
-		host:                host,
-		decoder:             dec,
-		encoder:             enc,
+		AvailableDoer:         doer,
+		InstalledheadDoer:     doer,
+		InstalledDoer:         doer,
+		InstalledversionsDoer: doer,
+		InstallDoer:           doer,
+		RemoveDoer:            doer,
+		RestoreResponseBody:   restoreBody,
+		scheme:                scheme,
+		host:                  host,
+		decoder:               dec,
+		encoder:               enc,
 	}
 }
 
@@ -126,6 +131,25 @@ func (c *Client) Installed() goa.Endpoint {
 	}
 }
 
+// Installedversions returns an endpoint that makes HTTP requests to the tools
+// service installedversions server.
+func (c *Client) Installedversions() goa.Endpoint {
+	var (
+		decodeResponse = DecodeInstalledversionsResponse(c.decoder, c.RestoreResponseBody)
+	)
+	return func(ctx context.Context, v any) (any, error) {
+		req, err := c.BuildInstalledversionsRequest(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.InstalledversionsDoer.Do(req)
+		if err != nil {
+			return nil, goahttp.ErrRequestError("tools", "installedversions", err)
+		}
+		return decodeResponse(resp)
+	}
+}
+
 // Install returns an endpoint that makes HTTP requests to the tools service
 // install server.
 func (c *Client) Install() goa.Endpoint {
@@ -175,6 +175,63 @@ func DecodeInstalledResponse(decoder func(*http.Response) goahttp.Decoder, resto
 	}
 }
 
+// BuildInstalledversionsRequest instantiates a HTTP request object with method
+// and path set to call the "tools" service "installedversions" endpoint
+func (c *Client) BuildInstalledversionsRequest(ctx context.Context, v any) (*http.Request, error) {
+	u := &url.URL{Scheme: c.scheme, Host: c.host, Path: InstalledversionsToolsPath()}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, goahttp.ErrInvalidURL("tools", "installedversions", u.String(), err)
+	}
+	if ctx != nil {
+		req = req.WithContext(ctx)
+	}
+
+	return req, nil
+}
+
+// DecodeInstalledversionsResponse returns a decoder for responses returned by
+// the tools installedversions endpoint. restoreBody controls whether the
+// response body should be restored after having been read.
+func DecodeInstalledversionsResponse(decoder func(*http.Response) goahttp.Decoder, restoreBody bool) func(*http.Response) (any, error) {
+	return func(resp *http.Response) (any, error) {
+		if restoreBody {
+			b, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = io.NopCloser(bytes.NewBuffer(b))
+			defer func() {
+				resp.Body = io.NopCloser(bytes.NewBuffer(b))
+			}()
+		} else {
+			defer resp.Body.Close()
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			var (
+				body InstalledversionsResponseBody
+				err  error
+			)
+			err = decoder(resp).Decode(&body)
+			if err != nil {
+				return nil, goahttp.ErrDecodingError("tools", "installedversions", err)
+			}
+			p := NewInstalledversionsInstalledToolCollectionOK(body)
+			view := "default"
+			vres := toolsviews.InstalledToolCollection{Projected: p, View: view}
+			if err = toolsviews.ValidateInstalledToolCollection(vres); err != nil {
+				return nil, goahttp.ErrValidationError("tools", "installedversions", err)
+			}
+			res := tools.NewInstalledToolCollection(vres)
+			return res, nil
+		default:
+			body, _ := io.ReadAll(resp.Body)
+			return nil, goahttp.ErrInvalidResponse("tools", "installedversions", resp.StatusCode, string(body))
+		}
+	}
+}
+
 // BuildInstallRequest instantiates a HTTP request object with method and path
 // set to call the "tools" service "install" endpoint
 func (c *Client) BuildInstallRequest(ctx context.Context, v any) (*http.Request, error) {
@@ -346,3 +403,20 @@ func unmarshalToolResponseToToolsviewsToolView(v *ToolResponse) *toolsviews.Tool
 
 	return res
 }
+
+// unmarshalInstalledToolResponseToToolsviewsInstalledToolView builds a value
+// of type *toolsviews.InstalledToolView from a value of type
+// *InstalledToolResponse.
+func unmarshalInstalledToolResponseToToolsviewsInstalledToolView(v *InstalledToolResponse) *toolsviews.InstalledToolView {
+	res := &toolsviews.InstalledToolView{
+		Name:     v.Name,
+		Packager: v.Packager,
+		Path:     v.Path,
+	}
+	res.Versions = make([]string, len(v.Versions))
+	for i, val := range v.Versions {
+		res.Versions[i] = val
+	}
+
+	return res
+}
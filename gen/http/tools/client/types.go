@@ -55,6 +55,10 @@ type AvailableResponseBody []*ToolResponse
 // endpoint HTTP response body.
 type InstalledResponseBody []*ToolResponse
 
+// InstalledversionsResponseBody is the type of the "tools" service
+// "installedversions" endpoint HTTP response body.
+type InstalledversionsResponseBody []*InstalledToolResponse
+
 // InstallResponseBody is the type of the "tools" service "install" endpoint
 // HTTP response body.
 type InstallResponseBody struct {
@@ -79,6 +83,19 @@ type ToolResponse struct {
 	Packager *string `form:"packager,omitempty" json:"packager,omitempty" xml:"packager,omitempty"`
 }
 
+// InstalledToolResponse is used to define fields on response body types.
+type InstalledToolResponse struct {
+	// The name of the tool
+	Name *string `form:"name,omitempty" json:"name,omitempty" xml:"name,omitempty"`
+	// The packager of the tool
+	Packager *string `form:"packager,omitempty" json:"packager,omitempty" xml:"packager,omitempty"`
+	// The installed versions of the tool
+	Versions []string `form:"versions,omitempty" json:"versions,omitempty" xml:"versions,omitempty"`
+	// The folder of the tool, each version is installed in a subfolder named after
+	// it
+	Path *string `form:"path,omitempty" json:"path,omitempty" xml:"path,omitempty"`
+}
+
 // NewInstallRequestBody builds the HTTP request body from the payload of the
 // "install" endpoint of the "tools" service.
 func NewInstallRequestBody(p *tools.ToolPayload) *InstallRequestBody {
@@ -126,6 +143,17 @@ func NewInstalledToolCollectionOK(body InstalledResponseBody) toolsviews.ToolCol
 	return v
 }
 
+// NewInstalledversionsInstalledToolCollectionOK builds a "tools" service
+// "installedversions" endpoint result from a HTTP "OK" response.
+func NewInstalledversionsInstalledToolCollectionOK(body InstalledversionsResponseBody) toolsviews.InstalledToolCollectionView {
+	v := make([]*toolsviews.InstalledToolView, len(body))
+	for i, val := range body {
+		v[i] = unmarshalInstalledToolResponseToToolsviewsInstalledToolView(val)
+	}
+
+	return v
+}
+
 // NewInstallOperationOK builds a "tools" service "install" endpoint result
 // from a HTTP "OK" response.
 func NewInstallOperationOK(body *InstallResponseBody) *toolsviews.OperationView {
@@ -159,3 +187,21 @@ func ValidateToolResponse(body *ToolResponse) (err error) {
 	}
 	return
 }
+
+// ValidateInstalledToolResponse runs the validations defined on
+// InstalledToolResponse
+func ValidateInstalledToolResponse(body *InstalledToolResponse) (err error) {
+	if body.Name == nil {
+		err = goa.MergeErrors(err, goa.MissingFieldError("name", "body"))
+	}
+	if body.Packager == nil {
+		err = goa.MergeErrors(err, goa.MissingFieldError("packager", "body"))
+	}
+	if body.Versions == nil {
+		err = goa.MergeErrors(err, goa.MissingFieldError("versions", "body"))
+	}
+	if body.Path == nil {
+		err = goa.MergeErrors(err, goa.MissingFieldError("path", "body"))
+	}
+	return
+}
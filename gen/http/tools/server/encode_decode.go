@@ -50,6 +50,18 @@ func EncodeInstalledResponse(encoder func(context.Context, http.ResponseWriter)
 	}
 }
 
+// EncodeInstalledversionsResponse returns an encoder for responses returned by
+// the tools installedversions endpoint.
+func EncodeInstalledversionsResponse(encoder func(context.Context, http.ResponseWriter) goahttp.Encoder) func(context.Context, http.ResponseWriter, any) error {
+	return func(ctx context.Context, w http.ResponseWriter, v any) error {
+		res := v.(toolsviews.InstalledToolCollection)
+		enc := encoder(ctx, w)
+		body := NewInstalledToolResponseCollection(res.Projected)
+		w.WriteHeader(http.StatusOK)
+		return enc.Encode(body)
+	}
+}
+
 // EncodeInstallResponse returns an encoder for responses returned by the tools
 // install endpoint.
 func EncodeInstallResponse(encoder func(context.Context, http.ResponseWriter) goahttp.Encoder) func(context.Context, http.ResponseWriter, any) error {
@@ -142,3 +154,24 @@ func marshalToolsviewsToolViewToToolResponse(v *toolsviews.ToolView) *ToolRespon
 
 	return res
 }
+
+// marshalToolsviewsInstalledToolViewToInstalledToolResponse builds a value of
+// type *InstalledToolResponse from a value of type
+// *toolsviews.InstalledToolView.
+func marshalToolsviewsInstalledToolViewToInstalledToolResponse(v *toolsviews.InstalledToolView) *InstalledToolResponse {
+	res := &InstalledToolResponse{
+		Name:     *v.Name,
+		Packager: *v.Packager,
+		Path:     *v.Path,
+	}
+	if v.Versions != nil {
+		res.Versions = make([]string, len(v.Versions))
+		for i, val := range v.Versions {
+			res.Versions[i] = val
+		}
+	} else {
+		res.Versions = []string{}
+	}
+
+	return res
+}
@@ -26,6 +26,11 @@ func InstalledToolsPath() string {
 	return "/v2/pkgs/tools/installed"
 }
 
+// InstalledversionsToolsPath returns the URL path to the tools service installedversions HTTP endpoint.
+func InstalledversionsToolsPath() string {
+	return "/v2/pkgs/tools/installed/versions"
+}
+
 // InstallToolsPath returns the URL path to the tools service install HTTP endpoint.
 func InstallToolsPath() string {
 	return "/v2/pkgs/tools/installed"
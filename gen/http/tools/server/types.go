@@ -51,6 +51,10 @@ type RemoveRequestBody struct {
 // endpoint HTTP response body.
 type ToolResponseCollection []*ToolResponse
 
+// InstalledToolResponseCollection is the type of the "tools" service
+// "installedversions" endpoint HTTP response body.
+type InstalledToolResponseCollection []*InstalledToolResponse
+
 // InstallResponseBody is the type of the "tools" service "install" endpoint
 // HTTP response body.
 type InstallResponseBody struct {
@@ -75,6 +79,19 @@ type ToolResponse struct {
 	Packager string `form:"packager" json:"packager" xml:"packager"`
 }
 
+// InstalledToolResponse is used to define fields on response body types.
+type InstalledToolResponse struct {
+	// The name of the tool
+	Name string `form:"name" json:"name" xml:"name"`
+	// The packager of the tool
+	Packager string `form:"packager" json:"packager" xml:"packager"`
+	// The installed versions of the tool
+	Versions []string `form:"versions" json:"versions" xml:"versions"`
+	// The folder of the tool, each version is installed in a subfolder named after
+	// it
+	Path string `form:"path" json:"path" xml:"path"`
+}
+
 // NewToolResponseCollection builds the HTTP response body from the result of
 // the "available" endpoint of the "tools" service.
 func NewToolResponseCollection(res toolsviews.ToolCollectionView) ToolResponseCollection {
@@ -85,6 +102,16 @@ func NewToolResponseCollection(res toolsviews.ToolCollectionView) ToolResponseCo
 	return body
 }
 
+// NewInstalledToolResponseCollection builds the HTTP response body from the
+// result of the "installedversions" endpoint of the "tools" service.
+func NewInstalledToolResponseCollection(res toolsviews.InstalledToolCollectionView) InstalledToolResponseCollection {
+	body := make([]*InstalledToolResponse, len(res))
+	for i, val := range res {
+		body[i] = marshalToolsviewsInstalledToolViewToInstalledToolResponse(val)
+	}
+	return body
+}
+
 // NewInstallResponseBody builds the HTTP response body from the result of the
 // "install" endpoint of the "tools" service.
 func NewInstallResponseBody(res *toolsviews.OperationView) *InstallResponseBody {
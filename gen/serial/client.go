@@ -0,0 +1,60 @@
+// Code generated by goa v3.16.1, DO NOT EDIT.
+//
+// serial client
+//
+// Command:
+// $ goa gen github.com/arduino/arduino-create-agent/design
+
+package serial
+
+import (
+	"context"
+
+	goa "goa.design/goa/v3/pkg"
+)
+
+// Client is the "serial" service client.
+type Client struct {
+	OpenEndpoint  goa.Endpoint
+	CloseEndpoint goa.Endpoint
+}
+
+// NewClient initializes a "serial" service client given the endpoints.
+func NewClient(open, close goa.Endpoint) *Client {
+	return &Client{
+		OpenEndpoint:  open,
+		CloseEndpoint: close,
+	}
+}
+
+// Open calls the "open" endpoint of the "serial" service.
+// Open may return the following errors:
+//   - "invalid_request" (type *goa.ServiceError): the request is not valid
+//   - "not_found" (type *goa.ServiceError): port not found
+//   - "already_open" (type *goa.ServiceError): port already open
+//   - "not_allowed" (type *goa.ServiceError): the command is disabled by the agent configuration
+//   - error: internal error
+func (c *Client) Open(ctx context.Context, p *SerialOpenPayload) (res *Operation, err error) {
+	var ires any
+	ires, err = c.OpenEndpoint(ctx, p)
+	if err != nil {
+		return
+	}
+	return ires.(*Operation), nil
+}
+
+// Close calls the "close" endpoint of the "serial" service.
+// Close may return the following errors:
+//   - "invalid_request" (type *goa.ServiceError): the request is not valid
+//   - "not_found" (type *goa.ServiceError): port not found
+//   - "already_open" (type *goa.ServiceError): port already open
+//   - "not_allowed" (type *goa.ServiceError): the command is disabled by the agent configuration
+//   - error: internal error
+func (c *Client) Close(ctx context.Context, p *SerialClosePayload) (res *Operation, err error) {
+	var ires any
+	ires, err = c.CloseEndpoint(ctx, p)
+	if err != nil {
+		return
+	}
+	return ires.(*Operation), nil
+}
@@ -0,0 +1,62 @@
+// Code generated by goa v3.16.1, DO NOT EDIT.
+//
+// serial endpoints
+//
+// Command:
+// $ goa gen github.com/arduino/arduino-create-agent/design
+
+package serial
+
+import (
+	"context"
+
+	goa "goa.design/goa/v3/pkg"
+)
+
+// Endpoints wraps the "serial" service endpoints.
+type Endpoints struct {
+	Open  goa.Endpoint
+	Close goa.Endpoint
+}
+
+// NewEndpoints wraps the methods of the "serial" service with endpoints.
+func NewEndpoints(s Service) *Endpoints {
+	return &Endpoints{
+		Open:  NewOpenEndpoint(s),
+		Close: NewCloseEndpoint(s),
+	}
+}
+
+// Use applies the given middleware to all the "serial" service endpoints.
+func (e *Endpoints) Use(m func(goa.Endpoint) goa.Endpoint) {
+	e.Open = m(e.Open)
+	e.Close = m(e.Close)
+}
+
+// NewOpenEndpoint returns an endpoint function that calls the method "open" of
+// service "serial".
+func NewOpenEndpoint(s Service) goa.Endpoint {
+	return func(ctx context.Context, req any) (any, error) {
+		p := req.(*SerialOpenPayload)
+		res, err := s.Open(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		vres := NewViewedOperation(res, "default")
+		return vres, nil
+	}
+}
+
+// NewCloseEndpoint returns an endpoint function that calls the method "close"
+// of service "serial".
+func NewCloseEndpoint(s Service) goa.Endpoint {
+	return func(ctx context.Context, req any) (any, error) {
+		p := req.(*SerialClosePayload)
+		res, err := s.Close(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		vres := NewViewedOperation(res, "default")
+		return vres, nil
+	}
+}
@@ -0,0 +1,114 @@
+// Code generated by goa v3.16.1, DO NOT EDIT.
+//
+// serial service
+//
+// Command:
+// $ goa gen github.com/arduino/arduino-create-agent/design
+
+package serial
+
+import (
+	"context"
+
+	serialviews "github.com/arduino/arduino-create-agent/gen/serial/views"
+	goa "goa.design/goa/v3/pkg"
+)
+
+// The serial service opens and closes the serial ports for the clients not
+// using the websocket.
+// The data of the open ports is still streamed on the websocket
+type Service interface {
+	// Open implements open.
+	Open(context.Context, *SerialOpenPayload) (res *Operation, err error)
+	// Close implements close.
+	Close(context.Context, *SerialClosePayload) (res *Operation, err error)
+}
+
+// APIName is the name of the API as defined in the design.
+const APIName = "arduino-create-agent"
+
+// APIVersion is the version of the API as defined in the design.
+const APIVersion = "0.0.1"
+
+// ServiceName is the name of the service as defined in the design. This is the
+// same value that is set in the endpoint request contexts under the ServiceKey
+// key.
+const ServiceName = "serial"
+
+// MethodNames lists the service method names as defined in the design. These
+// are the same values that are set in the endpoint request contexts under the
+// MethodKey key.
+var MethodNames = [2]string{"open", "close"}
+
+// Operation is the result type of the serial service open method.
+type Operation struct {
+	// The status of the operation
+	Status string
+}
+
+// SerialClosePayload is the payload type of the serial service close method.
+type SerialClosePayload struct {
+	// The name of the port
+	Port string
+}
+
+// SerialOpenPayload is the payload type of the serial service open method.
+type SerialOpenPayload struct {
+	// The name of the port
+	Port string
+	// The baud rate
+	Baud int
+	// The buffer type, the same of the open command of the websocket
+	Buffer string
+}
+
+// MakeInvalidRequest builds a goa.ServiceError from an error.
+func MakeInvalidRequest(err error) *goa.ServiceError {
+	return goa.NewServiceError(err, "invalid_request", false, false, false)
+}
+
+// MakeNotFound builds a goa.ServiceError from an error.
+func MakeNotFound(err error) *goa.ServiceError {
+	return goa.NewServiceError(err, "not_found", false, false, false)
+}
+
+// MakeAlreadyOpen builds a goa.ServiceError from an error.
+func MakeAlreadyOpen(err error) *goa.ServiceError {
+	return goa.NewServiceError(err, "already_open", false, false, false)
+}
+
+// MakeNotAllowed builds a goa.ServiceError from an error.
+func MakeNotAllowed(err error) *goa.ServiceError {
+	return goa.NewServiceError(err, "not_allowed", false, false, false)
+}
+
+// NewOperation initializes result type Operation from viewed result type
+// Operation.
+func NewOperation(vres *serialviews.Operation) *Operation {
+	return newOperation(vres.Projected)
+}
+
+// NewViewedOperation initializes viewed result type Operation from result type
+// Operation using the given view.
+func NewViewedOperation(res *Operation, view string) *serialviews.Operation {
+	p := newOperationView(res)
+	return &serialviews.Operation{Projected: p, View: "default"}
+}
+
+// newOperation converts projected type Operation to service type Operation.
+func newOperation(vres *serialviews.OperationView) *Operation {
+	res := &Operation{}
+	if vres.Status != nil {
+		res.Status = *vres.Status
+	}
+	return res
+}
+
+// newOperationView projects result type Operation to projected type
+// OperationView using the "default" view.
+func newOperationView(res *Operation) *serialviews.OperationView {
+	vres := &serialviews.OperationView{
+		Status: &res.Status,
+	}
+	return vres
+}
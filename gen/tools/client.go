@@ -15,21 +15,23 @@ import (
 
 // Client is the "tools" service client.
 type Client struct {
-	AvailableEndpoint     goa.Endpoint
-	InstalledheadEndpoint goa.Endpoint
-	InstalledEndpoint     goa.Endpoint
-	InstallEndpoint       goa.Endpoint
-	RemoveEndpoint        goa.Endpoint
+	AvailableEndpoint         goa.Endpoint
+	InstalledheadEndpoint     goa.Endpoint
+	InstalledEndpoint         goa.Endpoint
+	InstalledversionsEndpoint goa.Endpoint
+	InstallEndpoint           goa.Endpoint
+	RemoveEndpoint            goa.Endpoint
 }
 
 // NewClient initializes a "tools" service client given the endpoints.
-func NewClient(available, installedhead, installed, install, remove goa.Endpoint) *Client {
+func NewClient(available, installedhead, installed, installedversions, install, remove goa.Endpoint) *Client {
 	return &Client{
-		AvailableEndpoint:     available,
-		InstalledheadEndpoint: installedhead,
-		InstalledEndpoint:     installed,
-		InstallEndpoint:       install,
-		RemoveEndpoint:        remove,
+		AvailableEndpoint:         available,
+		InstalledheadEndpoint:     installedhead,
+		InstalledEndpoint:         installed,
+		InstalledversionsEndpoint: installedversions,
+		InstallEndpoint:           install,
+		RemoveEndpoint:            remove,
 	}
 }
 
@@ -59,6 +61,17 @@ func (c *Client) Installed(ctx context.Context) (res ToolCollection, err error)
 	return ires.(ToolCollection), nil
 }
 
+// Installedversions calls the "installedversions" endpoint of the "tools"
+// service.
+func (c *Client) Installedversions(ctx context.Context) (res InstalledToolCollection, err error) {
+	var ires any
+	ires, err = c.InstalledversionsEndpoint(ctx, nil)
+	if err != nil {
+		return
+	}
+	return ires.(InstalledToolCollection), nil
+}
+
 // Install calls the "install" endpoint of the "tools" service.
 // Install may return the following errors:
 //   - "not_found" (type *goa.ServiceError): tool not found
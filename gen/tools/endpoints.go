@@ -15,21 +15,23 @@ import (
 
 // Endpoints wraps the "tools" service endpoints.
 type Endpoints struct {
-	Available     goa.Endpoint
-	Installedhead goa.Endpoint
-	Installed     goa.Endpoint
-	Install       goa.Endpoint
-	Remove        goa.Endpoint
+	Available         goa.Endpoint
+	Installedhead     goa.Endpoint
+	Installed         goa.Endpoint
+	Installedversions goa.Endpoint
+	Install           goa.Endpoint
+	Remove            goa.Endpoint
 }
 
 // NewEndpoints wraps the methods of the "tools" service with endpoints.
 func NewEndpoints(s Service) *Endpoints {
 	return &Endpoints{
-		Available:     NewAvailableEndpoint(s),
-		Installedhead: NewInstalledheadEndpoint(s),
-		Installed:     NewInstalledEndpoint(s),
-		Install:       NewInstallEndpoint(s),
-		Remove:        NewRemoveEndpoint(s),
+		Available:         NewAvailableEndpoint(s),
+		Installedhead:     NewInstalledheadEndpoint(s),
+		Installed:         NewInstalledEndpoint(s),
+		Installedversions: NewInstalledversionsEndpoint(s),
+		Install:           NewInstallEndpoint(s),
+		Remove:            NewRemoveEndpoint(s),
 	}
 }
 
@@ -38,6 +40,7 @@ func (e *Endpoints) Use(m func(goa.Endpoint) goa.Endpoint) {
 	e.Available = m(e.Available)
 	e.Installedhead = m(e.Installedhead)
 	e.Installed = m(e.Installed)
+	e.Installedversions = m(e.Installedversions)
 	e.Install = m(e.Install)
 	e.Remove = m(e.Remove)
 }
@@ -76,6 +79,19 @@ func NewInstalledEndpoint(s Service) goa.Endpoint {
 	}
 }
 
+// NewInstalledversionsEndpoint returns an endpoint function that calls the
+// method "installedversions" of service "tools".
+func NewInstalledversionsEndpoint(s Service) goa.Endpoint {
+	return func(ctx context.Context, req any) (any, error) {
+		res, err := s.Installedversions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		vres := NewViewedInstalledToolCollection(res, "default")
+		return vres, nil
+	}
+}
+
 // NewInstallEndpoint returns an endpoint function that calls the method
 // "install" of service "tools".
 func NewInstallEndpoint(s Service) goa.Endpoint {
@@ -22,6 +22,9 @@ type Service interface {
 	Installedhead(context.Context) (err error)
 	// Installed implements installed.
 	Installed(context.Context) (res ToolCollection, err error)
+	// List the installed tools grouped by name, with their versions and the folder
+	// where they are installed
+	Installedversions(context.Context) (res InstalledToolCollection, err error)
 	// Install implements install.
 	Install(context.Context, *ToolPayload) (res *Operation, err error)
 	// Remove implements remove.
@@ -42,7 +45,24 @@ const ServiceName = "tools"
 // MethodNames lists the service method names as defined in the design. These
 // are the same values that are set in the endpoint request contexts under the
 // MethodKey key.
-var MethodNames = [5]string{"available", "installedhead", "installed", "install", "remove"}
+var MethodNames = [6]string{"available", "installedhead", "installed", "installedversions", "install", "remove"}
+
+// A tool installed in the tools folder, with all its installed versions.
+type InstalledTool struct {
+	// The name of the tool
+	Name string
+	// The packager of the tool
+	Packager string
+	// The installed versions of the tool
+	Versions []string
+	// The folder of the tool, each version is installed in a subfolder named after
+	// it
+	Path string
+}
+
+// InstalledToolCollection is the result type of the tools service
+// installedversions method.
+type InstalledToolCollection []*InstalledTool
 
 // Operation is the result type of the tools service install method.
 type Operation struct {
@@ -100,6 +120,20 @@ func NewViewedToolCollection(res ToolCollection, view string) toolsviews.ToolCol
 	return toolsviews.ToolCollection{Projected: p, View: "default"}
 }
 
+// NewInstalledToolCollection initializes result type InstalledToolCollection
+// from viewed result type InstalledToolCollection.
+func NewInstalledToolCollection(vres toolsviews.InstalledToolCollection) InstalledToolCollection {
+	return newInstalledToolCollection(vres.Projected)
+}
+
+// NewViewedInstalledToolCollection initializes viewed result type
+// InstalledToolCollection from result type InstalledToolCollection using the
+// given view.
+func NewViewedInstalledToolCollection(res InstalledToolCollection, view string) toolsviews.InstalledToolCollection {
+	p := newInstalledToolCollectionView(res)
+	return toolsviews.InstalledToolCollection{Projected: p, View: "default"}
+}
+
 // NewOperation initializes result type Operation from viewed result type
 // Operation.
 func NewOperation(vres *toolsviews.Operation) *Operation {
@@ -159,6 +193,67 @@ func newToolView(res *Tool) *toolsviews.ToolView {
 	return vres
 }
 
+// newInstalledToolCollection converts projected type InstalledToolCollection
+// to service type InstalledToolCollection.
+func newInstalledToolCollection(vres toolsviews.InstalledToolCollectionView) InstalledToolCollection {
+	res := make(InstalledToolCollection, len(vres))
+	for i, n := range vres {
+		res[i] = newInstalledTool(n)
+	}
+	return res
+}
+
+// newInstalledToolCollectionView projects result type InstalledToolCollection
+// to projected type InstalledToolCollectionView using the "default" view.
+func newInstalledToolCollectionView(res InstalledToolCollection) toolsviews.InstalledToolCollectionView {
+	vres := make(toolsviews.InstalledToolCollectionView, len(res))
+	for i, n := range res {
+		vres[i] = newInstalledToolView(n)
+	}
+	return vres
+}
+
+// newInstalledTool converts projected type InstalledTool to service type
+// InstalledTool.
+func newInstalledTool(vres *toolsviews.InstalledToolView) *InstalledTool {
+	res := &InstalledTool{}
+	if vres.Name != nil {
+		res.Name = *vres.Name
+	}
+	if vres.Packager != nil {
+		res.Packager = *vres.Packager
+	}
+	if vres.Path != nil {
+		res.Path = *vres.Path
+	}
+	if vres.Versions != nil {
+		res.Versions = make([]string, len(vres.Versions))
+		for i, val := range vres.Versions {
+			res.Versions[i] = val
+		}
+	}
+	return res
+}
+
+// newInstalledToolView projects result type InstalledTool to projected type
+// InstalledToolView using the "default" view.
+func newInstalledToolView(res *InstalledTool) *toolsviews.InstalledToolView {
+	vres := &toolsviews.InstalledToolView{
+		Name:     &res.Name,
+		Packager: &res.Packager,
+		Path:     &res.Path,
+	}
+	if res.Versions != nil {
+		vres.Versions = make([]string, len(res.Versions))
+		for i, val := range res.Versions {
+			vres.Versions[i] = val
+		}
+	} else {
+		vres.Versions = []string{}
+	}
+	return vres
+}
+
 // newOperation converts projected type Operation to service type Operation.
 func newOperation(vres *toolsviews.OperationView) *Operation {
 	res := &Operation{}
@@ -19,6 +19,15 @@ type ToolCollection struct {
 	View string
 }
 
+// InstalledToolCollection is the viewed result type that is projected based on
+// a view.
+type InstalledToolCollection struct {
+	// Type to project
+	Projected InstalledToolCollectionView
+	// View to render
+	View string
+}
+
 // Operation is the viewed result type that is projected based on a view.
 type Operation struct {
 	// Type to project
@@ -40,6 +49,23 @@ type ToolView struct {
 	Packager *string
 }
 
+// InstalledToolCollectionView is a type that runs validations on a projected
+// type.
+type InstalledToolCollectionView []*InstalledToolView
+
+// InstalledToolView is a type that runs validations on a projected type.
+type InstalledToolView struct {
+	// The name of the tool
+	Name *string
+	// The packager of the tool
+	Packager *string
+	// The installed versions of the tool
+	Versions []string
+	// The folder of the tool, each version is installed in a subfolder named after
+	// it
+	Path *string
+}
+
 // OperationView is a type that runs validations on a projected type.
 type OperationView struct {
 	// The status of the operation
@@ -56,6 +82,16 @@ var (
 			"packager",
 		},
 	}
+	// InstalledToolCollectionMap is a map indexing the attribute names of
+	// InstalledToolCollection by view name.
+	InstalledToolCollectionMap = map[string][]string{
+		"default": {
+			"name",
+			"packager",
+			"versions",
+			"path",
+		},
+	}
 	// OperationMap is a map indexing the attribute names of Operation by view name.
 	OperationMap = map[string][]string{
 		"default": {
@@ -70,6 +106,16 @@ var (
 			"packager",
 		},
 	}
+	// InstalledToolMap is a map indexing the attribute names of InstalledTool by
+	// view name.
+	InstalledToolMap = map[string][]string{
+		"default": {
+			"name",
+			"packager",
+			"versions",
+			"path",
+		},
+	}
 )
 
 // ValidateToolCollection runs the validations defined on the viewed result
@@ -84,6 +130,18 @@ func ValidateToolCollection(result ToolCollection) (err error) {
 	return
 }
 
+// ValidateInstalledToolCollection runs the validations defined on the viewed
+// result type InstalledToolCollection.
+func ValidateInstalledToolCollection(result InstalledToolCollection) (err error) {
+	switch result.View {
+	case "default", "":
+		err = ValidateInstalledToolCollectionView(result.Projected)
+	default:
+		err = goa.InvalidEnumValueError("view", result.View, []any{"default"})
+	}
+	return
+}
+
 // ValidateOperation runs the validations defined on the viewed result type
 // Operation.
 func ValidateOperation(result *Operation) (err error) {
@@ -122,6 +180,35 @@ func ValidateToolView(result *ToolView) (err error) {
 	return
 }
 
+// ValidateInstalledToolCollectionView runs the validations defined on
+// InstalledToolCollectionView using the "default" view.
+func ValidateInstalledToolCollectionView(result InstalledToolCollectionView) (err error) {
+	for _, item := range result {
+		if err2 := ValidateInstalledToolView(item); err2 != nil {
+			err = goa.MergeErrors(err, err2)
+		}
+	}
+	return
+}
+
+// ValidateInstalledToolView runs the validations defined on InstalledToolView
+// using the "default" view.
+func ValidateInstalledToolView(result *InstalledToolView) (err error) {
+	if result.Name == nil {
+		err = goa.MergeErrors(err, goa.MissingFieldError("name", "result"))
+	}
+	if result.Packager == nil {
+		err = goa.MergeErrors(err, goa.MissingFieldError("packager", "result"))
+	}
+	if result.Versions == nil {
+		err = goa.MergeErrors(err, goa.MissingFieldError("versions", "result"))
+	}
+	if result.Path == nil {
+		err = goa.MergeErrors(err, goa.MissingFieldError("path", "result"))
+	}
+	return
+}
+
 // ValidateOperationView runs the validations defined on OperationView using
 // the "default" view.
 func ValidateOperationView(result *OperationView) (err error) {
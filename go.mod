@@ -6,6 +6,7 @@ require (
 	fyne.io/systray v1.10.0
 	github.com/ProtonMail/go-crypto v1.1.0-alpha.5-proton
 	github.com/arduino/go-paths-helper v1.12.1
+	github.com/arduino/go-properties-orderedmap v1.8.0
 	github.com/arduino/go-serial-utils v0.1.2
 	github.com/arduino/pluggable-discovery-protocol-handler/v2 v2.2.1
 	github.com/blang/semver v3.5.1+incompatible
@@ -14,6 +15,7 @@ require (
 	github.com/gin-gonic/gin v1.10.0
 	github.com/go-ini/ini v1.62.0
 	github.com/googollee/go-socket.io v0.0.0-20181101151912-c8aeb1ed9b49
+	github.com/gorilla/websocket v1.5.1
 	github.com/mattn/go-shellwords v1.0.12
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/pkg/errors v0.9.1
@@ -29,7 +31,6 @@ require (
 
 require (
 	github.com/AnatolyRugalev/goregen v0.1.0 // indirect
-	github.com/arduino/go-properties-orderedmap v1.8.0 // indirect
 	github.com/bytedance/sonic v1.11.6 // indirect
 	github.com/bytedance/sonic/loader v0.1.1 // indirect
 	github.com/cloudflare/circl v1.3.7 // indirect
@@ -49,7 +50,6 @@ require (
 	github.com/google/go-cmp v0.5.9 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/googollee/go-engine.io v0.0.0-20180829091931-e2f255711dcb // indirect
-	github.com/gorilla/websocket v1.5.1 // indirect
 	github.com/h2non/filetype v1.1.3 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/juju/errors v1.0.0 // indirect
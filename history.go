@@ -0,0 +1,63 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+// maxHistorySize is the maximum number of messages kept in the history, it must
+// fit in the send buffer of a connection to be replayed at once
+const maxHistorySize = 1000
+
+// hubMessage is a message sent by the hub to a connection.
+// seq is the position of the message in the history, 0 if the message is not kept.
+// serial is set if the message is the data read from a port, see serialMessage.
+type hubMessage struct {
+	data   []byte
+	seq    uint64
+	serial *serialMessage
+}
+
+// messageHistory keeps the latest system messages, so that they can be
+// replayed to the clients reconnecting after a disconnection.
+// It's used only by the hub goroutine, so it doesn't need to be synchronized.
+type messageHistory struct {
+	messages []hubMessage
+	size     int
+	lastSeq  uint64
+}
+
+// add stores the message, removing the oldest one if the history is full.
+// It returns the message with its sequence number.
+func (mh *messageHistory) add(msg hubMessage) hubMessage {
+	mh.lastSeq++
+	msg.seq = mh.lastSeq
+	if mh.size <= 0 {
+		return msg
+	}
+	if len(mh.messages) >= mh.size {
+		mh.messages = append(mh.messages[:0], mh.messages[len(mh.messages)-mh.size+1:]...)
+	}
+	mh.messages = append(mh.messages, msg)
+	return msg
+}
+
+// since returns the stored messages following the given sequence number
+func (mh *messageHistory) since(seq uint64) []hubMessage {
+	for i, msg := range mh.messages {
+		if msg.seq > seq {
+			return mh.messages[i:]
+		}
+	}
+	return nil
+}
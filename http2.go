@@ -0,0 +1,38 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// configureHTTP2 sets the protocols advertised by the TLS listener of srv:
+// HTTP/2 with HTTP/1.1 fallback if enabled, otherwise only HTTP/1.1.
+// The websocket upgrade requires HTTP/1.1, the browsers open a separate
+// HTTP/1.1 connection for it even when the page has been loaded over HTTP/2.
+func configureHTTP2(srv *http.Server, enabled bool) {
+	if srv.TLSConfig == nil {
+		srv.TLSConfig = &tls.Config{}
+	}
+	if enabled {
+		srv.TLSConfig.NextProtos = []string{"h2", "http/1.1"}
+		return
+	}
+	srv.TLSConfig.NextProtos = []string{"http/1.1"}
+	// a non-nil TLSNextProto disables the HTTP/2 support that the server enables by default
+	srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+}
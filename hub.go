@@ -16,11 +16,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"html"
 	"io"
-	"os"
 	"runtime"
 	"runtime/debug"
 	"strconv"
@@ -40,36 +40,62 @@ type hub struct {
 	// Inbound messages from the system
 	broadcastSys chan []byte
 
+	// Inbound data from the serial ports
+	broadcastSerial chan serialMessage
+
 	// Register requests from the connections.
 	register chan *connection
 
 	// Unregister requests from connections.
 	unregister chan *connection
+
+	// Latest system messages, replayed to the clients reconnecting
+	history messageHistory
+
+	// Requests of the list of the connections, see sessionsHandler
+	sessions chan chan Sessions
+
+	// Closed when the hub stops, the requests sent afterwards are dropped
+	stopped chan struct{}
 }
 
 var h = hub{
-	broadcast:    make(chan []byte, 1000),
-	broadcastSys: make(chan []byte, 1000),
-	register:     make(chan *connection),
-	unregister:   make(chan *connection),
-	connections:  make(map[*connection]bool),
+	broadcast:       make(chan []byte, defaultQueueSize),
+	broadcastSys:    make(chan []byte, defaultQueueSize),
+	broadcastSerial: make(chan serialMessage, defaultQueueSize),
+	register:        make(chan *connection),
+	unregister:      make(chan *connection),
+	connections:     make(map[*connection]bool),
+	sessions:        make(chan chan Sessions),
+	stopped:         make(chan struct{}),
 }
 
 const commands = `{
   "Commands": [
     "list",
-    "open <portName> <baud> [bufferAlgorithm: ({default}, timed, timedraw)]",
+    "open <portName> <baud> [bufferAlgorithm: ({default}, timed, timedraw)] [options: (timestamp, normalize, eol=(cr, lf, crlf))]",
     "(send, sendnobuf, sendraw) <portName> <cmd>",
+    "sendfile <portName> <base64Content> [chunkSize: {64}] [chunkDelayMs: {10}]",
     "close <portName>",
+    "recordstart <portName> [sent]",
+    "recordstop <portName>",
+    "portstats [portName]",
+    "writebufferdepth <portName>",
+    "resetstats [portName]",
     "restart",
     "exit",
     "killupload",
+    "uploadstatus",
+    "touch <portName> [bannerTimeoutMs: {0}] [baud: {115200}]",
+    "loopbacktest <portName> [baud: {115200}] [timeoutMs: {1000}]",
     "downloadtool <tool> <toolVersion: {latest}> <pack: {arduino}> <behaviour: {keep}>",
     "log",
     "memorystats",
+    "hubstats",
     "gc",
     "hostname",
-    "version"
+    "version",
+    "capabilities"
   ]
 }`
 
@@ -81,7 +107,7 @@ func (h *hub) unregisterConnection(c *connection) {
 	close(c.send)
 }
 
-func (h *hub) sendToRegisteredConnections(data []byte) {
+func (h *hub) sendToRegisteredConnections(data hubMessage) {
 	for c := range h.connections {
 		select {
 		case c.send <- data:
@@ -94,32 +120,89 @@ func (h *hub) sendToRegisteredConnections(data []byte) {
 	}
 }
 
-func (h *hub) run() {
+// run dispatches the messages to the connections until ctx is cancelled
+func (h *hub) run(ctx context.Context) {
 	for {
 		select {
+		case <-ctx.Done():
+			h.stop()
+			return
 		case c := <-h.register:
-			h.connections[c] = true
+			if !h.registerConnection(c) {
+				continue
+			}
 			// send supported commands
-			c.send <- []byte(fmt.Sprintf(`{"Version" : "%s"} `, version))
-			c.send <- []byte(html.EscapeString(commands))
-			c.send <- []byte(fmt.Sprintf(`{"Hostname" : "%s"} `, *hostname))
-			c.send <- []byte(fmt.Sprintf(`{"OS" : "%s"} `, runtime.GOOS))
+			c.send <- hubMessage{data: []byte(fmt.Sprintf(`{"Version" : "%s"} `, version))}
+			c.send <- hubMessage{data: []byte(html.EscapeString(commands))}
+			c.send <- hubMessage{data: []byte(fmt.Sprintf(`{"Hostname" : "%s"} `, hostname.Load()))}
+			c.send <- hubMessage{data: []byte(fmt.Sprintf(`{"OS" : "%s"} `, runtime.GOOS))}
+			// send the messages missed by a client reconnecting
+			if c.replay {
+				for _, msg := range h.history.since(c.since) {
+					c.send <- msg
+				}
+			}
 		case c := <-h.unregister:
 			h.unregisterConnection(c)
+		case res := <-h.sessions:
+			res <- h.getSessions()
 		case m := <-h.broadcast:
 			if len(m) > 0 {
 				checkCmd(m)
-				h.sendToRegisteredConnections(m)
+				h.sendToRegisteredConnections(hubMessage{data: m})
 			}
 		case m := <-h.broadcastSys:
-			h.sendToRegisteredConnections(m)
+			h.sendToRegisteredConnections(h.history.add(hubMessage{data: m}))
+		case m := <-h.broadcastSerial:
+			h.sendToRegisteredConnections(h.history.add(hubMessage{data: m.json, serial: &m}))
 		}
 	}
 }
 
+// stop delivers the pending system messages, e.g. the ones about the ports closed
+// when quitting, then it closes the connections
+func (h *hub) stop() {
+	close(h.stopped)
+Loop:
+	for {
+		select {
+		case m := <-h.broadcastSys:
+			h.sendToRegisteredConnections(h.history.add(hubMessage{data: m}))
+		default:
+			break Loop
+		}
+	}
+	for c := range h.connections {
+		h.unregisterConnection(c)
+	}
+}
+
+// request sends c to one of the register or unregister queues, it returns false
+// without blocking if the hub is stopped
+func (h *hub) request(queue chan *connection, c *connection) bool {
+	select {
+	case queue <- c:
+		return true
+	case <-h.stopped:
+		return false
+	}
+}
+
+// command sends a command received from a websocket to the hub, it returns false
+// without blocking if the hub is stopped
+func (h *hub) command(message []byte) bool {
+	select {
+	case h.broadcast <- message:
+		return true
+	case <-h.stopped:
+		return false
+	}
+}
+
 func checkCmd(m []byte) {
 	//log.Print("Inside checkCmd")
 	s := string(m[:])
+	defer recoverPanic("command " + s)
 
 	sl := strings.ToLower(strings.Trim(s, "\n"))
 
@@ -128,7 +211,18 @@ func checkCmd(m []byte) {
 		return
 	}
 
-	if strings.HasPrefix(sl, "open") {
+	// the commands are matched on the whole first word, so that the name
+	// checked against the allowed and denied commands is the one run
+	cmd := ""
+	if fields := strings.Fields(sl); len(fields) > 0 {
+		cmd = fields[0]
+	}
+	if cmd != "" && !commandAllowed(cmd) {
+		go spErr("The command " + cmd + " is not allowed by the agent configuration")
+		return
+	}
+
+	if cmd == "open" {
 
 		args := strings.Split(s, " ")
 		if len(args) < 3 {
@@ -154,9 +248,29 @@ func checkCmd(m []byte) {
 			buftype := strings.Replace(args[3], "\n", "", -1)
 			bufferAlgorithm = buftype
 		}
-		go spHandlerOpen(args[1], baud, bufferAlgorithm)
+		// the remaining arguments are the options of the port
+		conf := &SerialConfig{Name: args[1], Baud: baud, RtsOn: true}
+		for _, option := range args[min(len(args), 4):] {
+			option = strings.TrimSpace(option)
+			switch {
+			case option == "timestamp":
+				conf.Timestamp = true
+			case option == "normalize":
+				conf.NormalizeLineEndings = true
+			case strings.HasPrefix(option, "eol="):
+				conf.LineEnding, err = parseLineEnding(strings.TrimPrefix(option, "eol="))
+				if err != nil {
+					go spErr(err.Error())
+					return
+				}
+			default:
+				go spErr("Unknown option " + option + " in your open cmd")
+				return
+			}
+		}
+		go spHandlerOpen(conf, bufferAlgorithm)
 
-	} else if strings.HasPrefix(sl, "close") {
+	} else if cmd == "close" {
 
 		args := strings.Split(s, " ")
 		if len(args) > 1 {
@@ -165,7 +279,11 @@ func checkCmd(m []byte) {
 			go spErr("You did not specify a port to close")
 		}
 
-	} else if strings.HasPrefix(sl, "killupload") {
+	} else if cmd == "touch" {
+		go spTouch(s)
+	} else if cmd == "loopbacktest" {
+		go spLoopbackTest(s)
+	} else if cmd == "killupload" {
 		// kill the running process (assumes singleton for now)
 		go func() {
 			upload.Kill()
@@ -173,12 +291,23 @@ func checkCmd(m []byte) {
 			log.Println("{\"uploadStatus\": \"Killed\"}")
 		}()
 
-	} else if strings.HasPrefix(sl, "send") {
-		// will catch send and sendnobuf and sendraw
+	} else if cmd == "uploadstatus" {
+		go broadcastUploadStatus()
+	} else if cmd == "hubstats" {
+		go broadcastHubStats()
+	} else if cmd == "portstats" || cmd == "resetstats" {
+		go spPortStats(s)
+	} else if cmd == "recordstart" || cmd == "recordstop" {
+		go spRecord(s)
+	} else if cmd == "writebufferdepth" {
+		go spWriteBufferDepth(s)
+	} else if cmd == "sendfile" {
+		go spSendFile(s)
+	} else if cmd == "send" || cmd == "sendnobuf" || cmd == "sendraw" {
 		go spWrite(s)
-	} else if strings.HasPrefix(sl, "list") {
+	} else if cmd == "list" {
 		go serialPorts.List()
-	} else if strings.HasPrefix(sl, "downloadtool") {
+	} else if cmd == "downloadtool" {
 		go func() {
 			args := strings.Split(s, " ")
 			var tool, toolVersion, pack, behaviour string
@@ -219,34 +348,53 @@ func checkCmd(m []byte) {
 				h.broadcastSys <- mapB
 			}
 		}()
-	} else if strings.HasPrefix(sl, "log") {
+	} else if cmd == "log" {
 		go logAction(sl)
-	} else if strings.HasPrefix(sl, "restart") {
+	} else if cmd == "restart" {
 		log.Println("Received restart from the daemon. Why? Boh")
 		Systray.Restart()
-	} else if strings.HasPrefix(sl, "exit") {
+	} else if cmd == "exit" {
 		Systray.Quit()
-	} else if strings.HasPrefix(sl, "memstats") {
+	} else if cmd == "memstats" {
 		memoryStats()
-	} else if strings.HasPrefix(sl, "gc") {
+	} else if cmd == "gc" {
 		garbageCollection()
-	} else if strings.HasPrefix(sl, "hostname") {
+	} else if cmd == "hostname" {
 		getHostname()
-	} else if strings.HasPrefix(sl, "version") {
+	} else if cmd == "version" {
 		getVersion()
+	} else if cmd == "capabilities" {
+		broadcastCapabilities()
 	} else {
 		go spErr("Could not understand command.")
 	}
 }
 
+// commandAllowed checks the name of a command, e.g. "sendnobuf", against the
+// allowedCommands and deniedCommands settings. All the commands are allowed by default.
+func commandAllowed(name string) bool {
+	inList := func(list string) bool {
+		for _, cmd := range strings.Split(list, ",") {
+			if strings.EqualFold(strings.TrimSpace(cmd), name) {
+				return true
+			}
+		}
+		return false
+	}
+	if allowed := allowedCommands.Load(); strings.TrimSpace(allowed) != "" && !inList(allowed) {
+		return false
+	}
+	return !inList(deniedCommands.Load())
+}
+
 func logAction(sl string) {
 	if strings.HasPrefix(sl, "log on") {
 		*logDump = "on"
-		multiWriter := io.MultiWriter(&loggerWs, os.Stderr)
+		multiWriter := io.MultiWriter(&loggerWs, logOutput)
 		log.SetOutput(multiWriter)
 	} else if strings.HasPrefix(sl, "log off") {
 		*logDump = "off"
-		log.SetOutput(os.Stderr)
+		log.SetOutput(logOutput)
 		// } else if strings.HasPrefix(sl, "log show") {
 		// TODO: send all the saved log to websocket
 		//h.broadcastSys <- []byte("{\"BufFlowDebug\" : \"" + *logDump + "\"}")
@@ -262,7 +410,7 @@ func memoryStats() {
 }
 
 func getHostname() {
-	h.broadcastSys <- []byte("{\"Hostname\" : \"" + *hostname + "\"}")
+	h.broadcastSys <- []byte("{\"Hostname\" : \"" + hostname.Load() + "\"}")
 }
 
 func getVersion() {
@@ -273,9 +421,8 @@ func garbageCollection() {
 	log.Printf("Starting garbageCollection()\n")
 	h.broadcastSys <- []byte("{\"gc\":\"starting\"}")
 	memoryStats()
-	debug.SetGCPercent(100)
+	// FreeOSMemory collects the garbage even when the garbage collection is off
 	debug.FreeOSMemory()
-	debug.SetGCPercent(-1)
 	log.Printf("Done with garbageCollection()\n")
 	h.broadcastSys <- []byte("{\"gc\":\"done\"}")
 	memoryStats()
@@ -0,0 +1,98 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultQueueSize is the default capacity of the broadcast queues of the hub
+const defaultQueueSize = 1000
+
+// HubStats are the statistics of the broadcast queues of the hub
+type HubStats struct {
+	// QueueSize is the capacity of each queue
+	QueueSize int `json:"queueSize"`
+	// Broadcast, BroadcastSys and Serial are the messages waiting in the queues
+	Broadcast    int `json:"broadcast"`
+	BroadcastSys int `json:"broadcastSys"`
+	Serial       int `json:"serial"`
+	// Dropped is the number of messages dropped because the queue was full
+	Dropped int64 `json:"dropped"`
+}
+
+// droppedMessages counts the system messages dropped because the queue was full
+var droppedMessages atomic.Int64
+
+// setQueueSize changes the capacity of the broadcast queues.
+// It must be called before starting the hub.
+func (h *hub) setQueueSize(size int) {
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	h.broadcast = make(chan []byte, size)
+	h.broadcastSys = make(chan []byte, size)
+	h.broadcastSerial = make(chan serialMessage, size)
+}
+
+// sendSys queues a system message without blocking the caller: if the queue is full
+// the oldest message is dropped. It's used by the serial readers so that a slow client
+// can't stall the data of all the ports.
+func (h *hub) sendSys(m []byte) {
+	sendDropOldest(h.broadcastSys, m)
+}
+
+// sendDropOldest queues m, dropping the oldest message in the queue if it's full
+func sendDropOldest[T any](queue chan T, m T) {
+	for {
+		select {
+		case queue <- m:
+			return
+		default:
+		}
+		select {
+		case <-queue:
+			if n := droppedMessages.Add(1); n == 1 || n%1000 == 0 {
+				log.Warnf("the hub queue is full, dropped %d messages so far", n)
+			}
+		default:
+		}
+	}
+}
+
+func (h *hub) getStats() HubStats {
+	return HubStats{
+		QueueSize:    cap(h.broadcastSys),
+		Broadcast:    len(h.broadcast),
+		BroadcastSys: len(h.broadcastSys),
+		Serial:       len(h.broadcastSerial),
+		Dropped:      droppedMessages.Load(),
+	}
+}
+
+func hubStatsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, h.getStats())
+}
+
+func broadcastHubStats() {
+	stats, _ := json.Marshal(map[string]HubStats{"HubStats": h.getStats()})
+	h.broadcastSys <- stats
+}
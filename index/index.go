@@ -18,11 +18,16 @@ package index
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"path"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
@@ -35,6 +40,23 @@ type Resource struct {
 	IndexURL       url.URL    // The URL used to host the index.json
 	IndexFile      paths.Path // The location of the index on the filesystem
 	IndexSignature paths.Path // The location of the signature on the filesystem
+	Retries        int        // The number of times a failed download is retried
+	mu             sync.Mutex // Protects LastRefresh and the files while the index is refreshed
+
+	extra       []source          // The additional indexes merged into the main one
+	toolSources map[string]string // The URL of the index providing each tool, when there are additional indexes
+
+	loaded     chan struct{} // Closed once an index is available, see Loaded
+	loadedInit sync.Once
+	loadedDone sync.Once
+}
+
+// source is an index to download and where to save it
+type source struct {
+	url       url.URL
+	file      paths.Path
+	signature paths.Path
+	unsigned  bool // if true the signature is not downloaded nor verified, see SetUnsigned
 }
 
 // gpg --export YOURKEYID --export-options export-minimal,no-export-attributes | hexdump /dev/stdin -v -e '/1 "%02X"'
@@ -43,6 +65,18 @@ var publicKeyHex string = "99020D0452FAA2FA011000D0C5604932111750628F171E4E612D5
 // Init will initialize the IndexResource structure and will return it.
 // It will take indexString as a paramenter.
 func Init(indexString string, directory *paths.Path) *Resource {
+	ir := New(indexString, directory)
+	if err := ir.DownloadAndVerify(); err != nil {
+		log.Fatalf("cannot download index: %s", err)
+	}
+	return ir
+}
+
+// New initializes the IndexResource structure like Init, without downloading the index.
+// Use Load or DownloadAndVerify to download it.
+// indexString can be a comma separated list of URLs: the indexes are merged by Read,
+// the later ones overriding the tools with the same name and version of the earlier ones.
+func New(indexString string, directory *paths.Path) *Resource {
 	if directory == nil {
 		log.Fatalf("configuration directory not provided")
 	}
@@ -56,78 +90,275 @@ func Init(indexString string, directory *paths.Path) *Resource {
 			log.Printf("cannot make config dir hidden: %s", err)
 		}
 	}
-	indexParsed, err := url.Parse(indexString)
-	if err != nil {
-		log.Fatalf("cannot parse provided index: %s", indexString)
+
+	var sources []source
+	for i, indexURL := range strings.Split(indexString, ",") {
+		indexURL = strings.TrimSpace(indexURL)
+		if indexURL == "" && i > 0 {
+			continue
+		}
+		indexParsed, err := url.Parse(indexURL)
+		if err != nil {
+			log.Fatalf("cannot parse provided index: %s", indexURL)
+		}
+
+		indexFile := path.Base(indexParsed.Path) // == package_index.json
+		if i > 0 {
+			// the additional indexes are often named like the main one
+			indexFile = fmt.Sprintf("extra%d_%s", i, indexFile)
+		}
+		sources = append(sources, source{
+			url:       *indexParsed,
+			file:      *directory.Join(indexFile),
+			signature: *directory.Join(indexFile + ".sig"),
+		})
 	}
 
-	indexFile := path.Base(indexParsed.Path) // == package_index.json
-	signatureFile := indexFile + ".sig"
+	return &Resource{
+		IndexURL:       sources[0].url,
+		IndexFile:      sources[0].file,
+		IndexSignature: sources[0].signature,
+		extra:          sources[1:],
+	}
+}
 
-	var ir = Resource{
-		IndexURL:       *indexParsed,
-		IndexFile:      *directory.Join(indexFile),
-		IndexSignature: *directory.Join(signatureFile),
+// sources returns the main index followed by the additional ones
+func (ir *Resource) sources() []source {
+	return append([]source{{url: ir.IndexURL, file: ir.IndexFile, signature: ir.IndexSignature}}, ir.extra...)
+}
+
+// SetUnsigned disables the verification of the signatures of the additional indexes in urls,
+// a comma separated list, e.g. for the third-party indexes not signed by Arduino. The tools
+// of these indexes are verified only with their checksum, so they can't provide the packages
+// of the signed indexes, see merge. The main index is always verified.
+// It must be called before downloading the indexes.
+func (ir *Resource) SetUnsigned(urls string) error {
+	for _, unsigned := range strings.Split(urls, ",") {
+		if unsigned = strings.TrimSpace(unsigned); unsigned == "" {
+			continue
+		}
+		i := slices.IndexFunc(ir.extra, func(src source) bool { return src.url.String() == unsigned })
+		if i < 0 {
+			return fmt.Errorf("%s is not one of the additional indexes, only their signature can be skipped", unsigned)
+		}
+		ir.extra[i].unsigned = true
 	}
+	return nil
+}
 
-	if err := ir.DownloadAndVerify(); err != nil {
-		log.Fatalf("cannot download index: %s", err)
+// IsUnsigned tells if the signature of the index at indexURL is not verified, see SetUnsigned
+func (ir *Resource) IsUnsigned(indexURL string) bool {
+	return slices.ContainsFunc(ir.extra, func(src source) bool { return src.unsigned && src.url.String() == indexURL })
+}
+
+// urls returns the comma separated list of the URLs of the indexes
+func (ir *Resource) urls() string {
+	var urls []string
+	for _, src := range ir.sources() {
+		urls = append(urls, src.url.String())
+	}
+	return strings.Join(urls, ", ")
+}
+
+// Load downloads the index like DownloadAndVerify, reporting the progress to the logger.
+// If the download fails or takes longer than timeout, and an index downloaded by a previous
+// run exists, the cached index is used and the download continues in the background.
+// Without a cached index it returns an error and the download is retried in the background
+// until it succeeds, see Loaded.
+func (ir *Resource) Load(timeout time.Duration, logger func(msg string)) error {
+	logger("Downloading the index from " + ir.urls())
+	done := make(chan error, 1)
+	go func() {
+		done <- ir.DownloadAndVerify()
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			logger("Index downloaded")
+			return nil
+		}
+		if ir.IndexFile.Exist() {
+			logger("Cannot download the index, using the cached one: " + err.Error())
+			ir.refreshFailed()
+			ir.setLoaded()
+			return nil
+		}
+		go ir.retryDownload(err, logger)
+		return err
+	case <-time.After(timeout):
+		if !ir.IndexFile.Exist() {
+			go func() {
+				if err := <-done; err != nil {
+					ir.retryDownload(err, logger)
+				} else {
+					logger("Index downloaded")
+				}
+			}()
+			return fmt.Errorf("the index has not been downloaded within %s, continuing the download in the background", timeout)
+		}
+		logger("Using the cached index, refreshing it in the background...")
+		ir.setLoaded()
+		go func() {
+			if err := <-done; err != nil {
+				logger("Cannot refresh the index: " + err.Error())
+				ir.refreshFailed()
+			} else {
+				logger("Index refreshed")
+			}
+		}()
+		return nil
 	}
+}
+
+// backgroundRetryDelay is the wait before retrying in the background a failed download of
+// the index, when there is no cached one. It doubles after each attempt up to maxBackgroundRetryDelay.
+var backgroundRetryDelay = 10 * time.Second
 
-	return &ir
+const maxBackgroundRetryDelay = 10 * time.Minute
+
+// retryDownload retries the download of the index until it succeeds
+func (ir *Resource) retryDownload(err error, logger func(msg string)) {
+	for delay := backgroundRetryDelay; err != nil; delay = min(delay*2, maxBackgroundRetryDelay) {
+		logger("Cannot download the index, retrying in " + delay.String() + ": " + err.Error())
+		time.Sleep(delay)
+		err = ir.DownloadAndVerify()
+	}
+	logger("Index downloaded")
+}
+
+// Loaded returns a channel closed once an index is available, downloaded or cached
+func (ir *Resource) Loaded() <-chan struct{} {
+	ir.loadedInit.Do(func() { ir.loaded = make(chan struct{}) })
+	return ir.loaded
+}
+
+func (ir *Resource) setLoaded() {
+	ir.Loaded()
+	ir.loadedDone.Do(func() { close(ir.loaded) })
+}
+
+const (
+	// refreshInterval is the age after which the index is downloaded again
+	refreshInterval = time.Hour
+	// failedRefreshDelay is the wait before downloading again the index after a failed refresh
+	failedRefreshDelay = 5 * time.Minute
+)
+
+// refreshFailed postpones the next refresh of the cached index, so that the reads
+// don't try to download it again every time while the server is unreachable
+func (ir *Resource) refreshFailed() {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	ir.LastRefresh = time.Now().Add(failedRefreshDelay - refreshInterval)
 }
 
 // DownloadAndVerify will download an index file located at IndexURL and verify the signature
-// if everything matches the files are overwritten
+// if everything matches the files are overwritten.
+// The additional indexes are downloaded and verified in the same way, but the ones failing
+// are skipped with a warning: the copy downloaded previously is used, if any.
 func (ir *Resource) DownloadAndVerify() error {
-	// Fetch the index
-	resp, err := http.Get(ir.IndexURL.String())
-	if err != nil {
-		return err
+	for i, src := range ir.sources() {
+		err := ir.downloadAndVerify(src)
+		if err != nil && i == 0 {
+			return err
+		} else if err != nil {
+			log.Printf("cannot download the additional index %s, skipping it: %s", src.url.String(), err)
+		}
 	}
-	defer resp.Body.Close()
 
-	// Read the index body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
+	ir.mu.Lock()
+	ir.LastRefresh = time.Now()
+	ir.mu.Unlock()
+	ir.setLoaded()
+	return nil
+}
 
-	// Fetch the signature
-	signature, err := http.Get(ir.IndexURL.String() + ".sig")
+func (ir *Resource) downloadAndVerify(src source) error {
+	// Fetch the index
+	body, err := ir.fetch(src.url.String())
 	if err != nil {
 		return err
 	}
-	defer signature.Body.Close()
+	if src.unsigned {
+		if err := json.Unmarshal(body, &struct{}{}); err != nil {
+			return fmt.Errorf("cannot parse the index %s: %w", src.url.String(), err)
+		}
+		log.Printf("the signature of the index %s is not verified", src.url.String())
+		ir.mu.Lock()
+		defer ir.mu.Unlock()
+		return src.file.WriteFile(body)
+	}
 
-	// Read the signature body
-	signatureBody, err := io.ReadAll(signature.Body)
+	// Fetch the signature
+	signatureBody, err := ir.fetch(src.url.String() + ".sig")
 	if err != nil {
 		return err
 	}
 
 	err = checkGPGSig(bytes.NewReader(body), bytes.NewReader(signatureBody))
 	if err != nil {
-		return err
+		return fmt.Errorf("cannot verify the signature of %s: %w", src.url.String(), err)
 	}
 
 	// we overwrite the files if the signature is valid
-	ir.IndexFile.WriteFile(body)
-	ir.IndexSignature.WriteFile(signatureBody)
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	src.file.WriteFile(body)
+	src.signature.WriteFile(signatureBody)
+	return nil
+}
 
-	ir.LastRefresh = time.Now()
+// retryDelay is the wait before retrying a failed download, it doubles after each attempt
+var retryDelay = time.Second
 
-	return nil
+// fetch returns the body of the resource at url. The download is retried up to ir.Retries times
+// if the connection fails or the server answers with an error.
+func (ir *Resource) fetch(url string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		body, err := fetch(url)
+		if err == nil || attempt >= ir.Retries {
+			return body, err
+		}
+		delay := min(retryDelay<<attempt, 30*time.Second)
+		log.Printf("cannot download %s, retrying in %s (%d/%d): %s", url, delay, attempt+1, ir.Retries, err)
+		time.Sleep(delay)
+	}
+}
+
+// httpClient downloads the indexes, the timeout avoids waiting forever on a stalled connection
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+// fetch returns the body of the resource at url
+func fetch(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("cannot download %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Keyring returns the keyring containing the Arduino public key,
+// used to verify the signatures of the index and of the tools archives
+func Keyring() (openpgp.EntityList, error) {
+	publicKeyBin, err := hex.DecodeString(publicKeyHex)
+	if err != nil {
+		return nil, err
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(publicKeyBin))
 }
 
 // checkGPGSign takes a signed io.Reader and a detached signature io.Reader
 // and returns if the signature is valid
 func checkGPGSig(signed, signature io.Reader) error {
-	publicKeyBin, err := hex.DecodeString(publicKeyHex)
+	keyring, err := Keyring()
 	if err != nil {
 		return err
 	}
-	keyring, _ := openpgp.ReadKeyRing(bytes.NewReader(publicKeyBin))
 
 	_, err = openpgp.CheckDetachedSignature(keyring, signed, signature, nil)
 	return err
@@ -135,12 +366,153 @@ func checkGPGSig(signed, signature io.Reader) error {
 
 // Read will read the index file. In case it doesn't exists or the latest downloaded
 // version is older than 1 hour, it will be downloaded again.
+// If the download fails the cached index is used, if any, and the download is tried
+// again after failedRefreshDelay.
+// With additional indexes it returns the merged index.
 func (ir *Resource) Read() ([]byte, error) {
-	if !ir.IndexFile.Exist() || time.Since(ir.LastRefresh) > 1*time.Hour {
+	ir.mu.Lock()
+	stale := !ir.IndexFile.Exist() || time.Since(ir.LastRefresh) > refreshInterval
+	ir.mu.Unlock()
+	if stale {
 		// Download the file again and save it
 		if err := ir.DownloadAndVerify(); err != nil {
+			if !ir.IndexFile.Exist() {
+				return nil, err
+			}
+			log.Printf("cannot refresh the index, using the cached one: %s", err)
+			ir.refreshFailed()
+		}
+	}
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	if len(ir.extra) == 0 {
+		return ir.IndexFile.ReadFile()
+	}
+
+	var urls []string
+	var unsigned []bool
+	var contents [][]byte
+	for i, src := range ir.sources() {
+		content, err := src.file.ReadFile()
+		if err != nil && i == 0 {
 			return nil, err
+		} else if err != nil {
+			// the additional index has never been downloaded
+			continue
+		}
+		urls = append(urls, src.url.String())
+		unsigned = append(unsigned, src.unsigned)
+		contents = append(contents, content)
+	}
+	merged, toolSources, err := merge(urls, unsigned, contents)
+	if err != nil {
+		return nil, err
+	}
+	ir.toolSources = toolSources
+	return merged, nil
+}
+
+// ToolSource returns the URL of the index providing the tool, as of the last Read.
+// It returns an empty string if there are no additional indexes or the tool is unknown.
+func (ir *Resource) ToolSource(packager, name, version string) string {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	return ir.toolSources[packager+"/"+name+"/"+version]
+}
+
+// merge merges the tools and the platforms of the indexes, the later ones override the
+// tools with the same packager, name and version, and the platforms with the same
+// packager, architecture and version of the earlier ones. The other fields of the
+// packages are taken from the first index providing them.
+// The unsigned indexes can't provide the packages of the signed ones, e.g. arduino: their
+// tools would be installed without verifying the signatures, so these packages are skipped.
+// It returns the merged index and the URL of the index providing each tool.
+func merge(urls []string, unsigned []bool, contents [][]byte) ([]byte, map[string]string, error) {
+	indexes := make([][]map[string]any, len(contents))
+	signedPackagers := map[string]bool{}
+	for i, content := range contents {
+		var index struct {
+			Packages []map[string]any `json:"packages"`
+		}
+		if err := json.Unmarshal(content, &index); err != nil {
+			return nil, nil, fmt.Errorf("cannot parse the index %s: %w", urls[i], err)
+		}
+		indexes[i] = index.Packages
+		for _, pkg := range index.Packages {
+			if !unsigned[i] {
+				packager, _ := pkg["name"].(string)
+				signedPackagers[packager] = true
+			}
 		}
 	}
-	return ir.IndexFile.ReadFile()
+
+	var packages []map[string]any
+	packagesByName := map[string]map[string]any{}
+	toolSources := map[string]string{}
+	for i, index := range indexes {
+		for _, pkg := range index {
+			packager, _ := pkg["name"].(string)
+			if unsigned[i] && signedPackagers[packager] {
+				log.Printf("the package %s of the unsigned index %s is skipped, it's provided by a signed index", packager, urls[i])
+				continue
+			}
+			merged, ok := packagesByName[packager]
+			if !ok {
+				merged = map[string]any{}
+				for key, value := range pkg {
+					merged[key] = value
+				}
+				merged["tools"] = []any{}
+				packagesByName[packager] = merged
+				packages = append(packages, merged)
+			} else if newPlatforms, _ := pkg["platforms"].([]any); len(newPlatforms) > 0 {
+				platforms, _ := merged["platforms"].([]any)
+				for _, platform := range newPlatforms {
+					architecture, version := platformID(platform)
+					platforms = slices.DeleteFunc(platforms, func(p any) bool {
+						a, v := platformID(p)
+						return a == architecture && v == version
+					})
+					platforms = append(platforms, platform)
+				}
+				merged["platforms"] = platforms
+			}
+
+			tools, _ := merged["tools"].([]any)
+			newTools, _ := pkg["tools"].([]any)
+			for _, tool := range newTools {
+				name, version := toolID(tool)
+				key := packager + "/" + name + "/" + version
+				if previous, ok := toolSources[key]; ok {
+					log.Printf("the tool %s of %s overrides the one of %s", key, urls[i], previous)
+					tools = slices.DeleteFunc(tools, func(t any) bool {
+						n, v := toolID(t)
+						return n == name && v == version
+					})
+				}
+				tools = append(tools, tool)
+				toolSources[key] = urls[i]
+			}
+			merged["tools"] = tools
+		}
+	}
+
+	merged, err := json.Marshal(map[string]any{"packages": packages})
+	return merged, toolSources, err
+}
+
+// platformID returns the architecture and the version of a platform of the index
+func platformID(platform any) (architecture, version string) {
+	fields, _ := platform.(map[string]any)
+	architecture, _ = fields["architecture"].(string)
+	version, _ = fields["version"].(string)
+	return architecture, version
+}
+
+// toolID returns the name and the version of a tool of the index
+func toolID(tool any) (name, version string) {
+	fields, _ := tool.(map[string]any)
+	name, _ = fields["name"].(string)
+	version, _ = fields["version"].(string)
+	return name, version
 }
@@ -1,9 +1,16 @@
 package index
 
 import (
+	"bytes"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/arduino/go-paths-helper"
 	"github.com/stretchr/testify/require"
 )
@@ -23,3 +30,259 @@ func TestInit(t *testing.T) {
 	require.FileExists(t, tempDir.Join(fileName).String())
 	require.FileExists(t, tempDir.Join(signatureName).String())
 }
+
+func TestLoad(t *testing.T) {
+	release := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") != "" {
+			<-release
+		}
+		// the signature of this index is never valid
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+	defer close(release)
+	// the logger is called by the download in background as well
+	var mu sync.Mutex
+	var messages []string
+	logger := func(msg string) {
+		mu.Lock()
+		defer mu.Unlock()
+		messages = append(messages, msg)
+	}
+	lastMessage := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return messages[len(messages)-1]
+	}
+
+	t.Run("no cached index", func(t *testing.T) {
+		ir := New(server.URL+"/package_index.json", paths.New(t.TempDir()))
+		require.Error(t, ir.Load(time.Second, logger))
+		select {
+		case <-ir.Loaded():
+			require.Fail(t, "the index is not loaded")
+		default:
+		}
+	})
+
+	t.Run("slow download without a cached index", func(t *testing.T) {
+		ir := New(server.URL+"/package_index.json?slow=1", paths.New(t.TempDir()))
+		start := time.Now()
+		require.ErrorContains(t, ir.Load(100*time.Millisecond, logger), "background")
+		require.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("download fails with a cached index", func(t *testing.T) {
+		ir := New(server.URL+"/package_index.json", paths.New(t.TempDir()))
+		require.NoError(t, ir.IndexFile.WriteFile([]byte("cached")))
+		require.NoError(t, ir.Load(time.Second, logger))
+		require.Contains(t, lastMessage(), "using the cached one")
+		<-ir.Loaded()
+		data, err := ir.Read()
+		require.NoError(t, err)
+		require.Equal(t, "cached", string(data))
+	})
+
+	t.Run("slow download with a cached index", func(t *testing.T) {
+		ir := New(server.URL+"/package_index.json?slow=1", paths.New(t.TempDir()))
+		require.NoError(t, ir.IndexFile.WriteFile([]byte("cached")))
+		start := time.Now()
+		require.NoError(t, ir.Load(100*time.Millisecond, logger))
+		require.Less(t, time.Since(start), 5*time.Second)
+		require.Equal(t, "Using the cached index, refreshing it in the background...", lastMessage())
+	})
+}
+
+func TestBackgroundRetries(t *testing.T) {
+	delayOrig := backgroundRetryDelay
+	backgroundRetryDelay = time.Millisecond
+	defer func() { backgroundRetryDelay = delayOrig }()
+
+	// the index is downloaded only after some failures, the signature is never valid
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	ir := New(server.URL+"/package_index.json", paths.New(t.TempDir()))
+	require.Error(t, ir.Load(time.Second, func(string) {}))
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests > 4
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestReadDoesNotRetryFailedRefresh(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ir := New(server.URL+"/package_index.json", paths.New(t.TempDir()))
+	require.NoError(t, ir.IndexFile.WriteFile([]byte("cached")))
+	for i := 0; i < 3; i++ {
+		data, err := ir.Read()
+		require.NoError(t, err)
+		require.Equal(t, "cached", string(data))
+	}
+	require.Equal(t, 1, requests)
+}
+
+func TestFetchRetries(t *testing.T) {
+	retryDelayOrig := retryDelay
+	retryDelay = time.Millisecond
+	defer func() { retryDelay = retryDelayOrig }()
+
+	// the server fails twice before answering
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			http.Error(w, "try later", http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	ir := New(server.URL+"/package_index.json", paths.New(t.TempDir()))
+	_, err := ir.fetch(server.URL + "/package_index.json")
+	require.ErrorContains(t, err, "502")
+	require.Equal(t, 1, requests)
+
+	requests = 0
+	ir.Retries = 2
+	body, err := ir.fetch(server.URL + "/package_index.json")
+	require.NoError(t, err)
+	require.Equal(t, "{}", string(body))
+	require.Equal(t, 3, requests)
+}
+
+func TestMultipleIndexes(t *testing.T) {
+	dir := paths.New(t.TempDir())
+
+	// a single URL works as before
+	ir := New("https://downloads.arduino.cc/packages/package_index.json", dir)
+	require.Empty(t, ir.extra)
+	require.NoError(t, ir.IndexFile.WriteFile([]byte(`{"packages": []}`)))
+	ir.LastRefresh = time.Now()
+	content, err := ir.Read()
+	require.NoError(t, err)
+	require.Equal(t, `{"packages": []}`, string(content))
+	require.Empty(t, ir.ToolSource("arduino", "bossac", "1.7.0"))
+
+	ir = New("https://downloads.arduino.cc/packages/package_index.json, https://example.com/package_index.json", dir)
+	require.Len(t, ir.extra, 1)
+	require.Equal(t, "extra1_package_index.json", ir.extra[0].file.Base())
+	require.NoError(t, ir.IndexFile.WriteFile([]byte(`{"packages": [{"name": "arduino", "maintainer": "Arduino",
+		"platforms": [{"architecture": "avr", "version": "1.8.5", "name": "AVR"}, {"architecture": "avr", "version": "1.8.6", "name": "AVR"}],
+		"tools": [
+			{"name": "bossac", "version": "1.7.0", "systems": [{"url": "https://downloads.arduino.cc/bossac"}]},
+			{"name": "avrdude", "version": "6.3.0", "systems": []}
+		]
+	}]}`)))
+	require.NoError(t, ir.extra[0].file.WriteFile([]byte(`{"packages": [
+		{"name": "arduino", "maintainer": "Someone else",
+			"platforms": [{"architecture": "avr", "version": "1.8.6", "name": "Other AVR"}, {"architecture": "samd", "version": "1.8.14", "name": "SAMD"}],
+			"tools": [{"name": "bossac", "version": "1.7.0", "systems": [{"url": "https://example.com/bossac"}]}]
+		},
+		{"name": "thirdparty", "tools": [{"name": "flasher", "version": "1.0.0", "systems": []}]}
+	]}`)))
+	ir.LastRefresh = time.Now()
+	content, err = ir.Read()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"packages": [
+		{"name": "arduino", "maintainer": "Arduino",
+		"platforms": [
+			{"architecture": "avr", "version": "1.8.5", "name": "AVR"},
+			{"architecture": "avr", "version": "1.8.6", "name": "Other AVR"},
+			{"architecture": "samd", "version": "1.8.14", "name": "SAMD"}
+		],
+		"tools": [
+			{"name": "avrdude", "version": "6.3.0", "systems": []},
+			{"name": "bossac", "version": "1.7.0", "systems": [{"url": "https://example.com/bossac"}]}
+		]},
+		{"name": "thirdparty", "tools": [{"name": "flasher", "version": "1.0.0", "systems": []}]}
+	]}`, string(content))
+	require.Equal(t, "https://example.com/package_index.json", ir.ToolSource("arduino", "bossac", "1.7.0"))
+	require.Equal(t, "https://downloads.arduino.cc/packages/package_index.json", ir.ToolSource("arduino", "avrdude", "6.3.0"))
+	require.Equal(t, "https://example.com/package_index.json", ir.ToolSource("thirdparty", "flasher", "1.0.0"))
+}
+
+func TestAdditionalIndexes(t *testing.T) {
+	// the indexes are signed with a test key instead of the Arduino one
+	key, err := openpgp.NewEntity("Test", "", "test@example.com", nil)
+	require.NoError(t, err)
+	var publicKey bytes.Buffer
+	require.NoError(t, key.Serialize(&publicKey))
+	defer func(hex string) { publicKeyHex = hex }(publicKeyHex)
+	publicKeyHex = hex.EncodeToString(publicKey.Bytes())
+
+	mainIndex := []byte(`{"packages": [{"name": "arduino", "tools": [{"name": "bossac", "version": "1.7.0", "systems": []}]}]}`)
+	var signature bytes.Buffer
+	require.NoError(t, openpgp.DetachSign(&signature, key, bytes.NewReader(mainIndex), nil))
+	thirdPartyIndex := []byte(`{"packages": [
+		{"name": "thirdparty", "tools": [{"name": "flasher", "version": "1.0.0", "systems": []}]},
+		{"name": "arduino", "tools": [
+			{"name": "bossac", "version": "1.7.0", "systems": [{"url": "https://example.com/bossac"}]},
+			{"name": "bossac", "version": "9.9.9", "systems": []}
+		]}
+	]}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/package_index.json":
+			w.Write(mainIndex)
+		case "/package_index.json.sig":
+			w.Write(signature.Bytes())
+		case "/package_thirdparty_index.json":
+			w.Write(thirdPartyIndex)
+		default:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	mainURL, brokenURL, thirdPartyURL := server.URL+"/package_index.json", server.URL+"/package_broken_index.json", server.URL+"/package_thirdparty_index.json"
+
+	// the failing additional indexes are skipped, the unsigned ones too unless they are allowed
+	ir := New(mainURL+","+brokenURL+","+thirdPartyURL, paths.New(t.TempDir()))
+	require.NoError(t, ir.DownloadAndVerify())
+	require.NoFileExists(t, ir.extra[0].file.String())
+	require.NoFileExists(t, ir.extra[1].file.String())
+	content, err := ir.Read()
+	require.NoError(t, err)
+	require.JSONEq(t, string(mainIndex), string(content))
+
+	require.ErrorContains(t, ir.SetUnsigned(mainURL), "not one of the additional indexes")
+	require.ErrorContains(t, ir.SetUnsigned("https://example.com/package_index.json"), "not one of the additional indexes")
+	require.NoError(t, ir.SetUnsigned(" "+thirdPartyURL+" ,"))
+	require.True(t, ir.IsUnsigned(thirdPartyURL))
+	require.False(t, ir.IsUnsigned(mainURL))
+	require.NoError(t, ir.DownloadAndVerify())
+	require.FileExists(t, ir.extra[1].file.String())
+	require.NoFileExists(t, ir.extra[1].signature.String())
+	content, err = ir.Read()
+	require.NoError(t, err)
+	require.Equal(t, thirdPartyURL, ir.ToolSource("thirdparty", "flasher", "1.0.0"))
+
+	// the unsigned index can't override or add the tools of the packages of the signed ones,
+	// they would be installed without verifying their signatures
+	require.JSONEq(t, `{"packages": [
+		{"name": "arduino", "tools": [{"name": "bossac", "version": "1.7.0", "systems": []}]},
+		{"name": "thirdparty", "tools": [{"name": "flasher", "version": "1.0.0", "systems": []}]}
+	]}`, string(content))
+	require.Equal(t, mainURL, ir.ToolSource("arduino", "bossac", "1.7.0"))
+	require.Empty(t, ir.ToolSource("arduino", "bossac", "9.9.9"))
+
+	// the main index is always required
+	ir = New(brokenURL+","+mainURL, paths.New(t.TempDir()))
+	require.Error(t, ir.DownloadAndVerify())
+}
@@ -17,26 +17,102 @@ package main
 
 import (
 	"runtime"
+	"runtime/debug"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.bug.st/serial"
 )
 
+// AgentInfo describes the running agent and where to reach it
+type AgentInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	HTTP      string `json:"http"`
+	HTTPS     string `json:"https"`
+	WS        string `json:"ws"`
+	WSS       string `json:"wss"`
+	HTTPPort  int    `json:"http_port"`
+	HTTPSPort int    `json:"https_port"`
+	Origins   string `json:"origins"`
+	UpdateURL string `json:"update_url"`
+	OS        string `json:"os"`
+	OSName    string `json:"os_name"`
+	Arch      string `json:"arch"`
+	Autostart bool   `json:"autostart"`
+	// BLE is always false, the agent can talk only to the boards connected to the serial ports
+	BLE bool `json:"ble"`
+}
+
 func infoHandler(c *gin.Context) {
 	host := c.Request.Host
 	parts := strings.Split(host, ":")
 	host = parts[0]
 
+	httpPort, httpsPort := agentPorts.get()
+	c.JSON(200, AgentInfo{
+		Version:   version,
+		Commit:    commit,
+		HTTP:      "http://" + host + port,
+		HTTPS:     "https://localhost" + portSSL,
+		WS:        "ws://" + host + port,
+		WSS:       "wss://localhost" + portSSL,
+		HTTPPort:  httpPort,
+		HTTPSPort: httpsPort,
+		Origins:   origins.Load(),
+		UpdateURL: updateURL.Load(),
+		OS:        runtime.GOOS + ":" + runtime.GOARCH,
+		OSName:    runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Autostart: autostartEnabled(),
+	})
+}
+
+// startTime is the time when the agent has been started
+var startTime = time.Now()
+
+func buildInfoHandler(c *gin.Context) {
+	// the build flags, e.g. -tags and -ldflags, are embedded in the binary by the go compiler
+	buildSettings := map[string]string{}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			buildSettings[setting.Key] = setting.Value
+		}
+	}
+
+	uptime := time.Since(startTime).Round(time.Second)
+	c.JSON(200, gin.H{
+		"version":        version,
+		"commit":         commit,
+		"dev":            strings.HasSuffix(version, "-dev"),
+		"go_version":     runtime.Version(),
+		"build_settings": buildSettings,
+		"start_time":     startTime.Format(time.RFC3339),
+		"uptime":         uptime.String(),
+		"uptime_seconds": int64(uptime.Seconds()),
+	})
+}
+
+// allPortsHandler returns both the ports shown in the list and the ones hidden,
+// e.g. because they don't match the filter, with the reason why they are hidden
+func allPortsHandler(c *gin.Context) {
+	// copy the ports, they can be modified once the lock is released
+	visible := []SpPortItem{}
+	hidden := []SpHiddenPortItem{}
+	serialPorts.portsLock.Lock()
+	for _, port := range serialPorts.Ports {
+		visible = append(visible, *port)
+	}
+	for _, port := range serialPorts.hiddenPorts {
+		hidden = append(hidden, *port)
+	}
+	serialPorts.portsLock.Unlock()
+
 	c.JSON(200, gin.H{
-		"version":    version,
-		"http":       "http://" + host + port,
-		"https":      "https://localhost" + portSSL,
-		"ws":         "ws://" + host + port,
-		"wss":        "wss://localhost" + portSSL,
-		"origins":    origins,
-		"update_url": updateURL,
-		"os":         runtime.GOOS + ":" + runtime.GOARCH,
+		"filter":  portsFilterRegexp.Load(),
+		"visible": visible,
+		"hidden":  hidden,
 	})
 }
 
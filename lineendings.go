@@ -0,0 +1,65 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// lineEndings are the line endings the newlines of the data sent to a port can be translated to
+var lineEndings = map[string]string{
+	"cr":   "\r",
+	"lf":   "\n",
+	"crlf": "\r\n",
+}
+
+// parseLineEnding returns the line ending with the given name, e.g. crlf
+func parseLineEnding(name string) (string, error) {
+	ending, ok := lineEndings[strings.ToLower(name)]
+	if !ok {
+		return "", fmt.Errorf("unknown line ending %s, use cr, lf or crlf", name)
+	}
+	return ending, nil
+}
+
+// translateLineEndings replaces the newlines (LF or CRLF) of data with ending.
+// An empty ending leaves the data untouched.
+func translateLineEndings(data string, ending string) string {
+	if ending == "" {
+		return data
+	}
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	if ending == "\n" {
+		return data
+	}
+	return strings.ReplaceAll(data, "\n", ending)
+}
+
+// lineEndingsNormalizer converts the CR and CRLF line endings to LF. It keeps
+// track of a CR at the end of the data, in case the LF comes with the next read.
+type lineEndingsNormalizer struct {
+	afterCR bool
+}
+
+func (n *lineEndingsNormalizer) normalize(data string) string {
+	if n.afterCR {
+		data = strings.TrimPrefix(data, "\n")
+	}
+	n.afterCR = strings.HasSuffix(data, "\r")
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	return strings.ReplaceAll(data, "\r", "\n")
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	serial "go.bug.st/serial"
+)
+
+// LoopbackResult is the outcome of a loopback test, see spLoopbackTest
+type LoopbackResult struct {
+	Cmd       string
+	Port      string
+	Passed    bool
+	Sent      int
+	Received  int
+	Corrupted int    // the number of bytes received different from the ones sent
+	Desc      string `json:",omitempty"`
+}
+
+// loopbackPattern contains all the byte values, to catch the adapters mangling some of them
+func loopbackPattern() []byte {
+	pattern := make([]byte, 256)
+	for i := range pattern {
+		pattern[i] = byte(i)
+	}
+	return pattern
+}
+
+// runLoopbackTest writes the pattern on the port and checks that it's read back within
+// the timeout. The port is closed at the end, to stop the pending read.
+func runLoopbackTest(port io.ReadWriteCloser, pattern []byte, timeout time.Duration) LoopbackResult {
+	defer port.Close()
+	res := LoopbackResult{Cmd: "LoopbackTest", Sent: len(pattern)}
+
+	chunks := make(chan []byte)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := port.Read(buf)
+			if n > 0 {
+				select {
+				case chunks <- append([]byte{}, buf[:n]...):
+				case <-done:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	if _, err := port.Write(pattern); err != nil {
+		res.Desc = "cannot write the test pattern: " + err.Error()
+		return res
+	}
+
+	var received []byte
+	deadline := time.After(timeout)
+Loop:
+	for len(received) < len(pattern) {
+		select {
+		case chunk := <-chunks:
+			received = append(received, chunk...)
+		case <-deadline:
+			break Loop
+		}
+	}
+
+	res.Received = len(received)
+	firstCorrupted := -1
+	for i := 0; i < len(received) && i < len(pattern); i++ {
+		if received[i] != pattern[i] {
+			res.Corrupted++
+			if firstCorrupted < 0 {
+				firstCorrupted = i
+			}
+		}
+	}
+	switch {
+	case len(received) == 0:
+		res.Desc = "no data received, check that TX and RX are connected with a jumper"
+	case res.Corrupted > 0:
+		res.Desc = fmt.Sprintf("%d bytes corrupted, the first at offset %d", res.Corrupted, firstCorrupted)
+	case len(received) < len(pattern):
+		res.Desc = fmt.Sprintf("received only %d of %d bytes within %s", len(received), len(pattern), timeout)
+	case len(received) > len(pattern):
+		res.Desc = fmt.Sprintf("received %d unexpected bytes", len(received)-len(pattern))
+	default:
+		res.Passed = true
+	}
+	return res
+}
+
+// spLoopbackTest checks the cable and the USB-serial adapter of a port, independently from the board.
+// It REQUIRES a hardware jumper between the TX and RX pins of the adapter: the data sent must be
+// received back unchanged. The arguments are:
+// loopbacktest <portName> [baud: {115200}] [timeoutMs: {1000}]
+func spLoopbackTest(arg string) {
+	defer recoverPanic("loopbacktest")
+	args := strings.Fields(arg)
+	if len(args) < 2 {
+		spErr("You did not specify a port to test")
+		return
+	}
+	portname := args[1]
+	if _, ok := sh.FindPortByName(portname); ok {
+		spErr("The port " + portname + " is open, close it before the loopback test")
+		return
+	}
+
+	baud, timeout := 115200, 1000
+	var err error
+	if len(args) > 2 {
+		if baud, err = strconv.Atoi(args[2]); err != nil || baud <= 0 {
+			spErr("Problem converting baud to a positive number " + args[2])
+			return
+		}
+	}
+	if len(args) > 3 {
+		if timeout, err = strconv.Atoi(args[3]); err != nil || timeout <= 0 {
+			spErr("Problem converting timeoutMs to a positive number " + args[3])
+			return
+		}
+	}
+
+	var port io.ReadWriteCloser
+	if isVirtualPort(portname) {
+		port = newVirtualSerialPort()
+	} else if port, err = serial.Open(portname, &serial.Mode{BaudRate: baud}); err != nil {
+		spErr("Cannot open the port " + portname + " for the loopback test: " + err.Error())
+		return
+	}
+	res := runLoopbackTest(port, loopbackPattern(), time.Duration(timeout)*time.Millisecond)
+	res.Port = portname
+	msg, _ := json.Marshal(res)
+	h.broadcastSys <- msg
+}
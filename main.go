@@ -21,15 +21,18 @@ package main
 import (
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"html/template"
 	"io"
+	"net"
+	"net/http"
 	"os"
 	"regexp"
 	"runtime"
-	"runtime/debug"
 	"strconv"
-	"strings"
+	"sync/atomic"
 	"time"
 
 	cert "github.com/arduino/arduino-create-agent/certificates"
@@ -39,6 +42,7 @@ import (
 	"github.com/arduino/arduino-create-agent/systray"
 	"github.com/arduino/arduino-create-agent/tools"
 	"github.com/arduino/arduino-create-agent/updater"
+	"github.com/arduino/arduino-create-agent/upload"
 	"github.com/arduino/arduino-create-agent/utilities"
 	v2 "github.com/arduino/arduino-create-agent/v2"
 	paths "github.com/arduino/go-paths-helper"
@@ -56,41 +60,78 @@ var (
 	portSSL string
 )
 
+// the default range of the ports where to listen, the clients look for the agent there
+const (
+	defaultPortStart = 8991
+	defaultPortEnd   = 9000
+)
+
 // regular flags
 var (
 	hibernate        = flag.Bool("hibernate", false, "start hibernated")
 	genCert          = flag.Bool("generateCert", false, "")
-	additionalConfig = flag.String("additional-config", "config.ini", "config file path")
+	migrate          = flag.Bool("migrate", false, "copy the config and the certificates of the old agent versions to the new locations and exit")
+	additionalConfig = flag.String("additional-config", "config.ini", "config file path, or a comma separated list of paths: the later files override the earlier ones")
 	isLaunchSelf     = flag.Bool("ls", false, "launch self 5 seconds later")
+	service          = flag.Bool("service", false, "run without the systray icon, e.g. as a systemd or launchd service. SIGTERM and SIGINT stop the agent, SIGHUP reloads the config")
+	logFile          = flag.String("logfile", "", "path of a file where to write the log, besides the standard output, e.g. when running as a service")
 
 	// Ignored flags for compatibility
 	_ = flag.String("gc", "std", "Deprecated. Use the config.ini file")
 	_ = flag.String("regex", "usb|acm|com", "Deprecated. Use the config.ini file")
 )
 
-// iniflags
+// iniflags, the reloadable ones are changed when the config is reloaded, see configreload.go
 var (
+	allowedCommands   = reloadableString("allowedCommands", "", "comma separated list of the websocket commands allowed, e.g. list,open,close,send. Empty to allow all of them")
+	deniedCommands    = reloadableString("deniedCommands", "", "comma separated list of the websocket commands not allowed, e.g. sendraw,killupload")
+	adminToken        = reloadableString("adminToken", "", "token to send as bearer in the Authorization header to change the settings of the agent at runtime, e.g. the trusted origins, to read, export or import its config, to download the recordings of the serial data, to cancel the downloads of the tools, to reset the upload history and to trust the certificate. Empty to disable them")
 	address           = iniConf.String("address", "127.0.0.1", "The address where to listen. Defaults to localhost")
-	appName           = iniConf.String("appName", "", "")
-	gcType            = iniConf.String("gc", "std", "Type of garbage collection. std = Normal garbage collection allowing system to decide (this has been known to cause a stop the world in the middle of a CNC job which can cause lost responses from the CNC controller and thus stalled jobs. use max instead to solve.), off = let memory grow unbounded (you have to send in the gc command manually to garbage collect or you will run out of RAM eventually), max = Force garbage collection on each recv or send on a serial port (this minimizes stop the world events and thus lost serial responses, but increases CPU usage)")
-	hostname          = iniConf.String("hostname", "unknown-hostname", "Override the hostname we get from the OS")
+	appName           = reloadableString("appName", "", "")
+	allowCmdOverride  = reloadableString("allowCommandlineOverride", "off", "allow the upload requests to override the commandline of the upload tool: off, signed (only if the override is signed) or on")
+	cmdOverridesFile  = reloadableString("commandlineOverrides", "", "path of a json file mapping the FQBN of the boards to the commandline of the upload tool to use instead of the one from the index. It's read at startup and when the config is reloaded")
+	downloadRetries   = iniConf.Int("downloadRetries", 3, "number of times a failed download of the index or of a tool is retried, waiting longer after each attempt. The downloads of the tools are resumed from where they stopped if the server supports it")
+	duplicateConns    = reloadableString("duplicateConnections", "allow", "what to do when a new websocket connection comes from an origin already connected: allow (default), takeover (the old connection is closed) or reject (the new connection is closed)")
+	gcType            = reloadableString("gc", "std", "Type of garbage collection. std = Normal garbage collection allowing system to decide (this has been known to cause a stop the world in the middle of a CNC job which can cause lost responses from the CNC controller and thus stalled jobs. use max instead to solve.), off = let memory grow unbounded (you have to send in the gc command manually to garbage collect or you will run out of RAM eventually), max = Force garbage collection on the recv and send on a serial port, at most every 100ms (this minimizes stop the world events and thus lost serial responses, but increases CPU usage)")
+	historySize       = iniConf.Int("historySize", 100, "number of system messages kept to be replayed to the clients reconnecting with the since parameter, 0 to disable")
+	hostname          = reloadableString("hostname", "unknown-hostname", "Override the hostname we get from the OS")
+	http2             = iniConf.Bool("http2", true, "serve the HTTPS requests over HTTP/2 when the browser supports it. The websockets always use HTTP/1.1")
 	httpProxy         = iniConf.String("httpProxy", "", "Proxy server for HTTP requests")
 	httpsProxy        = iniConf.String("httpsProxy", "", "Proxy server for HTTPS requests")
-	indexURL          = iniConf.String("indexURL", "https://downloads.arduino.cc/packages/package_index.json", "The address from where to download the index json containing the location of upload tools")
+	hubQueueSize      = iniConf.Int("hubQueueSize", defaultQueueSize, "capacity of the queues of the messages broadcast to the clients, when full the oldest messages are dropped (see /stats/hub)")
+	indexTimeout      = iniConf.Int("indexTimeout", 30, "seconds to wait for the index download at startup before using the one downloaded previously. The download continues in the background, and without a previous index the agent starts anyway and it's ready (see /ready) once the download succeeds")
+	indexURL          = iniConf.String("indexURL", "https://downloads.arduino.cc/packages/package_index.json", "The address from where to download the index json containing the location of upload tools. It can be a comma separated list of addresses, the tools of the later indexes override the ones with the same name and version of the earlier indexes. Every index must be signed, unless it's listed in unsignedIndexes. The additional indexes failing to download are skipped")
 	iniConf           = flag.NewFlagSet("ini", flag.ContinueOnError)
 	logDump           = iniConf.String("log", "off", "off = (default)")
-	origins           = iniConf.String("origins", "", "Allowed origin list for CORS")
-	portsFilterRegexp = iniConf.String("regex", "usb|acm|com", "Regular expression to filter serial port list")
-	signatureKey      = iniConf.String("signatureKey", globals.ArduinoSignaturePubKey, "Pem-encoded public key to verify signed commandlines")
-	updateURL         = iniConf.String("updateUrl", "", "")
-	verbose           = iniConf.Bool("v", true, "show debug logging")
+	origins           = reloadableString("origins", "", "Allowed origin list for CORS")
+	portStart         = iniConf.Int("portStart", defaultPortStart, "first port where to listen for the HTTP and HTTPS requests, the following ones up to portEnd are tried if it's busy. The localhost origins of the range are trusted for CORS")
+	portEnd           = iniConf.Int("portEnd", defaultPortEnd, "last port where to listen for the HTTP and HTTPS requests")
+	portsFilterRegexp = reloadableString("regex", "usb|acm|com", "Regular expression to filter serial port list")
+	requireSignature  = reloadableBool("requireSignature", false, "reject the unsigned commandlines: the uploads to the network boards must be signed too, and the commandline overrides must be signed even if allowCommandlineOverride is on")
+	reopenOnReset     = reloadableBool("reopenOnReset", false, "reopen a port with the same settings when its board resets unexpectedly (the port disappears and reappears within a few seconds), see the BoardReset event")
+	serialBufferSize  = reloadableInt("serialBufferSize", defaultSerialBufferSize, "bytes read at once from a serial port, between 64 and 1048576. Increase it for the boards sending a lot of data, e.g. at 1 Mbaud")
+	signatureKey      = iniConf.String("signatureKey", globals.ArduinoSignaturePubKey, "Pem-encoded public key to verify signed commandlines. It can be a comma separated list of keys, e.g. to rotate them: a commandline is valid if any key verifies it")
+	strictOrigins     = reloadableBool("strictOrigins", false, "allow only the origins of the origins setting, instead of adding the Arduino Cloud and the local ones. The requests and the websocket connections from the other origins are rejected")
+	toolsMirror       = iniConf.String("toolsMirror", "", "Base URL of a mirror of the tools downloads, the tools are downloaded from the official URL if they are not available on the mirror")
+	mirrorUnsigned    = iniConf.Bool("toolsMirrorUnsigned", false, "don't verify the signatures of the tools downloaded from the toolsMirror, for the mirrors not providing them. The tools downloaded from the official URL are always verified, unless toolsSignatures is false")
+	toolsSignatures   = iniConf.Bool("toolsSignatures", true, "verify the signatures of the tools hosted on downloads.arduino.cc before installing them. If false only the checksums of the signed index are verified, like for the tools hosted elsewhere")
+	unsignedIndexes   = iniConf.String("unsignedIndexes", "", "comma separated list of the additional indexes of indexURL whose signature is not verified, e.g. the third-party ones not signed by Arduino. Their tools are verified only with the checksum of the index, so they can't provide the packages of the signed indexes, e.g. arduino")
+	updateURL         = reloadableString("updateUrl", "", "")
+	uploadPriority    = reloadableString("uploadPriority", upload.PriorityNormal, "priority of the upload tools: normal, high or realtime. The higher ones help the uploads on busy machines, but need the privileges to raise the priority (e.g. nice on Linux and macOS)")
+	virtualPort       = iniConf.Bool("virtualPort", false, "add a virtual board to the list of ports, named virtual, that echoes the data sent to it and accepts any upload. Useful to develop and test the clients without a real board")
+	wsReadTimeout     = reloadableInt("wsReadTimeout", 60, "seconds without pings after which a websocket client is disconnected, 0 to use the default of 60 seconds")
+	wsWriteTimeout    = reloadableInt("wsWriteTimeout", 60, "seconds a websocket client has to receive a message before being disconnected, 0 to wait forever")
+	verbose           = reloadableBool("v", true, "show debug logging")
 	crashreport       = iniConf.Bool("crashreport", false, "enable crashreport logging")
 	autostartMacOS    = iniConf.Bool("autostartMacOS", true, "the Arduino Create Agent is able to start automatically after login on macOS (launchd agent)")
 	installCerts      = iniConf.Bool("installCerts", false, "install the HTTPS certificate for Safari and keep it updated")
+	maxBodySize       = iniConf.Int64("maxBodySize", 64, "Maximum size, in MB, of the body of the requests (e.g. the sketch sent to /upload)")
+	groupPorts        = reloadableBool("groupPorts", false, "group the ports sharing the same USB serial number, reporting them as a single board in the list of ports. If the port of an upload is gone, another port of the same board is used and the PortChanged status is sent")
+	startupDelay      = iniConf.Int("startupDelay", 0, "seconds to wait before initializing the agent, useful when other services are slow to start at boot")
 )
 
 // the ports filter provided by the user via the -regex flag, if any
-var portsFilter *regexp.Regexp
+var portsFilter atomic.Pointer[regexp.Regexp]
 
 var homeTemplate = template.Must(template.New("home").Parse(homeTemplateHTML))
 
@@ -100,6 +141,11 @@ var homeTemplate = template.Must(template.New("home").Parse(homeTemplateHTML))
 //go:embed home.html
 var homeTemplateHTML string
 
+// openAPIDocument describes the v2 API, it's generated by goa together with the handlers
+//
+//go:embed gen/http/openapi3.json
+var openAPIDocument []byte
+
 // global clients
 var (
 	Tools   *tools.Tools
@@ -116,6 +162,13 @@ func (u *logWriter) Write(p []byte) (n int, err error) {
 
 var loggerWs logWriter
 
+// logOutput is where the log is written when the websocket logging is off: the standard
+// output, and the file of the logfile flag if set
+var logOutput io.Writer = os.Stdout
+
+// agentLogFile is the file of the logfile flag, it's synced before quitting
+var agentLogFile *os.File
+
 func homeHandler(c *gin.Context) {
 	homeTemplate.Execute(c.Writer, c.Request.Host)
 }
@@ -138,8 +191,23 @@ func main() {
 		cert.GenerateCertificates(config.GetCertificatesDir())
 		os.Exit(0)
 	}
-	// Check if certificates made with Agent <=1.2.7 needs to be moved over the new location
-	cert.MigrateCertificatesGeneratedWithOldAgentVersions(config.GetCertificatesDir())
+	// Check if the config and the certificates of the old agent versions needs to be moved over the new locations
+	migrations, err := config.MigrateLegacy(config.LegacyDirs(), config.GetDefaultConfigDir(), config.GetCertificatesDir())
+	for _, m := range migrations {
+		log.Infof("migrated %s", m)
+	}
+	if err != nil {
+		log.Errorf("cannot migrate the files of the old agent: %s", err)
+	}
+	if *migrate {
+		for _, m := range migrations {
+			fmt.Println(m)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 
 	// Launch main loop in a goroutine
 	go loop()
@@ -154,6 +222,9 @@ func main() {
 		},
 		AdditionalConfig: *additionalConfig,
 		ConfigDir:        configDir,
+		Headless:         *service,
+		OnQuit:           shutdown,
+		OnReload:         reloadConfig,
 	}
 
 	if src, err := os.Executable(); err != nil {
@@ -171,7 +242,15 @@ func loop() {
 	}
 
 	log.SetLevel(log.InfoLevel)
-	log.SetOutput(os.Stdout)
+	if *logFile != "" {
+		if f, err := os.OpenFile(*logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+			log.Errorf("cannot open the log file: %s", err)
+		} else {
+			agentLogFile = f
+			logOutput = io.MultiWriter(os.Stdout, f)
+		}
+	}
+	log.SetOutput(logOutput)
 
 	// We used to install the agent in $HOME/Applications before versions <= 1.2.7-ventura
 	// With version > 1.3.0 we changed the install path of the agent in /Applications.
@@ -192,6 +271,24 @@ func loop() {
 	configDir := config.GetDefaultConfigDir()
 	var configPath *paths.Path
 
+	// on locked-down systems the config dir could be read-only: in that case we keep running
+	// using the default config, without the possibility to save changes to it
+	readOnlyConfig := false
+	if err := config.CheckWritable(configDir); err != nil {
+		readOnlyConfig = true
+		log.Errorf("the config directory %s is not writable (%s). Please check its permissions: the agent will run with the default configuration and any change to it will not be saved", configDir, err)
+	}
+	dataDir, err := config.GetDataDir()
+	if dataDir == nil {
+		log.Fatalf("cannot find the data directory: %s", err)
+	}
+	if err == nil {
+		err = config.CheckWritable(dataDir)
+	}
+	if err != nil {
+		log.Errorf("the data directory %s is not writable (%s). Please check its permissions: downloading tools, certificates and logs will fail", dataDir, err)
+	}
+
 	// see if the env var is defined, if it is take the config from there, this will override the default path
 	if envConfig := os.Getenv("ARDUINO_CREATE_AGENT_CONFIG"); envConfig != "" {
 		configPath = paths.New(envConfig)
@@ -203,27 +300,14 @@ func loop() {
 		// by default take the config from the ~/.arduino-create/config.ini file
 		configPath = defaultConfigPath
 		log.Infof("using config from default: %s", configPath)
-	} else {
-		// Fall back to the old config.ini location
-		src, _ := os.Executable()
-		oldConfigPath := paths.New(src).Parent().Join("config.ini")
-		if oldConfigPath.Exist() {
-			err := oldConfigPath.CopyTo(defaultConfigPath)
-			if err != nil {
-				log.Errorf("cannot copy old %s, to %s, generating new config", oldConfigPath, configPath)
-			} else {
-				configPath = defaultConfigPath
-				log.Infof("copied old %s, to %s", oldConfigPath, configPath)
-			}
-		}
 	}
-	if configPath == nil {
+	if configPath == nil && !readOnlyConfig {
 		configPath = config.GenerateConfig(configDir)
 	}
 
 	// if the default browser is Safari, prompt the user to install HTTPS certificates
 	// and eventually install them
-	if runtime.GOOS == "darwin" {
+	if runtime.GOOS == "darwin" && configPath != nil {
 		if exist, err := installCertsKeyExists(configPath.String()); err != nil {
 			log.Panicf("config.ini cannot be parsed: %s", err)
 		} else if !exist {
@@ -250,45 +334,63 @@ func loop() {
 	}
 
 	// Parse the config.ini
-	args, err := parseIni(configPath.String())
-	if err != nil {
-		log.Panicf("config.ini cannot be parsed: %s", err)
+	if configPath != nil {
+		Systray.SetCurrentConfigFile(configPath)
+	} else {
+		log.Info("using the default config in read-only mode")
 	}
-	err = iniConf.Parse(args)
+	sources, err := readConfig(iniConf, configPath)
 	if err != nil {
-		log.Panicf("cannot parse arguments: %s", err)
+		log.Panic(err)
 	}
-	Systray.SetCurrentConfigFile(configPath)
+	setConfigSources(sources)
 
-	// Parse additional ini config if defined
-	if len(*additionalConfig) > 0 {
-		additionalConfigPath := paths.New(*additionalConfig)
-		if additionalConfigPath.NotExist() {
-			log.Infof("additional config file not found in %s", additionalConfigPath.String())
-		} else {
-			args, err = parseIni(additionalConfigPath.String())
-			if err != nil {
-				log.Panicf("additional config cannot be parsed: %s", err)
-			}
-			err = iniConf.Parse(args)
-			if err != nil {
-				log.Panicf("cannot parse arguments: %s", err)
-			}
-			log.Infof("using additional config from %s", additionalConfigPath.String())
-		}
-	}
+	// the queues must be resized before any message is sent to the hub
+	h.setQueueSize(*hubQueueSize)
 
 	if signatureKey == nil || len(*signatureKey) == 0 {
 		log.Panicf("signature public key should be set")
 	}
-	signaturePubKey, err := utilities.ParseRsaPublicKey([]byte(*signatureKey))
+	signaturePubKeys, err := utilities.ParseRsaPublicKeys([]byte(*signatureKey))
 	if err != nil {
 		log.Panicf("cannot parse signature key '%s'. %s", *signatureKey, err)
 	}
 
+	// The agent is ready only when all the subsystems are initialized
+	agentReadiness.reset(dataDir)
+	agentPorts.reset(dataDir)
+
+	// remove the files left by the uploads interrupted by a crash
+	removeOrphanedUploadDirs(orphanedUploadDirAge)
+
+	if *startupDelay > 0 {
+		log.Infof("waiting %d seconds before starting", *startupDelay)
+		time.Sleep(time.Duration(*startupDelay) * time.Second)
+	}
+
 	// Instantiate Index and Tools
-	Index = index.Init(*indexURL, config.GetDataDir())
-	Tools = tools.New(config.GetDataDir(), Index, logger, signaturePubKey)
+	*downloadRetries = max(*downloadRetries, 0)
+	Index = index.New(*indexURL, dataDir)
+	Index.Retries = *downloadRetries
+	if err := Index.SetUnsigned(*unsignedIndexes); err != nil {
+		log.Error(err)
+	}
+	indexLogger := func(msg string) {
+		log.Info(msg)
+		logger(msg)
+	}
+	if err := Index.Load(time.Duration(*indexTimeout)*time.Second, indexLogger); err != nil {
+		log.Errorf("cannot download the index, the tools can't be installed until it's downloaded: %s", err)
+	}
+	Tools = tools.New(dataDir, Index, logger, signaturePubKeys)
+	Tools.SetMirror(*toolsMirror)
+	Tools.SetMirrorUnsigned(*mirrorUnsigned)
+	Tools.SetVerifySignatures(*toolsSignatures)
+	Tools.SetRetries(*downloadRetries)
+	go func() {
+		<-Index.Loaded()
+		agentReadiness.setIndexLoaded()
+	}()
 
 	// see if we are supposed to wait 5 seconds
 	if *isLaunchSelf {
@@ -297,23 +399,13 @@ func loop() {
 
 	log.Println("Version:" + version)
 
-	// hostname
-	hn, _ := os.Hostname()
-	if *hostname == "unknown-hostname" {
-		*hostname = hn
+	if err := applyConfig(); err != nil {
+		log.Panic(err)
 	}
-	log.Println("Hostname:", *hostname)
-
-	// turn off garbage collection
-	// this is dangerous, as u could overflow memory
-	//if *isGC {
-	if *gcType == "std" {
-		log.Println("Garbage collection is on using Standard mode, meaning we just let Golang determine when to garbage collect.")
-	} else if *gcType == "max" {
-		log.Println("Garbage collection is on for MAXIMUM real-time collecting on each send/recv from serial port. Higher CPU, but less stopping of the world to garbage collect since it is being done on a constant basis.")
-	} else {
-		log.Println("Garbage collection is off. Memory use will grow unbounded. You WILL RUN OUT OF RAM unless you send in the gc command to manually force garbage collection. Lower CPU, but progressive memory footprint.")
-		debug.SetGCPercent(-1)
+	log.Println("Hostname:", hostname.Load())
+	if start, end, err := validPortRange(*portStart, *portEnd); err != nil {
+		log.Error(err)
+		*portStart, *portEnd = start, end
 	}
 
 	// If the httpProxy setting is set, use its value to override the
@@ -342,27 +434,15 @@ func loop() {
 		}
 	}
 
-	// see if they provided a regex filter
-	if len(*portsFilterRegexp) > 0 {
-		log.Printf("You specified a serial port regular expression filter: %v\n", *portsFilterRegexp)
-		if filter, err := regexp.Compile("(?i)" + *portsFilterRegexp); err != nil {
-			log.Panicf("Error compiling the regex filter: %v\n", err)
-		} else {
-			portsFilter = filter
-		}
-	}
-
-	if !*verbose {
-		log.Println("You can enter verbose mode to see all logging by setting the v key in the configuration file to true.")
-		log.SetOutput(io.Discard)
-	}
-
 	// save crashreport to file
 	if *crashreport {
 		logFilename := "crashreport_" + time.Now().Format("20060102150405") + ".log"
 		// handle logs directory creation
-		logsDir := config.GetLogsDir()
-		logFile, err := os.OpenFile(logsDir.Join(logFilename).String(), os.O_WRONLY|os.O_CREATE|os.O_SYNC|os.O_APPEND, 0644)
+		logsDir, err := config.GetLogsDir()
+		var logFile *os.File
+		if err == nil {
+			logFile, err = os.OpenFile(logsDir.Join(logFilename).String(), os.O_WRONLY|os.O_CREATE|os.O_SYNC|os.O_APPEND, 0644)
+		}
 		if err != nil {
 			log.Print("Cannot create file used for crash-report")
 		} else {
@@ -415,13 +495,15 @@ func loop() {
 	}
 
 	// launch the discoveries for the running system
-	go serialPorts.Run()
+	goTask(serialPorts.Run)
 	// launch the hub routine which is the singleton for the websocket server
-	go h.run()
+	h.history.size = min(*historySize, maxHistorySize)
+	goTask(h.run)
 	// launch our dummy data routine
 	//go d.run()
 
 	r := gin.New()
+	r.Use(recoveryMiddleware())
 
 	socketHandler := wsHandler().ServeHTTP
 
@@ -433,24 +515,17 @@ func loop() {
 		"https://*.app.arduino.cc",
 	}
 
-	for i := 8990; i < 9001; i++ {
-		port := strconv.Itoa(i)
-		extraOrigins = append(extraOrigins, "http://localhost:"+port)
-		extraOrigins = append(extraOrigins, "https://localhost:"+port)
-		extraOrigins = append(extraOrigins, "http://127.0.0.1:"+port)
-		extraOrigins = append(extraOrigins, "https://127.0.0.1:"+port)
-	}
+	extraOrigins = append(extraOrigins, localOrigins(*portStart, *portEnd)...)
 
-	allowOrigins := strings.Split(*origins, ",")
-	// We need to trim possible spaces from the origins, otherwise the CORS middleware
-	// validation might not work as expected
-	for i := range allowOrigins {
-		allowOrigins[i] = strings.TrimSpace(allowOrigins[i])
+	// the origins are validated by agentOrigins, so they can be changed at runtime
+	agentOrigins.reset(extraOrigins, parseOrigins(origins.Load()))
+	agentOrigins.setStrict(strictOrigins.Load())
+	if strictOrigins.Load() {
+		log.Infof("strictOrigins is set, only the origins in the origins setting are allowed: %s", origins.Load())
 	}
-	allowOrigins = append(allowOrigins, extraOrigins...)
+	setConfigLoaded(configPath)
 	r.Use(cors.New(cors.Config{
-		AllowWildcard:       true,
-		AllowOrigins:        allowOrigins,
+		AllowOriginFunc:     agentOrigins.allowed,
 		AllowMethods:        []string{"PUT", "GET", "POST", "DELETE"},
 		AllowHeaders:        []string{"Origin", "Authorization", "Content-Type"},
 		ExposeHeaders:       []string{},
@@ -459,20 +534,55 @@ func loop() {
 		AllowPrivateNetwork: true,
 	}))
 
+	r.Use(limitBodySize(*maxBodySize * 1024 * 1024))
+
 	r.LoadHTMLFiles("templates/nofirefox.html")
 
 	r.GET("/", homeHandler)
-	r.POST("/upload", uploadHandler(signaturePubKey))
+	r.POST("/upload", uploadHandler(signaturePubKeys))
+	r.POST("/uploadAndMonitor", uploadAndMonitorHandler(signaturePubKeys))
+	r.GET("/upload/status", uploadStatusHandler)
+	r.GET("/upload/readiness", uploadReadinessHandler)
+	r.GET("/upload/tools", uploadToolsHandler)
+	r.GET("/upload/history", uploadHistoryHandler)
+	r.DELETE("/upload/history", requireAdminToken, resetUploadHistoryHandler)
+	r.GET("/upload/lasterror", uploadLastErrorHandler)
 	r.GET("/socket.io/", socketHandler)
 	r.POST("/socket.io/", socketHandler)
 	r.Handle("WS", "/socket.io/", socketHandler)
 	r.Handle("WSS", "/socket.io/", socketHandler)
 	r.GET("/info", infoHandler)
+	r.GET("/info/build", buildInfoHandler)
+	r.GET("/ready", readyHandler)
+	r.GET("/capabilities", capabilitiesHandler)
+	r.GET("/config", requireAdminToken, configHandler)
+	r.GET("/config/export", requireAdminToken, exportConfigHandler)
+	r.POST("/config/import", requireAdminToken, importConfigHandler(configPath))
+	r.GET("/sessions", sessionsHandler)
+	r.GET("/boards/identify", boardIdentifyHandler)
+	r.GET("/ports", openPortsHandler)
+	r.GET("/ports/all", allPortsHandler)
+	r.GET("/discover", discoverHandler)
+	r.GET("/stats/disk", diskStatsHandler)
+	r.GET("/stats/hub", hubStatsHandler)
+	r.GET("/gc/mode", gcModeHandler)
+	r.POST("/gc/mode", requireAdminToken, setGCModeHandler)
+	r.GET("/origins", originsHandler)
+	r.POST("/origins", requireAdminToken, addOriginHandler(configPath))
+	r.DELETE("/origins", requireAdminToken, removeOriginHandler(configPath))
+	r.GET("/tools/downloads", toolDownloadsHandler)
+	r.DELETE("/tools/downloads/:id", requireAdminToken, cancelToolDownloadHandler)
+	r.GET("/recordings", requireAdminToken, recordingsHandler)
+	r.GET("/recordings/:name", requireAdminToken, recordingDownloadHandler)
 	r.POST("/pause", pauseHandler)
+	r.GET("/autostart", autostartHandler)
+	r.PUT("/autostart", requireAdminToken, setAutostartHandler(configPath))
+	r.GET("/certificate/trust", certTrustHandler)
+	r.PUT("/certificate/trust", requireAdminToken, installCertHandler(configPath))
 	r.POST("/update", updateHandler)
 
 	// Mount goa handlers
-	goa := v2.Server(config.GetDataDir().String(), Index, signaturePubKey)
+	goa := v2.Server(dataDir.String(), Index, logger, signaturePubKeys, openAPIDocument, *toolsMirror, *mirrorUnsigned, *toolsSignatures, *downloadRetries, apiSerialPorts{})
 	r.Any("/v2/*path", gin.WrapH(goa))
 
 	go func() {
@@ -483,40 +593,54 @@ func loop() {
 			return
 		}
 
-		start := 8990
-		end := 9000
-		i := start
-		for i < end {
-			i = i + 1
+		for i := *portStart; i <= *portEnd; i++ {
 			portSSL = ":" + strconv.Itoa(i)
-			if err := r.RunTLS(*address+portSSL, certsDir.Join("cert.pem").String(), certsDir.Join("key.pem").String()); err != nil {
+			listener, err := net.Listen("tcp", *address+portSSL)
+			if err != nil {
 				log.Printf("Error trying to bind to port: %v, so exiting...", err)
 				continue
-			} else {
-				log.Print("Starting server and websocket (SSL) on " + *address + "" + port)
-				break
 			}
+			log.Print("Starting server and websocket (SSL) on " + *address + "" + portSSL)
+			srv := &http.Server{Addr: *address + portSSL, Handler: r}
+			configureHTTP2(srv, *http2)
+			addServer(srv)
+			if err := agentPorts.serveTLS(srv, listener, i, certsDir.Join("cert.pem").String(), certsDir.Join("key.pem").String()); !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Error serving on port: %v", err)
+			}
+			break
 		}
 	}()
 
 	go func() {
-		start := 8990
-		end := 9000
-		i := start
-		for i < end {
-			i = i + 1
+		for i := *portStart; i <= *portEnd; i++ {
 			port = ":" + strconv.Itoa(i)
-			if err := r.Run(*address + port); err != nil {
+			listener, err := net.Listen("tcp", *address+port)
+			if err != nil {
 				log.Printf("Error trying to bind to port: %v, so exiting...", err)
 				continue
-			} else {
-				log.Print("Starting server and websocket on " + *address + "" + port)
-				break
 			}
+			log.Print("Starting server and websocket on " + *address + "" + port)
+			agentReadiness.setServerBound()
+			agentPorts.setHTTP(i)
+			srv := &http.Server{Addr: *address + port, Handler: r.Handler()}
+			addServer(srv)
+			if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Error serving on port: %v", err)
+				agentPorts.setHTTP(0)
+			}
+			break
 		}
 	}()
 }
 
+// validPortRange checks the range of the ports where to listen, returning the default one if it's not valid
+func validPortRange(start, end int) (int, int, error) {
+	if start < 1 || end > 65535 || start > end {
+		return defaultPortStart, defaultPortEnd, fmt.Errorf("invalid port range %d-%d: portStart must not be greater than portEnd and both must be between 1 and 65535, using %d-%d", start, end, defaultPortStart, defaultPortEnd)
+	}
+	return start, end, nil
+}
+
 // oldInstallExists will return true if an old installation of the agent exists (on macos) and is not the process running
 func oldInstallExists() bool {
 	oldAgentPath := config.GetDefaultHomeDir().Join("Applications", "ArduinoCreateAgent")
@@ -529,8 +653,10 @@ func oldInstallExists() bool {
 	return oldAgentPath.Join("ArduinoCreateAgent.app").Exist()
 }
 
-func parseIni(filename string) (args []string, err error) {
-	cfg, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: false, AllowPythonMultilineValues: true}, filename)
+// parseIni converts the ini config in a list of flags.
+// source can be either the name of the file or its content as []byte
+func parseIni(source interface{}) (args []string, err error) {
+	cfg, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: false, AllowPythonMultilineValues: true}, source)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,212 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/arduino/arduino-create-agent/config"
+	"github.com/arduino/go-paths-helper"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// trustedOrigins are the origins allowed by CORS. The builtin ones are always allowed, unless
+// strict is set, the custom ones come from the origins setting and can be changed at runtime.
+// The origins can contain a wildcard, e.g. https://*.arduino.cc
+type trustedOrigins struct {
+	builtin []string
+	custom  []string
+	strict  bool
+	mu      sync.RWMutex
+}
+
+// TrustedOrigins is the list of the origins allowed to use the agent.
+// When Strict is true only the custom origins are allowed.
+type TrustedOrigins struct {
+	Builtin []string `json:"builtin"`
+	Custom  []string `json:"custom"`
+	Strict  bool     `json:"strict"`
+}
+
+// OriginRequest adds or removes a custom origin, persisting the change in the config if requested
+type OriginRequest struct {
+	Origin  string `json:"origin" binding:"required"`
+	Persist bool   `json:"persist"`
+}
+
+var agentOrigins = &trustedOrigins{}
+
+// parseOrigins returns the origins in a comma separated list, without spaces and empty entries
+func parseOrigins(list string) []string {
+	origins := []string{}
+	for _, origin := range strings.Split(list, ",") {
+		// We need to trim possible spaces from the origins, otherwise the CORS
+		// validation might not work as expected
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// localOrigins returns the origins of the pages served by the agent itself on the given range of ports
+func localOrigins(start, end int) []string {
+	origins := []string{}
+	for i := start; i <= end; i++ {
+		port := strconv.Itoa(i)
+		origins = append(origins, "http://localhost:"+port, "https://localhost:"+port, "http://127.0.0.1:"+port, "https://127.0.0.1:"+port)
+	}
+	return origins
+}
+
+func (o *trustedOrigins) reset(builtin, custom []string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.builtin = builtin
+	o.custom = custom
+}
+
+// setCustom replaces the custom origins, e.g. when the config is reloaded
+func (o *trustedOrigins) setCustom(custom []string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.custom = custom
+}
+
+// setStrict allows only the custom origins, the CORS middleware rejects the requests
+// from the other origins, including the websocket upgrades
+func (o *trustedOrigins) setStrict(strict bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.strict = strict
+}
+
+// allowed is used by the CORS middleware to validate the origins
+func (o *trustedOrigins) allowed(origin string) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for _, pattern := range o.builtin {
+		if !o.strict && matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	for _, pattern := range o.custom {
+		if matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin compares the origin with a pattern, which can contain a single wildcard
+func matchOrigin(pattern, origin string) bool {
+	prefix, suffix, wildcard := strings.Cut(pattern, "*")
+	if !wildcard {
+		return pattern == origin
+	}
+	return len(origin) >= len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+}
+
+func (o *trustedOrigins) list() TrustedOrigins {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return TrustedOrigins{Builtin: slices.Clone(o.builtin), Custom: slices.Clone(o.custom), Strict: o.strict}
+}
+
+// add returns false if the origin was already trusted
+func (o *trustedOrigins) add(origin string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.strict && slices.Contains(o.builtin, origin) || slices.Contains(o.custom, origin) {
+		return false
+	}
+	o.custom = append(o.custom, origin)
+	return true
+}
+
+// remove returns false if the origin is not a custom one
+func (o *trustedOrigins) remove(origin string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	i := slices.Index(o.custom, origin)
+	if i < 0 {
+		return false
+	}
+	o.custom = slices.Delete(o.custom, i, i+1)
+	return true
+}
+
+// requireAdminToken allows the request only if it carries the adminToken as bearer token.
+// The requests are always refused if the adminToken is not set.
+func requireAdminToken(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	admin := adminToken.Load()
+	if admin == "" || !ok || subtle.ConstantTimeCompare([]byte(token), []byte(admin)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "a valid admin token is required"})
+	}
+}
+
+func originsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, agentOrigins.list())
+}
+
+func addOriginHandler(configPath *paths.Path) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		var data OriginRequest
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if agentOrigins.add(strings.TrimSpace(data.Origin)) {
+			log.Infof("added the trusted origin %s", data.Origin)
+		}
+		persistOrigins(configPath, data.Persist)
+		c.JSON(http.StatusOK, agentOrigins.list())
+	}
+}
+
+func removeOriginHandler(configPath *paths.Path) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		var data OriginRequest
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !agentOrigins.remove(strings.TrimSpace(data.Origin)) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "origin " + data.Origin + " is not a custom origin"})
+			return
+		}
+		log.Infof("removed the trusted origin %s", data.Origin)
+		persistOrigins(configPath, data.Persist)
+		c.JSON(http.StatusOK, agentOrigins.list())
+	}
+}
+
+// persistOrigins saves the custom origins in the config, so they're kept after a restart
+func persistOrigins(configPath *paths.Path, persist bool) {
+	if !persist || configPath == nil {
+		return
+	}
+	if err := config.SetOriginsIni(configPath.String(), strings.Join(agentOrigins.list().Custom, ",")); err != nil {
+		log.Errorf("cannot set origins value in config.ini: %s", err)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/arduino/go-paths-helper"
+	log "github.com/sirupsen/logrus"
+)
+
+// boundPorts keeps the ports the servers are bound to in the ports.json file of the data dir,
+// so that the local clients can read them instead of scanning the range of ports (portStart-portEnd)
+type boundPorts struct {
+	http  int
+	https int
+	file  *paths.Path
+	mu    sync.Mutex
+}
+
+// portsFileContent is the content of the ports.json file
+type portsFileContent struct {
+	HTTP  int `json:"http,omitempty"`
+	HTTPS int `json:"https,omitempty"`
+	PID   int `json:"pid"`
+}
+
+var agentPorts boundPorts
+
+// reset removes the ports file left by a previous run
+func (p *boundPorts) reset(dataDir *paths.Path) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.http, p.https = 0, 0
+	p.file = dataDir.Join("ports.json")
+	p.removeFile()
+}
+
+func (p *boundPorts) setHTTP(port int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.http = port
+	p.update()
+}
+
+func (p *boundPorts) setHTTPS(port int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.https = port
+	p.update()
+}
+
+// serveTLS serves the HTTPS requests of srv on the listener bound to port. The port is
+// recorded only once the certificate is loaded and the server is serving, and it's
+// cleared if the server stops because of an error.
+func (p *boundPorts) serveTLS(srv *http.Server, listener net.Listener, port int, certFile, keyFile string) error {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	if srv.TLSConfig == nil {
+		srv.TLSConfig = &tls.Config{}
+	}
+	srv.TLSConfig.Certificates = []tls.Certificate{certificate}
+	p.setHTTPS(port)
+	err = srv.ServeTLS(listener, "", "")
+	if !errors.Is(err, http.ErrServerClosed) {
+		p.setHTTPS(0)
+	}
+	return err
+}
+
+// get returns the ports the servers are bound to, 0 if not bound
+func (p *boundPorts) get() (http, https int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.http, p.https
+}
+
+// remove deletes the ports file when the agent quits. The file is kept if it has been
+// already overwritten by another instance, e.g. the one started by a restart.
+func (p *boundPorts) remove() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.file == nil {
+		return
+	}
+	var content portsFileContent
+	if data, err := p.file.ReadFile(); err == nil && json.Unmarshal(data, &content) == nil && content.PID != os.Getpid() {
+		return
+	}
+	p.removeFile()
+}
+
+func (p *boundPorts) removeFile() {
+	if p.file == nil {
+		return
+	}
+	if err := p.file.RemoveAll(); err != nil {
+		log.Errorf("cannot remove %s: %s", p.file, err)
+	}
+}
+
+// update writes the ports file, it must be called with the lock held
+func (p *boundPorts) update() {
+	if p.file == nil {
+		return
+	}
+	data, _ := json.Marshal(portsFileContent{HTTP: p.http, HTTPS: p.https, PID: os.Getpid()})
+	if err := p.file.WriteFile(data); err != nil {
+		log.Errorf("cannot write %s: %s", p.file, err)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// throughputWindow is the time window used to compute the instantaneous throughput
+const throughputWindow = time.Second
+
+// PortStats are the transfer statistics of an open port
+type PortStats struct {
+	Port             string
+	OpenSince        time.Time
+	OpenDuration     string
+	BytesSent        int64
+	BytesReceived    int64
+	MessagesSent     int64
+	MessagesReceived int64
+	Errors           int64
+	SendRate         float64 // bytes per second sent in the last window
+	ReceiveRate      float64 // bytes per second received in the last window
+}
+
+// portStats collects the transfer statistics of a port
+type portStats struct {
+	mu    sync.Mutex
+	stats PortStats
+
+	// the bytes transferred in the current window and the rates of the last complete one
+	windowStart                time.Time
+	windowSent, windowReceived int64
+	sendRate, receiveRate      float64
+}
+
+func (s *portStats) reset(portname string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = PortStats{Port: portname, OpenSince: time.Now()}
+	s.windowStart = time.Now()
+	s.windowSent, s.windowReceived = 0, 0
+	s.sendRate, s.receiveRate = 0, 0
+}
+
+// updateWindow closes the current window, if it's expired, computing its rates
+func (s *portStats) updateWindow(now time.Time) {
+	elapsed := now.Sub(s.windowStart)
+	if elapsed < throughputWindow {
+		return
+	}
+	if elapsed < 2*throughputWindow {
+		s.sendRate = float64(s.windowSent) / elapsed.Seconds()
+		s.receiveRate = float64(s.windowReceived) / elapsed.Seconds()
+	} else {
+		// nothing has been transferred in the last window
+		s.sendRate, s.receiveRate = 0, 0
+	}
+	s.windowStart = now
+	s.windowSent, s.windowReceived = 0, 0
+}
+
+func (s *portStats) addSent(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updateWindow(time.Now())
+	s.stats.BytesSent += int64(n)
+	s.stats.MessagesSent++
+	s.windowSent += int64(n)
+}
+
+func (s *portStats) addReceived(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updateWindow(time.Now())
+	s.stats.BytesReceived += int64(n)
+	s.stats.MessagesReceived++
+	s.windowReceived += int64(n)
+}
+
+func (s *portStats) addError() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Errors++
+}
+
+func (s *portStats) get() PortStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.updateWindow(now)
+	stats := s.stats
+	stats.OpenDuration = now.Sub(stats.OpenSince).Round(time.Second).String()
+	stats.SendRate = s.sendRate
+	stats.ReceiveRate = s.receiveRate
+	return stats
+}
+
+// spPortStats broadcasts the statistics of the port, or of all the open ports if no port is given.
+// The arguments are: portstats [portName] or resetstats [portName]
+func spPortStats(arg string) {
+	args := strings.Fields(arg)
+	reset := strings.ToLower(args[0]) == "resetstats"
+
+	var ports []*serport
+	if len(args) > 1 {
+		port, ok := sh.FindPortByName(args[1])
+		if !ok {
+			spErr("We could not find the serial port " + args[1] + " to get the statistics of.")
+			return
+		}
+		ports = append(ports, port)
+	} else {
+		sh.mu.Lock()
+		for port := range sh.ports {
+			ports = append(ports, port)
+		}
+		sh.mu.Unlock()
+	}
+
+	stats := []PortStats{}
+	for _, port := range ports {
+		if reset {
+			port.stats.reset(port.portConf.Name)
+		}
+		stats = append(stats, port.stats.get())
+	}
+	msg, _ := json.Marshal(map[string]interface{}{"Cmd": "PortStats", "Stats": stats})
+	h.broadcastSys <- msg
+}
+
+// OpenPort is a port opened by the agent, with its transfer statistics
+type OpenPort struct {
+	Name            string `json:"name"`
+	Baud            int    `json:"baud"`
+	BufferAlgorithm string `json:"bufferAlgorithm"`
+	// Buffering is true if there's data queued to be written on the port
+	Buffering     bool  `json:"buffering"`
+	BytesSent     int64 `json:"bytesSent"`
+	BytesReceived int64 `json:"bytesReceived"`
+}
+
+// openPortsHandler returns the ports opened by the agent, for the clients polling
+// their state instead of following the websocket messages
+func openPortsHandler(c *gin.Context) {
+	sh.mu.Lock()
+	ports := []OpenPort{}
+	for port := range sh.ports {
+		stats := port.stats.get()
+		ports = append(ports, OpenPort{
+			Name:            port.portConf.Name,
+			Baud:            port.portConf.Baud,
+			BufferAlgorithm: port.BufferType,
+			Buffering:       port.writeQueued.Load() > 0,
+			BytesSent:       stats.BytesSent,
+			BytesReceived:   stats.BytesReceived,
+		})
+	}
+	sh.mu.Unlock()
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Name < ports[j].Name })
+	c.JSON(http.StatusOK, ports)
+}
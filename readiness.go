@@ -0,0 +1,91 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/arduino/go-paths-helper"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// readiness keeps track of the subsystems that must be initialized before
+// the agent is able to serve requests. When all of them are ready the "ready"
+// file is created in the data dir, so that supervisors can wait for it.
+type readiness struct {
+	indexLoaded bool
+	serverBound bool
+	file        *paths.Path
+	mu          sync.Mutex
+}
+
+var agentReadiness readiness
+
+// reset removes the ready file left by a previous run
+func (r *readiness) reset(dataDir *paths.Path) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.file = dataDir.Join("ready")
+	if err := r.file.RemoveAll(); err != nil {
+		log.Errorf("cannot remove %s: %s", r.file, err)
+	}
+}
+
+func (r *readiness) setIndexLoaded() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.indexLoaded = true
+	r.update()
+}
+
+func (r *readiness) setServerBound() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.serverBound = true
+	r.update()
+}
+
+func (r *readiness) isReady() bool {
+	return r.indexLoaded && r.serverBound
+}
+
+// update writes the ready file as soon as everything is ready, it must be called with the lock held
+func (r *readiness) update() {
+	if !r.isReady() || r.file == nil {
+		return
+	}
+	log.Info("the agent is ready")
+	if err := r.file.WriteFile([]byte("ready")); err != nil {
+		log.Errorf("cannot write %s: %s", r.file, err)
+	}
+}
+
+func readyHandler(c *gin.Context) {
+	agentReadiness.mu.Lock()
+	defer agentReadiness.mu.Unlock()
+
+	status := http.StatusOK
+	if !agentReadiness.isReady() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{
+		"ready":        agentReadiness.isReady(),
+		"index_loaded": agentReadiness.indexLoaded,
+		"server_bound": agentReadiness.serverBound,
+	})
+}
@@ -0,0 +1,278 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arduino/arduino-create-agent/config"
+	"github.com/arduino/arduino-create-agent/utilities"
+	"github.com/arduino/go-paths-helper"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxRecordingSize is the size after which a recording is stopped
+	maxRecordingSize = 10 * 1024 * 1024
+	// maxRecordings is the number of recordings kept, the oldest ones are removed
+	maxRecordings = 10
+)
+
+// recorder saves the data flowing through a serial port in a capture file.
+// Every chunk of data is written on its own line with the time, the direction
+// (RX for received, TX for sent) and the quoted data, e.g.:
+//
+//	2024-01-02T15:04:05.123456Z RX "Hello\r\n"
+type recorder struct {
+	name     string
+	file     *os.File
+	size     int64
+	withSent bool
+	mu       sync.Mutex
+}
+
+// activeRecordings are the names of the recordings still being written,
+// they are never removed by removeOldRecordings
+var activeRecordings = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: map[string]bool{}}
+
+func setRecordingActive(name string, active bool) {
+	activeRecordings.Lock()
+	defer activeRecordings.Unlock()
+	if active {
+		activeRecordings.names[name] = true
+	} else {
+		delete(activeRecordings.names, name)
+	}
+}
+
+func isRecordingActive(name string) bool {
+	activeRecordings.Lock()
+	defer activeRecordings.Unlock()
+	return activeRecordings.names[name]
+}
+
+// Recording is a capture file of a serial session
+type Recording struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+func getRecordingsDir() (*paths.Path, error) {
+	logsDir, err := config.GetLogsDir()
+	if err != nil {
+		return nil, err
+	}
+	return logsDir.Join("recordings"), nil
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+func newRecorder(portname string, withSent bool) (*recorder, error) {
+	dir, err := getRecordingsDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := dir.MkdirAll(); err != nil {
+		return nil, err
+	}
+	name := "recording_" + unsafeFileNameChars.ReplaceAllString(filepath.Base(portname), "_") + "_" + time.Now().Format("20060102150405") + ".log"
+	file, err := os.Create(dir.Join(name).String())
+	if err != nil {
+		return nil, err
+	}
+	setRecordingActive(name, true)
+	removeOldRecordings()
+	return &recorder{name: name, file: file, withSent: withSent}, nil
+}
+
+// write saves the data in the capture file. It returns false if the recording
+// has been stopped because it reached the maximum size.
+func (r *recorder) write(direction string, data []byte) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return false
+	}
+	if direction == "TX" && !r.withSent {
+		return true
+	}
+	line := time.Now().UTC().Format(time.RFC3339Nano) + " " + direction + " " + strconv.Quote(string(data)) + "\n"
+	if r.size+int64(len(line)) > maxRecordingSize {
+		r.closeFile()
+		return false
+	}
+	n, err := r.file.WriteString(line)
+	r.size += int64(n)
+	if err != nil {
+		log.Errorf("cannot write recording: %s", err)
+	}
+	return true
+}
+
+func (r *recorder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeFile()
+}
+
+// closeFile must be called with the lock held
+func (r *recorder) closeFile() {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+		setRecordingActive(r.name, false)
+	}
+}
+
+// record saves the data in the recording of the port, if any
+func (p *serport) record(direction string, data []byte) {
+	rec := p.recorder.Load()
+	if rec == nil {
+		return
+	}
+	if !rec.write(direction, data) {
+		p.recorder.CompareAndSwap(rec, nil)
+		h.broadcastSys <- []byte("{\"Cmd\":\"RecordStop\",\"Port\":\"" + p.portConf.Name + "\",\"Desc\":\"Recording reached the maximum size\"}")
+	}
+}
+
+func (p *serport) stopRecording() {
+	if rec := p.recorder.Swap(nil); rec != nil {
+		rec.close()
+	}
+}
+
+// removeOldRecordings keeps only the newest recordings, the ones still being written are never removed
+func removeOldRecordings() {
+	dir, err := getRecordingsDir()
+	if err != nil {
+		return
+	}
+	recordings, err := listRecordings()
+	if err != nil || len(recordings) <= maxRecordings {
+		return
+	}
+	for _, rec := range recordings[maxRecordings:] {
+		if isRecordingActive(rec.Name) {
+			continue
+		}
+		if err := dir.Join(rec.Name).Remove(); err != nil {
+			log.Errorf("cannot remove old recording: %s", err)
+		}
+	}
+}
+
+// listRecordings returns the recordings, newest first
+func listRecordings() ([]Recording, error) {
+	dir, err := getRecordingsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir.String())
+	if os.IsNotExist(err) {
+		return []Recording{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	recordings := []Recording{}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() {
+			continue
+		}
+		recordings = append(recordings, Recording{Name: entry.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].ModTime.After(recordings[j].ModTime)
+	})
+	return recordings, nil
+}
+
+// spRecord starts or stops the recording of a port. The arguments are:
+// recordstart <portName> [sent] or recordstop <portName>
+func spRecord(arg string) {
+	defer recoverPanic("record")
+	args := strings.Fields(arg)
+	if len(args) < 2 {
+		spErr("You did not specify a port to record")
+		return
+	}
+	portname := args[1]
+	port, ok := sh.FindPortByName(portname)
+	if !ok {
+		spErr("We could not find the serial port " + portname + " that you were trying to record.")
+		return
+	}
+
+	if strings.ToLower(args[0]) == "recordstop" {
+		port.stopRecording()
+		h.broadcastSys <- []byte("{\"Cmd\":\"RecordStop\",\"Port\":\"" + portname + "\"}")
+		return
+	}
+
+	withSent := len(args) > 2 && args[2] == "sent"
+	rec, err := newRecorder(portname, withSent)
+	if err != nil {
+		spErr("Cannot start recording: " + err.Error())
+		return
+	}
+	if old := port.recorder.Swap(rec); old != nil {
+		old.close()
+	}
+	h.broadcastSys <- []byte("{\"Cmd\":\"RecordStart\",\"Port\":\"" + portname + "\",\"File\":\"" + rec.name + "\"}")
+}
+
+func recordingsHandler(c *gin.Context) {
+	recordings, err := listRecordings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, recordings)
+}
+
+func recordingDownloadHandler(c *gin.Context) {
+	name := c.Param("name")
+	dir, err := getRecordingsDir()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	path, err := utilities.SafeJoin(dir.String(), name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if paths.New(path).NotExist() {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("recording %s not found", name)})
+		return
+	}
+	c.FileAttachment(path, name)
+}
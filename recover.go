@@ -0,0 +1,57 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// recoverPanic stops a panic in the current goroutine, so that the agent keeps running.
+// It must be deferred at the beginning of the goroutines that could panic.
+func recoverPanic(where string) {
+	if r := recover(); r != nil {
+		logPanic(where, r)
+	}
+}
+
+// logPanic logs the panic with its stack trace. When the crashreport is enabled it's
+// also written on stderr, which is redirected to the crashreport file.
+func logPanic(where string, r interface{}) {
+	msg := fmt.Sprintf("recovered from panic in %s: %v\n%s", where, r, debug.Stack())
+	log.Error(msg)
+	if *crashreport {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+}
+
+// recoveryMiddleware recovers from the panics in the handlers, answering with an internal server error
+func recoveryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				logPanic(c.Request.Method+" "+c.Request.URL.Path, r)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			}
+		}()
+		c.Next()
+	}
+}
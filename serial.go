@@ -18,6 +18,8 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"slices"
 	"strconv"
@@ -25,6 +27,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/arduino/arduino-create-agent/upload"
 	discovery "github.com/arduino/pluggable-discovery-protocol-handler/v2"
 	"github.com/sirupsen/logrus"
 )
@@ -34,20 +37,37 @@ type serialhub struct {
 	ports map[*serport]bool
 
 	mu sync.Mutex
+	// openMu is held while opening and registering a port, so that a port found
+	// closed can't be opened by another client before it's registered
+	openMu sync.Mutex
 }
 
 // SerialPortList is the serial port list
 type SerialPortList struct {
 	Ports     []*SpPortItem
+	Boards    []*SpBoardItem `json:",omitempty"`
 	portsLock sync.Mutex
+
+	// the ports not shown in the list, e.g. because they don't match the filter
+	hiddenPorts []*SpHiddenPortItem
+
+	// discover runs the discovery until it stops or the context is cancelled,
+	// it's runSerialDiscovery if nil
+	discover func(ctx context.Context)
 }
 
+// discoveryRestartDelay is the wait before restarting the serial discovery when it stops working
+var discoveryRestartDelay = 10 * time.Second
+
 // SpPortItem is the serial port item
 type SpPortItem struct {
 	Name            string
+	Type            string // always serial, see DiscoveredEndpoint
 	SerialNumber    string
 	DeviceClass     string
 	IsOpen          bool
+	Available       bool   // false if the port is open, by the agent or by another process
+	Owner           string `json:",omitempty"` // who is using the port, if known: agent or another process
 	IsPrimary       bool
 	Baud            int
 	BufferAlgorithm string
@@ -56,6 +76,25 @@ type SpPortItem struct {
 	ProductID       string
 }
 
+// SpHiddenPortItem is a serial port not shown in the list, with the reason why it's hidden
+type SpHiddenPortItem struct {
+	Name         string
+	SerialNumber string
+	VendorID     string
+	ProductID    string
+	Reason       string
+}
+
+// SpBoardItem is a board exposing more than one serial port, e.g. a composite USB device.
+// It's reported only if the ports grouping is enabled.
+type SpBoardItem struct {
+	SerialNumber string
+	VendorID     string
+	ProductID    string
+	Ports        []string
+	UploadPort   string // the port to use to upload a sketch on the board
+}
+
 // serialPorts contains the ports attached to the machine
 var serialPorts SerialPortList
 
@@ -79,8 +118,23 @@ func (sh *serialhub) Unregister(port *serport) {
 	h.broadcastSys <- []byte("{\"Cmd\":\"Close\",\"Desc\":\"Got unregister/close on port.\",\"Port\":\"" + port.portConf.Name + "\",\"Baud\":" + strconv.Itoa(port.portConf.Baud) + "}")
 	delete(sh.ports, port)
 	close(port.sendBuffered)
-	close(port.sendNoBuf)
+	// sendNoBuf is never closed, the writers could still be sending on it
+	close(port.done)
+	sh.mu.Unlock()
+}
+
+// CloseAll closes all the open ports
+func (sh *serialhub) CloseAll() {
+	sh.mu.Lock()
+	ports := make([]*serport, 0, len(sh.ports))
+	for port := range sh.ports {
+		ports = append(ports, port)
+	}
 	sh.mu.Unlock()
+
+	for _, port := range ports {
+		port.Close()
+	}
 }
 
 func (sh *serialhub) FindPortByName(portname string) (*serport, bool) {
@@ -100,6 +154,9 @@ func (sh *serialhub) FindPortByName(portname string) (*serport, bool) {
 // List broadcasts a Json representation of the ports found
 func (sp *SerialPortList) List() {
 	sp.portsLock.Lock()
+	if groupPorts.Load() {
+		sp.Boards = sp.groupPorts()
+	}
 	ls, err := json.MarshalIndent(sp, "", "\t")
 	sp.portsLock.Unlock()
 
@@ -113,17 +170,30 @@ func (sp *SerialPortList) List() {
 }
 
 // Run is the main loop for port discovery and management
-func (sp *SerialPortList) Run() {
+// It returns when ctx is cancelled.
+func (sp *SerialPortList) Run(ctx context.Context) {
+	discover := sp.discover
+	if discover == nil {
+		discover = sp.runSerialDiscovery
+	}
+	sp.reset()
 	for retries := 0; retries < 10; retries++ {
-		sp.runSerialDiscovery()
+		discover(ctx)
+		if ctx.Err() != nil {
+			return
+		}
 
-		logrus.Errorf("Serial discovery stopped working, restarting it in 10 seconds...")
-		time.Sleep(10 * time.Second)
+		logrus.Errorf("Serial discovery stopped working, restarting it in %s...", discoveryRestartDelay)
+		select {
+		case <-time.After(discoveryRestartDelay):
+		case <-ctx.Done():
+			return
+		}
 	}
 	logrus.Errorf("Failed restarting serial discovery. Giving up...")
 }
 
-func (sp *SerialPortList) runSerialDiscovery() {
+func (sp *SerialPortList) runSerialDiscovery(ctx context.Context) {
 	// First ensure that all the discoveries are available
 	if err := Tools.Download("builtin", "serial-discovery", "latest", "keep"); err != nil {
 		logrus.Errorf("Error downloading serial-discovery: %s", err)
@@ -136,7 +206,7 @@ func (sp *SerialPortList) runSerialDiscovery() {
 	}
 	d := discovery.NewClient("serial", sd+"/serial-discovery")
 	dLogger := logrus.WithField("discovery", "serial")
-	if *verbose {
+	if verbose.Load() {
 		d.SetLogger(dLogger)
 	}
 	d.SetUserAgent("arduino-create-agent/" + version)
@@ -153,24 +223,43 @@ func (sp *SerialPortList) runSerialDiscovery() {
 	}
 
 	logrus.Infof("Serial discovery started, watching for events")
-	for ev := range events {
-		logrus.WithField("event", ev).Debugf("Serial discovery event")
-		switch ev.Type {
-		case "add":
-			sp.add(ev.Port)
-		case "remove":
-			sp.remove(ev.Port)
-		}
-	}
+	sp.watch(ctx, events)
 
 	sp.reset()
-	logrus.Errorf("Serial discovery stopped.")
+	if ctx.Err() == nil {
+		logrus.Errorf("Serial discovery stopped.")
+	}
+}
+
+// watch updates the list with the events of the discovery, until they stop or ctx is cancelled
+func (sp *SerialPortList) watch(ctx context.Context, events <-chan *discovery.Event) {
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			logrus.WithField("event", ev).Debugf("Serial discovery event")
+			switch ev.Type {
+			case "add":
+				sp.add(ev.Port)
+			case "remove":
+				sp.remove(ev.Port)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
 func (sp *SerialPortList) reset() {
 	sp.portsLock.Lock()
 	defer sp.portsLock.Unlock()
 	sp.Ports = []*SpPortItem{}
+	sp.hiddenPorts = []*SpHiddenPortItem{}
+	if *virtualPort {
+		sp.Ports = append(sp.Ports, newVirtualPortItem())
+	}
 }
 
 func (sp *SerialPortList) add(addedPort *discovery.Port) {
@@ -178,15 +267,21 @@ func (sp *SerialPortList) add(addedPort *discovery.Port) {
 		return
 	}
 	props := addedPort.Properties
-	if !props.ContainsKey("vid") {
-		return
-	}
 	vid, pid := props.Get("vid"), props.Get("pid")
-	if vid == "0x0000" || pid == "0x0000" {
-		return
-	}
-	if portsFilter != nil && !portsFilter.MatchString(addedPort.Address) {
-		logrus.Debugf("ignoring port not matching filter. port: %v\n", addedPort.Address)
+	if reason := hiddenPortReason(addedPort); reason != "" {
+		logrus.Debugf("ignoring port %s: %s", addedPort.Address, reason)
+		sp.portsLock.Lock()
+		defer sp.portsLock.Unlock()
+		sp.hiddenPorts = slices.DeleteFunc(sp.hiddenPorts, func(oldPort *SpHiddenPortItem) bool {
+			return oldPort.Name == addedPort.Address
+		})
+		sp.hiddenPorts = append(sp.hiddenPorts, &SpHiddenPortItem{
+			Name:         addedPort.Address,
+			SerialNumber: props.Get("serialNumber"),
+			VendorID:     vid,
+			ProductID:    pid,
+			Reason:       reason,
+		})
 		return
 	}
 
@@ -203,17 +298,37 @@ func (sp *SerialPortList) add(addedPort *discovery.Port) {
 		}
 	}
 	// ...otherwise, add it to the list
-	sp.Ports = append(sp.Ports, &SpPortItem{
+	port := &SpPortItem{
 		Name:            addedPort.Address,
+		Type:            portTypeSerial,
 		SerialNumber:    props.Get("serialNumber"),
 		VendorID:        vid,
 		ProductID:       pid,
 		Ver:             version,
 		IsOpen:          false,
+		Available:       true,
 		IsPrimary:       false,
 		Baud:            0,
 		BufferAlgorithm: "",
-	})
+	}
+	sp.Ports = append(sp.Ports, port)
+	checkBoardReset(port)
+}
+
+// hiddenPortReason returns why the port must not be shown in the list, or an empty string if it must be shown
+func hiddenPortReason(port *discovery.Port) string {
+	props := port.Properties
+	if !props.ContainsKey("vid") {
+		return "not a USB port"
+	}
+	vid, pid := props.Get("vid"), props.Get("pid")
+	if vid == "0x0000" || pid == "0x0000" {
+		return "invalid USB VID/PID"
+	}
+	if filter := portsFilter.Load(); filter != nil && !filter.MatchString(port.Address) {
+		return "didn't match the filter " + portsFilterRegexp.Load()
+	}
+	return ""
 }
 
 func (sp *SerialPortList) remove(removedPort *discovery.Port) {
@@ -222,6 +337,13 @@ func (sp *SerialPortList) remove(removedPort *discovery.Port) {
 
 	// Remove the port from the list
 	sp.Ports = slices.DeleteFunc(sp.Ports, func(oldPort *SpPortItem) bool {
+		if oldPort.Name == removedPort.Address {
+			boardResets.portRemoved(oldPort)
+			return true
+		}
+		return false
+	})
+	sp.hiddenPorts = slices.DeleteFunc(sp.hiddenPorts, func(oldPort *SpHiddenPortItem) bool {
 		return oldPort.Name == removedPort.Address
 	})
 }
@@ -233,6 +355,8 @@ func (sp *SerialPortList) MarkPortAsOpened(portname string) {
 	port := sp.getPortByName(portname)
 	if port != nil {
 		port.IsOpen = true
+		port.Available = false
+		port.Owner = "agent"
 	}
 }
 
@@ -243,6 +367,20 @@ func (sp *SerialPortList) MarkPortAsClosed(portname string) {
 	port := sp.getPortByName(portname)
 	if port != nil {
 		port.IsOpen = false
+		port.Available = true
+		port.Owner = ""
+	}
+}
+
+// MarkPortAsBusy marks a port as opened by another process, e.g. because the agent failed to open it.
+// The port is considered available again when the agent succeeds to open it or it's reconnected.
+func (sp *SerialPortList) MarkPortAsBusy(portname string) {
+	sp.portsLock.Lock()
+	defer sp.portsLock.Unlock()
+	port := sp.getPortByName(portname)
+	if port != nil && !port.IsOpen {
+		port.Available = false
+		port.Owner = "another process"
 	}
 }
 
@@ -255,6 +393,79 @@ func (sp *SerialPortList) getPortByName(portname string) *SpPortItem {
 	return nil
 }
 
+// groupPorts groups the ports sharing the same USB serial number, they
+// belong to the same board. The port with the lowest name is the first interface
+// of the board and it's marked as primary, since it's the one used to upload.
+func (sp *SerialPortList) groupPorts() []*SpBoardItem {
+	boards := []*SpBoardItem{}
+	groups := map[string][]*SpPortItem{}
+	for _, port := range sp.Ports {
+		port.IsPrimary = false
+		if port.SerialNumber == "" {
+			continue
+		}
+		key := port.VendorID + ":" + port.ProductID + ":" + port.SerialNumber
+		groups[key] = append(groups[key], port)
+	}
+	for _, ports := range groups {
+		if len(ports) < 2 {
+			continue
+		}
+		slices.SortFunc(ports, comparePortNames)
+		ports[0].IsPrimary = true
+		board := &SpBoardItem{
+			SerialNumber: ports[0].SerialNumber,
+			VendorID:     ports[0].VendorID,
+			ProductID:    ports[0].ProductID,
+			UploadPort:   ports[0].Name,
+		}
+		for _, port := range ports {
+			board.Ports = append(board.Ports, port.Name)
+		}
+		boards = append(boards, board)
+	}
+	slices.SortFunc(boards, func(a, b *SpBoardItem) int {
+		return strings.Compare(a.UploadPort, b.UploadPort)
+	})
+	return boards
+}
+
+// GetUploadPort returns the port to use to upload on the board connected to the given port.
+// The given port is returned if it's still connected. Otherwise, if the board is
+// still connected with another port, e.g. because it has been renumbered after a
+// reset, the port of its first interface is returned.
+func (sp *SerialPortList) GetUploadPort(portname string) string {
+	sp.portsLock.Lock()
+	defer sp.portsLock.Unlock()
+	if sp.getPortByName(portname) != nil {
+		return portname
+	}
+	identity, ok := boardResets.removedIdentity(portname)
+	if !ok {
+		return portname
+	}
+	var candidates []*SpPortItem
+	for _, port := range sp.Ports {
+		if port.SerialNumber != "" && portIdentity(port) == identity {
+			candidates = append(candidates, port)
+		}
+	}
+	if len(candidates) == 0 {
+		return portname
+	}
+	slices.SortFunc(candidates, comparePortNames)
+	return candidates[0].Name
+}
+
+// comparePortNames sorts the ports by name, the shorter names first so that
+// e.g. /dev/ttyACM2 comes before /dev/ttyACM10
+func comparePortNames(a, b *SpPortItem) int {
+	if len(a.Name) != len(b.Name) {
+		return len(a.Name) - len(b.Name)
+	}
+	return strings.Compare(a.Name, b.Name)
+}
+
 func spErr(err string) {
 	//log.Println("Sending err back: ", err)
 	//h.broadcastSys <- []byte(err)
@@ -262,6 +473,7 @@ func spErr(err string) {
 }
 
 func spClose(portname string) {
+	defer recoverPanic("close")
 	if myport, ok := sh.FindPortByName(portname); ok {
 		h.broadcastSys <- []byte("Closing serial port " + portname)
 		myport.Close()
@@ -271,6 +483,7 @@ func spClose(portname string) {
 }
 
 func spWrite(arg string) {
+	defer recoverPanic("write")
 	// we will get a string of comXX asdf asdf asdf
 	//log.Println("Inside spWrite arg: " + arg)
 	arg = strings.TrimPrefix(arg, " ")
@@ -309,3 +522,111 @@ func spWrite(arg string) {
 	// send it to the write channel
 	port.Write(data, bufferingMode)
 }
+
+// SendFileProgress reports the bytes of the file sent to the port by sendfile
+type SendFileProgress struct {
+	Cmd   string
+	Port  string
+	Sent  int
+	Total int
+}
+
+// spSendFile streams the base64 encoded content to the port in chunks, waiting
+// between one chunk and the other, so that boards with small buffers are not overwhelmed
+func spSendFile(arg string) {
+	defer recoverPanic("sendfile")
+	args := strings.Fields(arg)
+	if len(args) < 3 {
+		spErr("Could not parse sendfile command: you must specify a port and the content to send")
+		return
+	}
+	portname := args[1]
+	data, err := base64.StdEncoding.DecodeString(args[2])
+	if err != nil {
+		spErr("Could not decode the content of the file: " + err.Error())
+		return
+	}
+	chunkSize := 64
+	if len(args) > 3 {
+		chunkSize, err = strconv.Atoi(args[3])
+		if err != nil || chunkSize <= 0 {
+			spErr("Invalid chunk size " + args[3])
+			return
+		}
+	}
+	chunkDelay := 10 * time.Millisecond
+	if len(args) > 4 {
+		delay, err := strconv.Atoi(args[4])
+		if err != nil || delay < 0 {
+			spErr("Invalid chunk delay " + args[4])
+			return
+		}
+		chunkDelay = time.Duration(delay) * time.Millisecond
+	}
+
+	port, ok := sh.FindPortByName(portname)
+	if !ok {
+		spErr("We could not find the serial port " + portname + " that you were trying to write to.")
+		return
+	}
+
+	for sent := 0; sent < len(data); {
+		end := min(sent+chunkSize, len(data))
+		port.writeQueued.Add(int64(end - sent))
+		// the port could be closed while we are still sending
+		if port.isClosing.Load() || !port.send(data[sent:end]) {
+			port.writeQueued.Add(-int64(end - sent))
+			spErr("The serial port " + portname + " has been closed while sending the file")
+			return
+		}
+		sent = end
+		msg, _ := json.Marshal(SendFileProgress{Cmd: "SendFile", Port: portname, Sent: sent, Total: len(data)})
+		h.broadcastSys <- msg
+		time.Sleep(chunkDelay)
+	}
+}
+
+// spTouch resets the board in bootloader mode and optionally reads the banner printed
+// by the bootloader, so that the clients can check that the board entered the bootloader.
+// The arguments are: touch <portName> [bannerTimeoutMs: {0}] [baud: {115200}]
+func spTouch(arg string) {
+	defer recoverPanic("touch")
+	args := strings.Fields(arg)
+	if len(args) < 2 {
+		spErr("You did not specify a port to touch")
+		return
+	}
+	portname := args[1]
+	if _, ok := sh.FindPortByName(portname); ok {
+		spErr("The port " + portname + " is open, close it before the touch")
+		return
+	}
+
+	bannerTimeout, baud := 0, 115200
+	var err error
+	if len(args) > 2 {
+		if bannerTimeout, err = strconv.Atoi(args[2]); err != nil || bannerTimeout < 0 {
+			spErr("Problem converting bannerTimeoutMs to a positive number " + args[2])
+			return
+		}
+	}
+	if len(args) > 3 {
+		if baud, err = strconv.Atoi(args[3]); err != nil || baud <= 0 {
+			spErr("Problem converting baud to a positive number " + args[3])
+			return
+		}
+	}
+
+	bootloaderPort, banner, err := upload.Touch(portname, baud, time.Duration(bannerTimeout)*time.Millisecond, nil)
+	if err != nil {
+		spErr("Touch failed on " + portname + ": " + err.Error())
+		return
+	}
+	msg, _ := json.Marshal(map[string]string{
+		"Cmd":            "Touch",
+		"Port":           portname,
+		"BootloaderPort": bootloaderPort,
+		"Banner":         string(banner),
+	})
+	h.broadcastSys <- msg
+}
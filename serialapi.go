@@ -0,0 +1,92 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	v2 "github.com/arduino/arduino-create-agent/v2"
+	log "github.com/sirupsen/logrus"
+	"go.bug.st/serial"
+)
+
+// apiSerialPorts opens and closes the serial ports for the v2 API,
+// like the open and close commands of the websocket, which must be allowed
+type apiSerialPorts struct{}
+
+func (apiSerialPorts) Open(portname string, baud int, buffer string) error {
+	if !commandAllowed("open") {
+		return fmt.Errorf("%w: the open command is disabled by the agent configuration", v2.ErrSerialNotAllowed)
+	}
+	if portname == "" {
+		return fmt.Errorf("%w: port is required", v2.ErrInvalidSerialRequest)
+	}
+	if baud <= 0 {
+		return fmt.Errorf("%w: invalid baud rate %d", v2.ErrInvalidSerialRequest, baud)
+	}
+	if buffer == "" {
+		buffer = "default"
+	}
+	if !validBufferType(buffer) {
+		return fmt.Errorf("%w: unknown buffer type %s", v2.ErrInvalidSerialRequest, buffer)
+	}
+	// the port is checked and opened under the lock, so that the websocket can't open it in between
+	sh.openMu.Lock()
+	defer sh.openMu.Unlock()
+	if _, ok := sh.FindPortByName(portname); ok {
+		return fmt.Errorf("%w: %s", v2.ErrSerialPortOpen, portname)
+	}
+
+	conf := &SerialConfig{Name: portname, Baud: baud, RtsOn: true}
+	sp, err := openSerialPort(portname, baud)
+	var portErr *serial.PortError
+	if errors.Is(err, fs.ErrNotExist) || errors.As(err, &portErr) && portErr.Code() == serial.PortNotFound {
+		return fmt.Errorf("%w: %s", v2.ErrSerialPortNotFound, portname)
+	} else if errors.As(err, &portErr) && portErr.Code() == serial.PortBusy {
+		return fmt.Errorf("%w: %s is busy", v2.ErrSerialPortOpen, portname)
+	} else if err != nil {
+		return err
+	}
+	log.Printf("Opened port %s at %d baud from the v2 API", portname, baud)
+
+	// the port is registered before answering, so that it can be used right away
+	p, err := newSerport(conf, buffer, sp)
+	if err != nil {
+		sp.Close()
+		return err
+	}
+	sh.Register(p)
+	go func() {
+		defer recoverPanic("open of " + portname)
+		defer sh.Unregister(p)
+		p.run()
+	}()
+	return nil
+}
+
+func (apiSerialPorts) Close(portname string) error {
+	if !commandAllowed("close") {
+		return fmt.Errorf("%w: the close command is disabled by the agent configuration", v2.ErrSerialNotAllowed)
+	}
+	port, ok := sh.FindPortByName(portname)
+	if !ok {
+		return fmt.Errorf("%w: %s is not open", v2.ErrSerialPortNotFound, portname)
+	}
+	port.Close()
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+
+	socketio "github.com/googollee/go-socket.io"
+)
+
+// serialMessage is the data read from a port. It's sent to the clients as JSON text
+// (SpPortMessage or SpPortMessageRaw), or as binary to the clients asking for it,
+// connecting with the binary=true parameter. The binary messages are "serial" events
+// with the port as first argument and the data as binary attachment, which is sent
+// as raw websocket frame, e.g.:
+//
+//	socket.on("serial", (port, data) => { ... })
+type serialMessage struct {
+	port string
+	data []byte
+	json []byte
+}
+
+// sendSerial queues the data read from a port without blocking the reader, see sendSys
+func (h *hub) sendSerial(m serialMessage) {
+	sendDropOldest(h.broadcastSerial, m)
+}
+
+// emitBinary sends the serial data as binary attachment
+func (c *connection) emitBinary(message hubMessage) error {
+	args := []interface{}{message.serial.port, &socketio.Attachment{Data: bytes.NewBuffer(message.serial.data)}}
+	if c.replay && message.seq > 0 {
+		args = append(args, message.seq)
+	}
+	return c.ws.Emit("serial", args...)
+}
@@ -18,6 +18,8 @@ package main
 import (
 	"bytes"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"io"
 	"strconv"
 	"sync/atomic"
@@ -30,10 +32,18 @@ import (
 
 // SerialConfig is the serial port configuration
 type SerialConfig struct {
-	Name  string
-	Baud  int
-	RtsOn bool
-	DtrOn bool
+	Name      string
+	Baud      int
+	RtsOn     bool
+	DtrOn     bool
+	Timestamp bool // add the time of reception to the messages read from the port
+
+	// LineEnding replaces the newlines of the data sent with send and sendnobuf, empty to keep them.
+	// The data sent with sendraw is never changed.
+	LineEnding string
+	// NormalizeLineEndings converts the CR and CRLF line endings read from the port to LF.
+	// The data read with the timedraw buffer is never changed.
+	NormalizeLineEndings bool
 }
 
 type serport struct {
@@ -54,6 +64,9 @@ type serport struct {
 	// unbuffered channel of outbound messages that bypass internal serial port buffer
 	sendNoBuf chan []byte
 
+	// closed when the port is unregistered, see send
+	done chan struct{}
+
 	// channel containing raw base64 encoded binary data (outbound messages)
 	sendRaw chan string
 
@@ -61,18 +74,48 @@ type serport struct {
 	BufferType string
 	//bufferwatcher *BufferflowDummypause
 	bufferwatcher Bufferflow
+
+	// the recording of the data flowing through the port, if started
+	recorder atomic.Pointer[recorder]
+
+	// the transfer statistics of the port
+	stats portStats
+
+	// the bytes queued to be written on the port, see spWriteBufferDepth
+	writeQueued atomic.Int64
+
+	// normalizes the line endings read from the port, if enabled
+	lineEndings lineEndingsNormalizer
 }
 
 // SpPortMessage is the serial port message
 type SpPortMessage struct {
 	P string // the port, i.e. com22
 	D string // the data, i.e. G0 X0 Y0
+	T string `json:",omitempty"` // the time the data has been received, if enabled on the port
 }
 
 // SpPortMessageRaw is the raw serial port message
 type SpPortMessageRaw struct {
 	P string // the port, i.e. com22
 	D []byte // the data, i.e. G0 X0 Y0
+	T string `json:",omitempty"` // the time the data has been received, if enabled on the port
+}
+
+// The limits of the serialBufferSize setting, the bytes read at once from a port
+const (
+	defaultSerialBufferSize = 1024
+	minSerialBufferSize     = 64
+	maxSerialBufferSize     = 1024 * 1024
+)
+
+// validSerialBufferSize returns the size of the read buffer of the ports, or the
+// default one with an error if the size is out of the limits
+func validSerialBufferSize(size int) (int, error) {
+	if size < minSerialBufferSize || size > maxSerialBufferSize {
+		return defaultSerialBufferSize, fmt.Errorf("invalid serialBufferSize %d: it must be between %d and %d, using %d", size, minSerialBufferSize, maxSerialBufferSize, defaultSerialBufferSize)
+	}
+	return size, nil
 }
 
 func (p *serport) reader(buftype string) {
@@ -80,7 +123,7 @@ func (p *serport) reader(buftype string) {
 	timeCheckOpen := time.Now()
 	var bufferedCh bytes.Buffer
 
-	serialBuffer := make([]byte, 1024)
+	serialBuffer := make([]byte, serialBufferSize.Load())
 	for {
 		n, err := p.portIo.Read(serialBuffer)
 		bufferPart := serialBuffer[:n]
@@ -89,7 +132,7 @@ func (p *serport) reader(buftype string) {
 		if p.isClosing.Load() {
 			strmsg := "Shutting down reader on " + p.portConf.Name
 			log.Println(strmsg)
-			h.broadcastSys <- []byte(strmsg)
+			h.sendSys([]byte(strmsg))
 			break
 		}
 
@@ -98,11 +141,17 @@ func (p *serport) reader(buftype string) {
 		if n > 0 && err == nil {
 
 			log.Print("Read " + strconv.Itoa(n) + " bytes ch: " + string(bufferPart[:n]))
+			p.record("RX", bufferPart[:n])
+			p.stats.addReceived(n)
+			maxGC()
 
 			data := ""
 			switch buftype {
 			case "timedraw", "timed":
 				data = string(bufferPart[:n])
+				if buftype == "timed" {
+					data = p.normalizeLineEndings(data)
+				}
 				// give the data to our bufferflow so it can do it's work
 				// to read/translate the data to see if it wants to block
 				// writes to the serialport. each bufferflow type will decide
@@ -125,7 +174,7 @@ func (p *serport) reader(buftype string) {
 					data += string(runeValue)
 					w = width
 				}
-				p.bufferwatcher.OnIncomingData(data)
+				p.bufferwatcher.OnIncomingData(p.normalizeLineEndings(data))
 			default:
 				log.Panicf("unknown buffer type %s", buftype)
 			}
@@ -143,15 +192,16 @@ func (p *serport) reader(buftype string) {
 			if err == io.EOF || err == io.ErrUnexpectedEOF {
 				// hit end of file
 				log.Println("Hit end of file on serial port")
-				h.broadcastSys <- []byte("{\"Cmd\":\"OpenFail\",\"Desc\":\"Got EOF (End of File) on port which usually means another app other than Serial Port JSON Server is locking your port. " + err.Error() + "\",\"Port\":\"" + p.portConf.Name + "\",\"Baud\":" + strconv.Itoa(p.portConf.Baud) + "}")
+				h.sendSys([]byte("{\"Cmd\":\"OpenFail\",\"Desc\":\"Got EOF (End of File) on port which usually means another app other than Serial Port JSON Server is locking your port. " + err.Error() + "\",\"Port\":\"" + p.portConf.Name + "\",\"Baud\":" + strconv.Itoa(p.portConf.Baud) + "}"))
 
 			}
 
 			if err != nil {
 				log.Println(err)
-				h.broadcastSys <- []byte("Error reading on " + p.portConf.Name + " " +
-					err.Error() + " Closing port.")
-				h.broadcastSys <- []byte("{\"Cmd\":\"OpenFail\",\"Desc\":\"Got error reading on port. " + err.Error() + "\",\"Port\":\"" + p.portConf.Name + "\",\"Baud\":" + strconv.Itoa(p.portConf.Baud) + "}")
+				p.stats.addError()
+				h.sendSys([]byte("Error reading on " + p.portConf.Name + " " +
+					err.Error() + " Closing port."))
+				h.sendSys([]byte("{\"Cmd\":\"OpenFail\",\"Desc\":\"Got error reading on port. " + err.Error() + "\",\"Port\":\"" + p.portConf.Name + "\",\"Baud\":" + strconv.Itoa(p.portConf.Baud) + "}"))
 				p.isClosingDueToError = true
 				break
 			}
@@ -168,6 +218,7 @@ func (p *serport) reader(buftype string) {
 		}
 	}
 	if p.isClosingDueToError {
+		boardResets.portClosedByError(p.portConf, p.BufferType)
 		p.Close()
 	}
 }
@@ -177,14 +228,39 @@ func (p *serport) Write(data string, sendMode string) {
 	// if user sent in the commands as one text mode line
 	switch sendMode {
 	case "send":
+		data = translateLineEndings(data, p.portConf.LineEnding)
+		p.writeQueued.Add(int64(len(data)))
 		p.sendBuffered <- data
 	case "sendnobuf":
-		p.sendNoBuf <- []byte(data)
+		data = translateLineEndings(data, p.portConf.LineEnding)
+		p.writeQueued.Add(int64(len(data)))
+		p.send([]byte(data))
 	case "sendraw":
+		// the exact size is known once decoded, see writerRaw
+		p.writeQueued.Add(int64(base64.StdEncoding.DecodedLen(len(data))))
 		p.sendRaw <- data
 	}
 }
 
+// send queues the data to the writer of the port. It returns false without sending
+// the data if the port has been unregistered.
+func (p *serport) send(data []byte) bool {
+	select {
+	case p.sendNoBuf <- data:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+// normalizeLineEndings converts the line endings of the data read to LF, if enabled on the port
+func (p *serport) normalizeLineEndings(data string) string {
+	if !p.portConf.NormalizeLineEndings {
+		return data
+	}
+	return p.lineEndings.normalize(data)
+}
+
 // this method runs as its own thread because it's instantiated
 // as a "go" method. so if it blocks inside, it is ok
 func (p *serport) writerBuffered() {
@@ -204,7 +280,9 @@ func (p *serport) writerBuffered() {
 
 		// send to the non-buffered serial port writer
 		//log.Println("About to send to p.sendNoBuf channel")
-		p.sendNoBuf <- []byte(data)
+		if !p.send([]byte(data)) {
+			break
+		}
 
 	}
 	msgstr := "writerBuffered just got closed. make sure you make a new one. port:" + p.portConf.Name
@@ -215,9 +293,23 @@ func (p *serport) writerBuffered() {
 // this method runs as its own thread because it's instantiated
 // as a "go" method. so if it blocks inside, it is ok
 func (p *serport) writerNoBuf() {
-	// this for loop blocks on p.send until that channel
-	// sees something come in
-	for data := range p.sendNoBuf {
+	defer recoverPanic("writer of " + p.portConf.Name)
+	// the port is closed even after a panic, so that the reader stops too
+	defer func() {
+		p.portIo.Close()
+		serialPorts.List()
+	}()
+
+	// this for loop blocks on p.sendNoBuf until that channel
+	// sees something come in, or the port is unregistered
+writer:
+	for {
+		var data []byte
+		select {
+		case data = <-p.sendNoBuf:
+		case <-p.done:
+			break writer
+		}
 
 		// if we get here, we were able to write successfully
 		// to the serial port because it blocks until it can write
@@ -227,7 +319,12 @@ func (p *serport) writerNoBuf() {
 		n2, err := p.portIo.Write(data)
 
 		log.Print("Just wrote ", n2, " bytes to serial: ", string(data))
+		p.record("TX", data[:n2])
+		p.stats.addSent(n2)
+		p.writeQueued.Add(-int64(len(data)))
+		maxGC()
 		if err != nil {
+			p.stats.addError()
 			errstr := "Error writing to " + p.portConf.Name + " " + err.Error() + " Closing port."
 			log.Print(errstr)
 			h.broadcastSys <- []byte(errstr)
@@ -237,8 +334,6 @@ func (p *serport) writerNoBuf() {
 	msgstr := "Shutting down writer on " + p.portConf.Name
 	log.Println(msgstr)
 	h.broadcastSys <- []byte(msgstr)
-	p.portIo.Close()
-	serialPorts.List()
 }
 
 // this method runs as its own thread because it's instantiated
@@ -263,9 +358,12 @@ func (p *serport) writerRaw() {
 			log.Println("Decoding error:", err)
 		}
 		log.Println(string(sDec))
+		p.writeQueued.Add(int64(len(sDec) - base64.StdEncoding.DecodedLen(len(data))))
 
 		// send to the non-buffered serial port writer
-		p.sendNoBuf <- sDec
+		if !p.send(sDec) {
+			break
+		}
 
 	}
 	msgstr := "writerRaw just got closed. make sure you make a new one. port:" + p.portConf.Name
@@ -273,7 +371,9 @@ func (p *serport) writerRaw() {
 	h.broadcastSys <- []byte(msgstr)
 }
 
-func spHandlerOpen(portname string, baud int, buftype string) {
+func spHandlerOpen(conf *SerialConfig, buftype string) {
+	portname, baud := conf.Name, conf.Baud
+	defer recoverPanic("open of " + portname)
 
 	log.Print("Inside spHandler")
 
@@ -286,54 +386,97 @@ func spHandlerOpen(portname string, baud int, buftype string) {
 	out.WriteString(" baud")
 	log.Print(out.String())
 
-	conf := &SerialConfig{Name: portname, Baud: baud, RtsOn: true}
-
-	mode := &serial.Mode{
-		BaudRate: baud,
+	// the buffer type is checked before opening the port, to not leave it open on error
+	if !validBufferType(buftype) {
+		log.Print("Unknown buffer type " + buftype)
+		h.broadcastSys <- []byte("{\"Cmd\":\"OpenFail\",\"Desc\":\"Unknown buffer type " + buftype + "\",\"Port\":\"" + conf.Name + "\",\"Baud\":" + strconv.Itoa(conf.Baud) + "}")
+		return
 	}
 
-	sp, err := serial.Open(portname, mode)
+	sh.openMu.Lock()
+	sp, err := openSerialPort(portname, baud)
 	log.Print("Just tried to open port")
 	if err != nil {
+		sh.openMu.Unlock()
 		//log.Fatal(err)
 		log.Print("Error opening port " + err.Error())
 		//h.broadcastSys <- []byte("Error opening port. " + err.Error())
 		h.broadcastSys <- []byte("{\"Cmd\":\"OpenFail\",\"Desc\":\"Error opening port. " + err.Error() + "\",\"Port\":\"" + conf.Name + "\",\"Baud\":" + strconv.Itoa(conf.Baud) + "}")
-
 		return
 	}
 	log.Print("Opened port successfully")
+
+	p, err := newSerport(conf, buftype, sp)
+	if err != nil {
+		sh.openMu.Unlock()
+		sp.Close()
+		h.broadcastSys <- []byte("{\"Cmd\":\"OpenFail\",\"Desc\":\"" + err.Error() + "\",\"Port\":\"" + conf.Name + "\",\"Baud\":" + strconv.Itoa(conf.Baud) + "}")
+		return
+	}
+	sh.Register(p)
+	sh.openMu.Unlock()
+	defer sh.Unregister(p)
+	p.run()
+}
+
+// validBufferType checks the buffer type requested to open a port
+func validBufferType(buftype string) bool {
+	return buftype == "default" || buftype == "timed" || buftype == "timedraw"
+}
+
+// openSerialPort opens the serial port, or the virtual one. If the port is busy
+// it's marked as such in the list of the ports.
+func openSerialPort(portname string, baud int) (io.ReadWriteCloser, error) {
+	if isVirtualPort(portname) {
+		return newVirtualSerialPort(), nil
+	}
+	sp, err := serial.Open(portname, &serial.Mode{BaudRate: baud})
+	var portErr *serial.PortError
+	if errors.As(err, &portErr) && portErr.Code() == serial.PortBusy {
+		serialPorts.MarkPortAsBusy(portname)
+		serialPorts.List()
+	}
+	return sp, err
+}
+
+// newSerport returns the port to register in the serial hub, with the given buffer type.
+// The serial port sp is not closed if the buffer type is unknown.
+func newSerport(conf *SerialConfig, buftype string, sp io.ReadWriteCloser) (*serport, error) {
+	portname := conf.Name
 	//p := &serport{send: make(chan []byte, 256), portConf: conf, portIo: sp}
 	// we can go up to 256,000 lines of gcode in the buffer
 	p := &serport{
 		sendBuffered: make(chan string, 256000),
 		sendNoBuf:    make(chan []byte),
 		sendRaw:      make(chan string),
+		done:         make(chan struct{}),
 		portConf:     conf,
 		portIo:       sp,
 		portName:     portname,
 		BufferType:   buftype}
+	p.stats.reset(portname)
 
 	var bw Bufferflow
 
 	switch buftype {
 	case "timed":
-		bw = NewBufferflowTimed(portname, h.broadcastSys)
+		bw = NewBufferflowTimed(portname, h.sendSerial, conf.Timestamp)
 	case "timedraw":
-		bw = NewBufferflowTimedRaw(portname, h.broadcastSys)
+		bw = NewBufferflowTimedRaw(portname, h.sendSerial, conf.Timestamp)
 	case "default":
-		bw = NewBufferflowDefault(portname, h.broadcastSys)
+		bw = NewBufferflowDefault(portname, h.sendSerial, conf.Timestamp)
 	default:
-		log.Panicf("unknown buffer type: %s", buftype)
+		return nil, fmt.Errorf("unknown buffer type: %s", buftype)
 	}
 
 	bw.Init()
 	p.bufferwatcher = bw
+	return p, nil
+}
 
-	sh.Register(p)
-	defer sh.Unregister(p)
-
-	serialPorts.MarkPortAsOpened(portname)
+// run serves the registered port until it's closed
+func (p *serport) run() {
+	serialPorts.MarkPortAsOpened(p.portName)
 	serialPorts.List()
 
 	// this is internally buffered thread to not send to serial port if blocked
@@ -343,7 +486,7 @@ func spHandlerOpen(portname string, baud int, buftype string) {
 	// this is thread to send to serial port but with base64 decoding
 	go p.writerRaw()
 
-	p.reader(buftype)
+	p.reader(p.BufferType)
 
 	serialPorts.List()
 }
@@ -352,6 +495,7 @@ func (p *serport) Close() {
 	p.isClosing.Store(true)
 
 	p.bufferwatcher.Close()
+	p.stopRecording()
 	p.portIo.Close()
 	serialPorts.MarkPortAsClosed(p.portName)
 	serialPorts.List()
@@ -0,0 +1,129 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// The policies for a new websocket connection coming from an origin already connected
+const (
+	// duplicatesAllow keeps all the connections (the default)
+	duplicatesAllow = "allow"
+	// duplicatesTakeover closes the old connections
+	duplicatesTakeover = "takeover"
+	// duplicatesReject refuses the new connection
+	duplicatesReject = "reject"
+)
+
+// Session is a websocket connection to the hub
+type Session struct {
+	ID          string    `json:"id"`
+	Origin      string    `json:"origin"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	// Duplicate is true if there are other sessions from the same origin
+	Duplicate bool `json:"duplicate"`
+}
+
+// Sessions are the websocket connections and the policy applied to the duplicated ones
+type Sessions struct {
+	Policy     string    `json:"policy"`
+	Duplicates int       `json:"duplicates"`
+	Sessions   []Session `json:"sessions"`
+}
+
+func duplicatesPolicy() string {
+	switch policy := duplicateConns.Load(); policy {
+	case duplicatesTakeover, duplicatesReject:
+		return policy
+	default:
+		return duplicatesAllow
+	}
+}
+
+// duplicatesOf returns the connections with the same origin of c.
+// The connections without an origin (e.g. not from a browser) are never duplicated.
+func duplicatesOf(connections map[*connection]bool, c *connection) []*connection {
+	var duplicates []*connection
+	if c.origin == "" {
+		return duplicates
+	}
+	for other := range connections {
+		if other != c && other.origin == c.origin {
+			duplicates = append(duplicates, other)
+		}
+	}
+	return duplicates
+}
+
+// getSessions must be called by the hub, the owner of the connections
+func (h *hub) getSessions() Sessions {
+	res := Sessions{Policy: duplicatesPolicy(), Sessions: []Session{}}
+	for c := range h.connections {
+		duplicate := len(duplicatesOf(h.connections, c)) > 0
+		if duplicate {
+			res.Duplicates++
+		}
+		res.Sessions = append(res.Sessions, Session{
+			ID:          c.ws.Id(),
+			Origin:      c.origin,
+			ConnectedAt: c.connectedAt,
+			Duplicate:   duplicate,
+		})
+	}
+	sort.Slice(res.Sessions, func(i, j int) bool {
+		return res.Sessions[i].ConnectedAt.Before(res.Sessions[j].ConnectedAt)
+	})
+	return res
+}
+
+// registerConnection adds c to the connections, applying the policy for the duplicated
+// connections. It returns false if c has been rejected.
+func (h *hub) registerConnection(c *connection) bool {
+	if duplicates := duplicatesOf(h.connections, c); len(duplicates) > 0 {
+		switch duplicatesPolicy() {
+		case duplicatesReject:
+			log.Infof("rejected a new connection from %s, another one is already open", c.origin)
+			c.send <- hubMessage{data: []byte("{\"Error\" : \"Another connection from the same origin is already open\"}")}
+			close(c.send)
+			go c.ws.Disconnect()
+			return false
+		case duplicatesTakeover:
+			for _, old := range duplicates {
+				log.Infof("closing the old connection from %s, taken over by a new one", old.origin)
+				h.unregisterConnection(old)
+				go old.ws.Disconnect()
+			}
+		}
+	}
+	h.connections[c] = true
+	return true
+}
+
+func sessionsHandler(c *gin.Context) {
+	res := make(chan Sessions)
+	select {
+	case h.sessions <- res:
+		c.JSON(http.StatusOK, <-res)
+	case <-h.stopped:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "the agent is quitting"})
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arduino/arduino-create-agent/upload"
+	log "github.com/sirupsen/logrus"
+)
+
+// shutdownTimeout is the time waited for the goroutines of the agent to stop when quitting
+const shutdownTimeout = 5 * time.Second
+
+var (
+	// agentCtx is cancelled when the agent quits, to stop its long running goroutines
+	agentCtx, cancelAgent = context.WithCancel(context.Background())
+	// agentTasks are the goroutines started with goTask, waited for when quitting
+	agentTasks sync.WaitGroup
+	// agentServers are the HTTP and HTTPS servers, shut down when quitting
+	agentServers   []*http.Server
+	agentServersMu sync.Mutex
+)
+
+// goTask runs the task in a goroutine, the task must return when ctx is cancelled
+func goTask(task func(ctx context.Context)) {
+	agentTasks.Add(1)
+	go func() {
+		defer agentTasks.Done()
+		task(agentCtx)
+	}()
+}
+
+// addServer registers srv to be shut down when the agent quits
+func addServer(srv *http.Server) {
+	agentServersMu.Lock()
+	defer agentServersMu.Unlock()
+	agentServers = append(agentServers, srv)
+}
+
+// shutdownServers stops the servers accepting new requests and waits for the running ones,
+// until ctx expires. The websocket connections are closed by the hub.
+func shutdownServers(ctx context.Context) {
+	agentServersMu.Lock()
+	defer agentServersMu.Unlock()
+	for _, srv := range agentServers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Warnf("cannot shut down the server on %s: %s", srv.Addr, err)
+		}
+	}
+	agentServers = nil
+}
+
+// shutdown stops the running uploads and closes the serial ports before quitting,
+// then it stops the goroutines of the agent, e.g. the serial discovery and the hub,
+// and the servers
+func shutdown() {
+	log.Info("shutting down")
+	upload.Kill()
+	sh.CloseAll()
+	cancelAgent()
+
+	stopped := make(chan struct{})
+	go func() {
+		agentTasks.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		log.Warnf("the agent didn't stop within %s, quitting anyway", shutdownTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	shutdownServers(ctx)
+	agentPorts.remove()
+	log.Info("agent stopped")
+
+	// the log file is written before the process exits
+	if agentLogFile != nil {
+		agentLogFile.Sync()
+	}
+}
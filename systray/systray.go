@@ -18,7 +18,9 @@ package systray
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/arduino/go-paths-helper"
 	log "github.com/sirupsen/logrus"
@@ -36,6 +38,12 @@ type Systray struct {
 	AdditionalConfig string
 	// The path to the directory containing the configuration files
 	ConfigDir *paths.Path
+	// Whether the Agent runs without the systray icon, e.g. as a service
+	Headless bool
+	// Called before quitting, to stop the agent gracefully
+	OnQuit func()
+	// Called on SIGHUP when the Agent is headless, to reload the configuration
+	OnReload func()
 	// The path of the exe (only used in update)
 	path string
 	// The path of the configuration file
@@ -62,6 +70,9 @@ func (s *Systray) Restart() {
 
 	// Build args
 	args := []string{"-ls", fmt.Sprintf("--hibernate=%v", s.Hibernate)}
+	if s.Headless {
+		args = append(args, "--service")
+	}
 
 	if s.AdditionalConfig != "" {
 		args = append(args, fmt.Sprintf("--additional-config=%s", s.AdditionalConfig))
@@ -101,3 +112,40 @@ func (s *Systray) RestartWith(path string) {
 func (s *Systray) SetCurrentConfigFile(configPath *paths.Path) {
 	s.currentConfigFilePath = configPath
 }
+
+// startHeadless blocks until the agent is stopped with SIGTERM or SIGINT.
+// SIGHUP reloads the configuration in the same process, so that the service manager
+// (e.g. systemd or launchd) keeps tracking the agent.
+func (s *Systray) startHeadless() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			log.Info("received SIGHUP, reloading the configuration")
+			if s.OnReload != nil {
+				s.OnReload()
+			}
+			continue
+		}
+		log.Infof("received %s, quitting", sig)
+		s.Quit()
+	}
+}
+
+// quitOnTerminate quits the agent gracefully when it's stopped with SIGTERM or SIGINT,
+// e.g. when the user logs out. It's used when the systray icon is shown.
+func (s *Systray) quitOnTerminate() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-signals
+	log.Infof("received %s, quitting", sig)
+	s.Quit()
+}
+
+// quitHeadless stops the agent gracefully and exits
+func (s *Systray) quitHeadless() {
+	if s.OnQuit != nil {
+		s.OnQuit()
+	}
+	os.Exit(0)
+}
@@ -19,14 +19,16 @@
 
 package systray
 
-import "os"
-
-// Start is a dummy function
+// Start is a dummy function, it handles the signals
 func (s *Systray) Start() {
+	if s.Headless {
+		s.startHeadless()
+	}
+	s.quitOnTerminate()
 	select {}
 }
 
-// Quit is a dummy function
+// Quit stops the agent gracefully and exits
 func (s *Systray) Quit() {
-	os.Exit(0)
+	s.quitHeadless()
 }
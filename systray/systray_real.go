@@ -36,6 +36,11 @@ import (
 
 // Start sets up the systray icon with its menus
 func (s *Systray) Start() {
+	if s.Headless {
+		s.startHeadless()
+		return
+	}
+	go s.quitOnTerminate()
 	if s.Hibernate {
 		systray.Run(s.startHibernate, s.end)
 	} else {
@@ -45,6 +50,9 @@ func (s *Systray) Start() {
 
 // Quit simply exits the program
 func (s *Systray) Quit() {
+	if s.Headless {
+		s.quitHeadless()
+	}
 	systray.Quit()
 }
 
@@ -89,7 +97,9 @@ func (s *Systray) start() {
 			case <-mDebug.ClickedCh:
 				_ = open.Start(s.DebugURL())
 			case <-mConfig.ClickedCh:
-				_ = open.Start(s.currentConfigFilePath.String())
+				if s.currentConfigFilePath != nil {
+					_ = open.Start(s.currentConfigFilePath.String())
+				}
 			case <-mRmCrashes.ClickedCh:
 				RemoveCrashes()
 				s.updateMenuItem(mRmCrashes, config.LogsIsEmpty())
@@ -153,7 +163,11 @@ func (s *Systray) updateMenuItem(item *systray.MenuItem, disable bool) {
 
 // RemoveCrashes removes the crash-reports from `logs` folder
 func RemoveCrashes() {
-	logsDir := config.GetLogsDir()
+	logsDir, err := config.GetLogsDir()
+	if err != nil {
+		log.Errorf("Cannot remove crashreports: %s", err)
+		return
+	}
 	pathErr := logsDir.RemoveAll()
 	if pathErr != nil {
 		log.Errorf("Cannot remove crashreports: %s", pathErr)
@@ -183,8 +197,11 @@ func (s *Systray) startHibernate() {
 	}()
 }
 
-// end simply exits the program
+// end stops the agent gracefully and exits the program
 func (s *Systray) end() {
+	if s.OnQuit != nil {
+		s.OnQuit()
+	}
 	os.Exit(0)
 }
 
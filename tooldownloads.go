@@ -0,0 +1,40 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/arduino/arduino-create-agent/v2/pkgs"
+	"github.com/gin-gonic/gin"
+)
+
+func toolDownloadsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, pkgs.Downloads())
+}
+
+func cancelToolDownloadHandler(c *gin.Context) {
+	id := c.Param("id")
+	if err := pkgs.CancelDownload(id); errors.Is(err, pkgs.ErrDownloadNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "download " + id + " not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "cancelled"})
+}
@@ -130,7 +130,7 @@ func TestDownload(t *testing.T) {
 		IndexFile:   *paths.New("testdata", "test_tool_index.json"),
 		LastRefresh: time.Now(),
 	}
-	testTools := New(tempDirPath, &testIndex, func(msg string) { t.Log(msg) }, utilities.MustParseRsaPublicKey([]byte(globals.ArduinoSignaturePubKey)))
+	testTools := New(tempDirPath, &testIndex, func(msg string) { t.Log(msg) }, utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
 
 	for _, tc := range testCases {
 		t.Run(tc.name+"-"+tc.version, func(t *testing.T) {
@@ -177,8 +177,31 @@ func TestCorruptedInstalled(t *testing.T) {
 	defer fileJSON.Close()
 	_, err = fileJSON.Write([]byte("Hello"))
 	require.NoError(t, err)
-	testTools := New(tempDirPath, &testIndex, func(msg string) { t.Log(msg) }, utilities.MustParseRsaPublicKey([]byte(globals.ArduinoSignaturePubKey)))
+	testTools := New(tempDirPath, &testIndex, func(msg string) { t.Log(msg) }, utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
 	// Download the tool
 	err = testTools.Download("arduino-test", "avrdude", "6.3.0-arduino17", "keep")
 	require.NoError(t, err)
 }
+
+func TestInstalledLocations(t *testing.T) {
+	tempDirPath := paths.New(t.TempDir())
+	testIndex := index.Resource{
+		IndexFile:   *paths.New("testdata", "test_tool_index.json"),
+		LastRefresh: time.Now(),
+	}
+	testTools := New(tempDirPath, &testIndex, func(msg string) { t.Log(msg) }, utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
+
+	// nothing is installed yet
+	locations, err := testTools.InstalledLocations()
+	require.NoError(t, err)
+	require.Empty(t, locations)
+
+	avrdude := tempDirPath.Join("arduino", "avrdude", "6.3.0-arduino17").String()
+	bossac := tempDirPath.Join("arduino", "bossac", "1.7.0").String()
+	installed, err := json.Marshal(map[string]string{"avrdude": avrdude, "avrdude-6.3.0-arduino17": avrdude, "bossac": bossac})
+	require.NoError(t, err)
+	require.NoError(t, tempDirPath.Join("installed.json").WriteFile(installed))
+	locations, err = testTools.InstalledLocations()
+	require.NoError(t, err)
+	require.Equal(t, []string{avrdude, bossac}, locations)
+}
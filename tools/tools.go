@@ -18,7 +18,10 @@ package tools
 import (
 	"crypto/rsa"
 	"encoding/json"
+	"errors"
+	"io/fs"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 
@@ -56,19 +59,41 @@ type Tools struct {
 // The New functions accept the directory to use to host the tools,
 // an index (used to download the tools),
 // and a logger to log the operations
-func New(directory *paths.Path, index *index.Resource, logger func(msg string), signPubKey *rsa.PublicKey) *Tools {
+func New(directory *paths.Path, index *index.Resource, logger func(msg string), signPubKeys []*rsa.PublicKey) *Tools {
 	t := &Tools{
 		directory: directory,
 		index:     index,
 		logger:    logger,
 		installed: map[string]string{},
 		mutex:     sync.RWMutex{},
-		tools:     pkgs.New(index, directory.String(), "replace", signPubKey),
+		tools:     pkgs.New(index, directory.String(), "replace", signPubKeys),
 	}
+	t.tools.SetLogger(logger)
 	_ = t.readMap()
 	return t
 }
 
+// SetMirror sets the base URL of a mirror used to download the tools,
+// the official URL is used if a tool can't be downloaded from the mirror
+func (t *Tools) SetMirror(mirror string) {
+	t.tools.SetMirror(mirror)
+}
+
+// SetMirrorUnsigned disables the verification of the signatures of the tools downloaded from the mirror
+func (t *Tools) SetMirrorUnsigned(unsigned bool) {
+	t.tools.SetMirrorUnsigned(unsigned)
+}
+
+// SetVerifySignatures enables the verification of the signatures of the tools, the default
+func (t *Tools) SetVerifySignatures(verify bool) {
+	t.tools.SetVerifySignatures(verify)
+}
+
+// SetRetries sets the number of times a failed download of a tool is retried
+func (t *Tools) SetRetries(retries int) {
+	t.tools.SetRetries(retries)
+}
+
 func (t *Tools) setMapValue(key, value string) {
 	t.mutex.Lock()
 	t.installed[key] = value
@@ -94,6 +119,23 @@ func (t *Tools) readMap() error {
 	return json.Unmarshal(b, &t.installed)
 }
 
+// InstalledLocations returns the directories where the installed tools are
+func (t *Tools) InstalledLocations() ([]string, error) {
+	if err := t.readMap(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	locations := []string{}
+	for _, location := range t.installed {
+		if !slices.Contains(locations, location) {
+			locations = append(locations, location)
+		}
+	}
+	slices.Sort(locations)
+	return locations, nil
+}
+
 // GetLocation extracts the toolname from a command like
 func (t *Tools) GetLocation(command string) (string, error) {
 	command = strings.Replace(command, "{runtime.tools.", "", 1)
@@ -35,7 +35,7 @@ import (
 )
 
 func updateHandler(c *gin.Context) {
-	restartPath, err := updater.CheckForUpdates(version, *updateURL, *appName)
+	restartPath, err := updater.CheckForUpdates(version, updateURL.Load(), appName.Load())
 	if err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
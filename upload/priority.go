@@ -0,0 +1,50 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package upload
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// The priorities of the upload tools. The higher ones avoid the tools being starved
+// by the other processes on busy machines, failing the sync with the bootloader.
+const (
+	PriorityNormal   = "normal"
+	PriorityHigh     = "high"
+	PriorityRealtime = "realtime"
+)
+
+// priority is changed by SetPriority when the config is reloaded, while the uploads read it
+var priority atomic.Value
+
+// getPriority returns the priority of the upload tools, the normal one if it's not set
+func getPriority() string {
+	if p, ok := priority.Load().(string); ok {
+		return p
+	}
+	return PriorityNormal
+}
+
+// SetPriority sets the priority of the upload tools run from now on
+func SetPriority(p string) error {
+	switch p {
+	case PriorityNormal, PriorityHigh, PriorityRealtime:
+		priority.Store(p)
+		return nil
+	}
+	return fmt.Errorf("invalid upload priority %q: it must be %s, %s or %s", p, PriorityNormal, PriorityHigh, PriorityRealtime)
+}
@@ -0,0 +1,34 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build !windows
+
+package upload
+
+import "syscall"
+
+// setProcessPriority changes the niceness of the process, raising it needs the privileges to do so
+func setProcessPriority(pid int, p string) error {
+	nice := 0
+	switch p {
+	case PriorityHigh:
+		nice = -10
+	case PriorityRealtime:
+		nice = -20
+	default:
+		return nil
+	}
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice)
+}
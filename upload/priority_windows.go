@@ -0,0 +1,40 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build windows
+
+package upload
+
+import "golang.org/x/sys/windows"
+
+// setProcessPriority changes the priority class of the process. Without the privileges
+// to use the realtime class, Windows silently sets the high one.
+func setProcessPriority(pid int, p string) error {
+	var class uint32
+	switch p {
+	case PriorityHigh:
+		class = windows.HIGH_PRIORITY_CLASS
+	case PriorityRealtime:
+		class = windows.REALTIME_PRIORITY_CLASS
+	default:
+		return nil
+	}
+	handle, err := windows.OpenProcess(windows.PROCESS_SET_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(handle)
+	return windows.SetPriorityClass(handle, class)
+}
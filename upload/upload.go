@@ -17,16 +17,21 @@ package upload
 
 import (
 	"bufio"
+	"fmt"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/arduino/arduino-create-agent/utilities"
 	serialutils "github.com/arduino/go-serial-utils"
 	shellwords "github.com/mattn/go-shellwords"
 	"github.com/pkg/errors"
+	"go.bug.st/serial"
 	"go.bug.st/serial/enumerator"
 )
 
@@ -98,6 +103,65 @@ func Serial(port, commandline string, extra Extra, l Logger) error {
 	return program(z[0], z[1:], l)
 }
 
+// retryDelay is the time waited between two upload attempts
+var retryDelay = 2 * time.Second
+
+// transientRe matches the output of the upload tools that identifies a failure
+// caused by bad timing with the bootloader, rather than a problem with the sketch
+var transientRe = regexp.MustCompile(`(?i)(not in sync|stk500v?2?_getsync|stk500_recv\(\): programmer is not responding|no device found on|no response from the board|failed to connect to)`)
+
+// TransientError is returned when the upload tool failed in a way that
+// usually goes away by simply trying again (e.g. a sync timeout)
+type TransientError struct {
+	err error
+}
+
+func (e *TransientError) Error() string {
+	return e.err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.err
+}
+
+// IsTransient returns true if the upload failed with a TransientError
+func IsTransient(err error) bool {
+	var transient *TransientError
+	return errors.As(err, &transient)
+}
+
+// maxStderrLines is the number of lines of the stderr of the upload tool kept in a ToolError
+const maxStderrLines = 100
+
+// ToolError is returned when the upload tool exits with an error, with the last lines it printed on the stderr
+type ToolError struct {
+	err      error
+	ExitCode int // -1 if the tool has been killed
+	Stderr   string
+}
+
+func (e *ToolError) Error() string {
+	return e.err.Error()
+}
+
+func (e *ToolError) Unwrap() error {
+	return e.err
+}
+
+// SerialWithRetries performs a serial upload like Serial, but if the upload fails
+// with a transient error it tries again up to the given number of retries.
+// Every other error is returned immediately.
+func SerialWithRetries(port, commandline string, extra Extra, retries int, l Logger) error {
+	for attempt := 1; ; attempt++ {
+		err := Serial(port, commandline, extra, l)
+		if err == nil || attempt > retries || !IsTransient(err) {
+			return err
+		}
+		info(l, fmt.Sprintf("Upload attempt %d of %d failed: %s. Retrying in %s", attempt, retries+1, err, retryDelay))
+		time.Sleep(retryDelay)
+	}
+}
+
 var cmds = map[*exec.Cmd]bool{}
 
 // Kill stops any upload process as soon as possible
@@ -125,6 +189,45 @@ func reset(port string, wait bool, l Logger) (string, error) {
 	return port, nil
 }
 
+// Touch resets the board connected to the port in bootloader mode, with the 1200bps touch.
+// If bannerTimeout is greater than zero, the port of the bootloader is then opened at the
+// given baud rate to read what the bootloader prints (e.g. its version) until the timeout expires.
+// It returns the port of the bootloader and the banner read.
+func Touch(port string, baud int, bannerTimeout time.Duration, l Logger) (string, []byte, error) {
+	port, err := reset(port, true, l)
+	if err != nil {
+		return "", nil, err
+	}
+	if bannerTimeout <= 0 {
+		return port, nil, nil
+	}
+
+	p, err := serial.Open(port, &serial.Mode{BaudRate: baud})
+	if err != nil {
+		return port, nil, errors.Wrapf(err, "Open the bootloader port")
+	}
+	defer p.Close()
+
+	var banner []byte
+	buf := make([]byte, 256)
+	deadline := time.Now().Add(bannerTimeout)
+	for remaining := bannerTimeout; remaining > 0; remaining = time.Until(deadline) {
+		if err := p.SetReadTimeout(remaining); err != nil {
+			return port, banner, err
+		}
+		n, err := p.Read(buf)
+		if err != nil {
+			return port, banner, errors.Wrapf(err, "Read the bootloader banner")
+		}
+		if n == 0 {
+			// the read timed out: the bootloader is not printing anything else
+			break
+		}
+		banner = append(banner, buf[:n]...)
+	}
+	return port, banner, nil
+}
+
 // program spawns the given binary with the given args, logging the sdtout and stderr
 // through the Logger
 func program(binary string, args []string, l Logger) error {
@@ -167,6 +270,11 @@ func program(binary string, args []string, l Logger) error {
 	if err != nil {
 		return errors.Wrapf(err, "Start command")
 	}
+	// the upload can run with the normal priority, don't fail it
+	priority := getPriority()
+	if err := setProcessPriority(cmd.Process.Pid, priority); err != nil {
+		info(l, fmt.Sprintf("Cannot set the %s priority of the upload tool, using the normal one: %s", priority, err))
+	}
 
 	stdoutCopy := bufio.NewScanner(stdout)
 	stderrCopy := bufio.NewScanner(stderr)
@@ -174,21 +282,53 @@ func program(binary string, args []string, l Logger) error {
 	stdoutCopy.Split(bufio.ScanLines)
 	stderrCopy.Split(bufio.ScanLines)
 
-	go func() {
-		for stdoutCopy.Scan() {
-			info(l, stdoutCopy.Text())
+	// keep track of the output that hints the failure can be solved with a retry
+	var transient atomic.Bool
+	// and the output of a failed verification
+	var verifyFailed atomic.Bool
+	// and the last lines of the stderr, to explain the failure
+	var stderrLines []string
+	forward := func(s *bufio.Scanner, keep *[]string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		for s.Scan() {
+			line := s.Text()
+			if keep != nil {
+				*keep = append(*keep, line)
+				if len(*keep) > maxStderrLines {
+					*keep = (*keep)[1:]
+				}
+			}
+			if transientRe.MatchString(line) {
+				transient.Store(true)
+			}
+			if verifyRe.MatchString(line) {
+				verifyFailed.Store(true)
+			}
+			info(l, line)
 		}
-	}()
+	}
 
-	go func() {
-		for stderrCopy.Scan() {
-			info(l, stderrCopy.Text())
-		}
-	}()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go forward(stdoutCopy, nil, &wg)
+	go forward(stderrCopy, &stderrLines, &wg)
+	// all the output must be read before calling Wait
+	wg.Wait()
 
 	err = cmd.Wait()
 	if err != nil {
-		return errors.Wrapf(err, "Executing command")
+		err = &ToolError{
+			err:      errors.Wrapf(err, "Executing command"),
+			ExitCode: cmd.ProcessState.ExitCode(),
+			Stderr:   strings.Join(stderrLines, "\n"),
+		}
+		if transient.Load() {
+			return &TransientError{err: err}
+		}
+		if verifyFailed.Load() {
+			return &VerifyError{err: err}
+		}
+		return err
 	}
 	return nil
 }
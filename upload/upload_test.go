@@ -17,11 +17,16 @@ package upload
 
 import (
 	"log"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
 )
 
 type mockTools struct{}
@@ -117,3 +122,81 @@ func TestFixupPort(t *testing.T) {
 		}
 	}
 }
+
+// fakeTool writes a script that fails printing the given output the first
+// time it's called, and succeeds the following ones
+func fakeTool(t *testing.T, output string) (string, string) {
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "attempts")
+	script := filepath.Join(dir, "fake-tool.sh")
+	content := "#!/bin/sh\n" +
+		"echo x >> " + counter + "\n" +
+		"if [ $(wc -l < " + counter + ") -eq 1 ]; then echo '" + output + "' >&2; exit 1; fi\n"
+	require.NoError(t, os.WriteFile(script, []byte(content), 0755))
+	return script, counter
+}
+
+func TestSerialWithRetries(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake upload tool is a shell script")
+	}
+	retryDelay = 0
+
+	t.Run("transient error is retried", func(t *testing.T) {
+		script, counter := fakeTool(t, "avrdude: stk500_recv(): programmer is not responding")
+		err := SerialWithRetries("/dev/null", script, Extra{}, 2, nil)
+		require.NoError(t, err)
+		attempts, err := os.ReadFile(counter)
+		require.NoError(t, err)
+		require.Equal(t, 2, strings.Count(string(attempts), "x"))
+	})
+
+	t.Run("other errors are not retried", func(t *testing.T) {
+		script, counter := fakeTool(t, "avrdude: verification error, first mismatch at byte 0x0000")
+		err := SerialWithRetries("/dev/null", script, Extra{}, 2, nil)
+		require.Error(t, err)
+		require.False(t, IsTransient(err))
+		require.True(t, IsVerifyError(err))
+		var toolErr *ToolError
+		require.ErrorAs(t, err, &toolErr)
+		require.Equal(t, 1, toolErr.ExitCode)
+		require.Equal(t, "avrdude: verification error, first mismatch at byte 0x0000", toolErr.Stderr)
+		attempts, err := os.ReadFile(counter)
+		require.NoError(t, err)
+		require.Equal(t, 1, strings.Count(string(attempts), "x"))
+	})
+
+	t.Run("no retries by default", func(t *testing.T) {
+		script, _ := fakeTool(t, "avrdude: stk500_getsync() attempt 10 of 10: not in sync: resp=0x00")
+		err := SerialWithRetries("/dev/null", script, Extra{}, 0, nil)
+		require.Error(t, err)
+		require.True(t, IsTransient(err))
+	})
+}
+
+func TestSetPriority(t *testing.T) {
+	defer SetPriority(PriorityNormal)
+	require.Equal(t, PriorityNormal, getPriority())
+	require.NoError(t, SetPriority(PriorityHigh))
+	require.Equal(t, PriorityHigh, getPriority())
+	require.Error(t, SetPriority("low"))
+	require.Equal(t, PriorityHigh, getPriority())
+
+	// the priority can be changed by a reload while the uploads read it
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, SetPriority(PriorityRealtime))
+		}()
+		go func() {
+			defer wg.Done()
+			require.NotEmpty(t, getPriority())
+		}()
+	}
+	wg.Wait()
+
+	// the normal priority doesn't change the process
+	require.NoError(t, setProcessPriority(os.Getpid(), PriorityNormal))
+}
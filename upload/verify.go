@@ -0,0 +1,107 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package upload
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// verifyFlags are the flags used by an upload tool to enable or disable the
+// read-back verification of the flash
+type verifyFlags struct {
+	verify   string
+	noverify string
+}
+
+// toolsVerifyFlags maps the upload tools to their verify flags.
+// The package index doesn't carry this information (it's in the platform.txt
+// of the cores) so we keep the ones of the tools supporting it here.
+var toolsVerifyFlags = map[string]verifyFlags{
+	"avrdude": {verify: "", noverify: "-V"},
+	"bossac":  {verify: "-v", noverify: ""},
+}
+
+// verifyRe matches the output of the upload tools when the verification of the flash fails
+var verifyRe = regexp.MustCompile(`(?i)verif\w*\s+(error|failed)`)
+
+// VerifyError is returned when the flash has been written but the read-back
+// verification found a mismatch
+type VerifyError struct {
+	err error
+}
+
+func (e *VerifyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.err
+}
+
+// IsVerifyError returns true if the upload failed with a VerifyError
+func IsVerifyError(err error) bool {
+	var verifyErr *VerifyError
+	return errors.As(err, &verifyErr)
+}
+
+// toolName returns the name of the executable of the commandline, e.g. avrdude
+func toolName(commandline string) string {
+	fields := strings.Fields(strings.TrimSpace(commandline))
+	if len(fields) == 0 {
+		return ""
+	}
+	name := filepath.Base(filepath.ToSlash(strings.Trim(fields[0], "\"")))
+	return strings.TrimSuffix(name, ".exe")
+}
+
+var noverifyRe = regexp.MustCompile(`(^|\s)-V(\s|$)`)
+
+// ResolveVerify sets the verify flag of the tool in the commandline.
+// The {upload.verify} symbol is replaced with the verify or noverify flag,
+// if missing the verify flag is appended when verify is true.
+// It returns an error if verify is true and the tool doesn't support it.
+func ResolveVerify(commandline string, verify bool) (string, error) {
+	tool := toolName(commandline)
+	flags, ok := toolsVerifyFlags[tool]
+	if !ok && verify {
+		return "", fmt.Errorf("the upload tool %s doesn't support the verification of the flash", tool)
+	}
+
+	if strings.Contains(commandline, "{upload.verify}") {
+		flag := flags.noverify
+		if verify {
+			flag = flags.verify
+		}
+		return strings.Replace(commandline, "{upload.verify}", flag, -1), nil
+	}
+
+	if !verify {
+		return commandline, nil
+	}
+	// avrdude verifies by default, unless disabled
+	if tool == "avrdude" {
+		commandline = noverifyRe.ReplaceAllString(commandline, " ")
+	}
+	if flags.verify != "" {
+		commandline += " " + flags.verify
+	}
+	return commandline, nil
+}
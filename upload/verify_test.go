@@ -0,0 +1,55 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package upload
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveVerify(t *testing.T) {
+	avrdude := `{runtime.tools.avrdude.path}/bin/avrdude -C{runtime.tools.avrdude.path}/etc/avrdude.conf -v {upload.verify} -patmega32u4 -P{serial.port}`
+	bossac := `"{runtime.tools.bossac.path}/bossac" -i -d --port={serial.port.file} -U true -e -w "{build.path}/{build.project_name}.bin" -R`
+
+	tests := []struct {
+		name        string
+		commandline string
+		verify      bool
+		result      string
+		err         bool
+	}{
+		{"avrdude verify symbol", avrdude, true, `{runtime.tools.avrdude.path}/bin/avrdude -C{runtime.tools.avrdude.path}/etc/avrdude.conf -v  -patmega32u4 -P{serial.port}`, false},
+		{"avrdude noverify symbol", avrdude, false, `{runtime.tools.avrdude.path}/bin/avrdude -C{runtime.tools.avrdude.path}/etc/avrdude.conf -v -V -patmega32u4 -P{serial.port}`, false},
+		{"avrdude verify removes -V", `avrdude -V -patmega328p`, true, `avrdude -patmega328p`, false},
+		{"bossac verify is appended", bossac, true, bossac + " -v", false},
+		{"bossac without verify is unchanged", bossac, false, bossac, false},
+		{"bossac.exe verify is appended", `C:/tools/bossac.exe -e -w`, true, `C:/tools/bossac.exe -e -w -v`, false},
+		{"unsupported tool", `{runtime.tools.dfu-util.path}/dfu-util -D sketch.bin`, true, "", true},
+		{"unsupported tool without verify", `{runtime.tools.dfu-util.path}/dfu-util -D sketch.bin`, false, `{runtime.tools.dfu-util.path}/dfu-util -D sketch.bin`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := ResolveVerify(test.commandline, test.verify)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.result, result)
+		})
+	}
+}
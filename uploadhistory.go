@@ -0,0 +1,157 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/arduino/arduino-create-agent/upload"
+	"github.com/gin-gonic/gin"
+)
+
+// maxUploadHistory is the number of uploads kept for each port, the oldest ones are removed
+const maxUploadHistory = 20
+
+// UploadRecord is the outcome of a completed upload
+type UploadRecord struct {
+	Board           string    `json:"board"`
+	Tool            string    `json:"tool,omitempty"`
+	Success         bool      `json:"success"`
+	Error           string    `json:"error,omitempty"`
+	StartTime       time.Time `json:"startTime"`
+	DurationSeconds float64   `json:"durationSeconds"`
+}
+
+// UploadLastError explains why the last upload on a port failed
+type UploadLastError struct {
+	UploadRecord
+	ExitCode *int   `json:"exitCode,omitempty"` // missing if the tool didn't run
+	Stderr   string `json:"stderr,omitempty"`
+}
+
+// uploadHistory keeps the outcome of the recent uploads of each port, to spot
+// the flaky boards, and the error of the last one if it failed.
+// It's kept in memory only, it's reset when the agent restarts.
+type uploadHistory struct {
+	mu         sync.Mutex
+	records    map[string][]UploadRecord
+	lastErrors map[string]UploadLastError
+}
+
+var recentUploads = uploadHistory{records: map[string][]UploadRecord{}, lastErrors: map[string]UploadLastError{}}
+
+var toolPattern = regexp.MustCompile(`\{runtime\.tools\.(.+?)\.path\}`)
+
+// uploadToolName returns the name of the tool run by the commandline, e.g. avrdude or bossac-1.7.0
+func uploadToolName(commandline string) string {
+	if m := toolPattern.FindStringSubmatch(commandline); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// add records the upload, err is the error of the failed uploads. The last error
+// of the port is replaced by err, or cleared if the upload succeeded.
+func (u *uploadHistory) add(port string, record UploadRecord, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	records := append(u.records[port], record)
+	if len(records) > maxUploadHistory {
+		records = records[len(records)-maxUploadHistory:]
+	}
+	u.records[port] = records
+
+	if err == nil {
+		delete(u.lastErrors, port)
+		return
+	}
+	lastError := UploadLastError{UploadRecord: record}
+	var toolErr *upload.ToolError
+	if errors.As(err, &toolErr) {
+		lastError.ExitCode = &toolErr.ExitCode
+		lastError.Stderr = toolErr.Stderr
+	}
+	u.lastErrors[port] = lastError
+}
+
+// getLastErrors returns the last error of a port, or of all the ports if port is empty
+func (u *uploadHistory) getLastErrors(port string) map[string]UploadLastError {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	res := map[string]UploadLastError{}
+	for p, lastError := range u.lastErrors {
+		if port == "" || p == port {
+			res[p] = lastError
+		}
+	}
+	return res
+}
+
+// get returns the uploads of a port, oldest first, or the ones of all the ports if port is empty
+func (u *uploadHistory) get(port string) map[string][]UploadRecord {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	res := map[string][]UploadRecord{}
+	for p, records := range u.records {
+		if port == "" || p == port {
+			res[p] = append([]UploadRecord{}, records...)
+		}
+	}
+	return res
+}
+
+// reset removes the uploads of a port and its last error, or the ones of all the ports if port is empty
+func (u *uploadHistory) reset(port string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if port == "" {
+		u.records = map[string][]UploadRecord{}
+		u.lastErrors = map[string]UploadLastError{}
+	} else {
+		delete(u.records, port)
+		delete(u.lastErrors, port)
+	}
+}
+
+func uploadHistoryHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, recentUploads.get(c.Query("port")))
+}
+
+// uploadLastErrorHandler returns the error of the last upload of the port, if it failed.
+// Without the port, it returns the ones of all the ports.
+func uploadLastErrorHandler(c *gin.Context) {
+	port := c.Query("port")
+	lastErrors := recentUploads.getLastErrors(port)
+	if port == "" {
+		c.JSON(http.StatusOK, lastErrors)
+		return
+	}
+	lastError, ok := lastErrors[port]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "the last upload on " + port + " didn't fail"})
+		return
+	}
+	c.JSON(http.StatusOK, lastError)
+}
+
+func resetUploadHistoryHandler(c *gin.Context) {
+	recentUploads.reset(c.Query("port"))
+	c.Status(http.StatusNoContent)
+}
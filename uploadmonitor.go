@@ -0,0 +1,115 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// uploadMonitorTimeout is the time to wait for the port to reappear after the upload
+const uploadMonitorTimeout = 10 * time.Second
+
+// MonitorOptions are the settings of the port reopened after the upload by uploadAndMonitorHandler
+type MonitorOptions struct {
+	Baud       int    `json:"baud"`
+	BufferType string `json:"bufferType"`
+}
+
+func (o *MonitorOptions) validate() error {
+	if o.Baud <= 0 {
+		return fmt.Errorf("monitor.baud is required")
+	}
+	if o.BufferType == "" {
+		o.BufferType = "default"
+	}
+	if !validBufferType(o.BufferType) {
+		return fmt.Errorf("unknown buffer type: %s", o.BufferType)
+	}
+	return nil
+}
+
+// sendMonitorStage reports the progress of an upload started by uploadAndMonitorHandler.
+// The stages are ClosePort, WaitPort, OpenPort and Monitoring, or Error.
+func sendMonitorStage(stage, port, msg string) {
+	args := map[string]string{"Cmd": "UploadAndMonitor", "Stage": stage, "Port": port}
+	if msg != "" {
+		args["Msg"] = msg
+	}
+	send(args)
+}
+
+// closeMonitoredPort closes the port before the upload, if it's open. It returns the identity
+// of the board connected to the port, to find it again if the port is renamed by the upload.
+func closeMonitoredPort(portname string) string {
+	identity := ""
+	serialPorts.portsLock.Lock()
+	if port := serialPorts.getPortByName(portname); port != nil && port.VendorID != "" {
+		identity = portIdentity(port)
+	}
+	serialPorts.portsLock.Unlock()
+
+	if port, ok := sh.FindPortByName(portname); ok {
+		sendMonitorStage("ClosePort", portname, "")
+		port.Close()
+	}
+	return identity
+}
+
+// findMonitoredPort returns the port named portname or, if it has been renamed, the port of the same board
+func findMonitoredPort(ports []*SpPortItem, portname, identity string) string {
+	renamed := ""
+	for _, port := range ports {
+		if port.Name == portname {
+			return portname
+		}
+		if identity != "" && portIdentity(port) == identity {
+			renamed = port.Name
+		}
+	}
+	return renamed
+}
+
+// reopenMonitoredPort waits for the board to reappear after the upload and opens its port again
+func reopenMonitoredPort(portname, identity string, opts MonitorOptions) {
+	sendMonitorStage("WaitPort", portname, "")
+	deadline := time.Now().Add(uploadMonitorTimeout)
+	found := ""
+	for found == "" && time.Now().Before(deadline) {
+		serialPorts.portsLock.Lock()
+		found = findMonitoredPort(serialPorts.Ports, portname, identity)
+		serialPorts.portsLock.Unlock()
+		if found == "" {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	if found == "" {
+		sendMonitorStage("Error", portname, "the port didn't reappear after the upload")
+		return
+	}
+
+	sendMonitorStage("OpenPort", found, "")
+	go spHandlerOpen(&SerialConfig{Name: found, Baud: opts.Baud}, opts.BufferType)
+	deadline = time.Now().Add(uploadMonitorTimeout)
+	for time.Now().Before(deadline) {
+		if _, ok := sh.FindPortByName(found); ok {
+			sendMonitorStage("Monitoring", found, "")
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	sendMonitorStage("Error", found, "cannot open the port after the upload")
+}
@@ -0,0 +1,208 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/arduino/arduino-create-agent/config"
+	"github.com/arduino/arduino-create-agent/index"
+	"github.com/arduino/arduino-create-agent/upload"
+	"github.com/arduino/arduino-create-agent/v2/pkgs"
+	"github.com/arduino/go-paths-helper"
+	"github.com/gin-gonic/gin"
+)
+
+// The possible status of an UploadReadiness
+const (
+	uploadReady         = "ready"
+	uploadMissingTools  = "missingTools"
+	uploadBoardNotFound = "boardNotFound"
+	uploadPortNotFound  = "portNotFound"
+)
+
+// uploadTools are the tools used to upload the sketches. The other dependencies
+// of a platform (e.g. the compilers) are not needed by the agent.
+var uploadTools = []string{
+	"avrdude", "bossac", "openocd", "dfu-util", "esptool", "esptool_py",
+	"rp2040tools", "arduino-fwuploader", "imgtool", "remoteocd",
+}
+
+// RequiredTool is a tool needed to upload a sketch on a board
+type RequiredTool struct {
+	Packager  string `json:"packager"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Installed bool   `json:"installed"`
+	// Size is the size of the archive to download, if the tool is not installed
+	Size int64 `json:"size,omitempty"`
+}
+
+// ResolvedTool is the tool run by the agent to upload on a board
+type ResolvedTool struct {
+	Packager string `json:"packager"`
+	Name     string `json:"name"`
+	// Version is the version required by the platform of the board
+	Version string `json:"version"`
+	// Path is the absolute path of the tool: the one the {runtime.tools.<name>.path} variable
+	// of the commandline resolves to if found, otherwise the one it would be downloaded to
+	Path  string `json:"path"`
+	Found bool   `json:"found"`
+	// ResolvedVersion is the version of the tool found, it differs from Version if another version
+	// of the tool has been installed after it
+	ResolvedVersion string `json:"resolvedVersion,omitempty"`
+}
+
+// UploadReadiness tells if a sketch can be uploaded on a board with the tools
+// installed, or what's missing to do it
+type UploadReadiness struct {
+	Status     string `json:"status"`
+	Fqbn       string `json:"fqbn"`
+	Recognized bool   `json:"recognized"`
+	// PlatformVersion is the version of the platform of the board whose tools are required
+	PlatformVersion string         `json:"platformVersion,omitempty"`
+	Tools           []RequiredTool `json:"tools"`
+	DownloadSize    int64          `json:"downloadSize"`
+	Port            string         `json:"port,omitempty"`
+	PortFound       bool           `json:"portFound,omitempty"`
+}
+
+// uploadReadiness checks the tools required by the latest version of the platform of the board,
+// found in the index, and if they are installed in toolsDir.
+// The board is recognized if the index contains its platform.
+func uploadReadiness(idx *index.Resource, toolsDir *paths.Path, fqbn string) (UploadReadiness, error) {
+	res := UploadReadiness{Status: uploadBoardNotFound, Fqbn: fqbn, Tools: []RequiredTool{}}
+	parts := strings.Split(fqbn, ":")
+	if len(parts) < 3 {
+		return res, nil
+	}
+
+	body, err := idx.Read()
+	if err != nil {
+		return res, err
+	}
+	var data pkgs.Index
+	if err := json.Unmarshal(body, &data); err != nil {
+		return res, err
+	}
+	platform, found := pkgs.FindPlatform(parts[0], parts[1], data)
+	if !found {
+		return res, nil
+	}
+	res.Recognized = true
+	res.PlatformVersion = platform.Version
+
+	dependencies := slices.DeleteFunc(slices.Clone(platform.ToolsDependencies), func(dep pkgs.ToolDependency) bool {
+		return !slices.Contains(uploadTools, dep.Name)
+	})
+	if len(dependencies) == 0 {
+		dependencies = platform.ToolsDependencies
+	}
+
+	res.Status = uploadReady
+	for _, dep := range dependencies {
+		tool := RequiredTool{Packager: dep.Packager, Name: dep.Name, Version: dep.Version}
+		tool.Installed = toolsDir.Join(dep.Packager, dep.Name, dep.Version).IsDir()
+		if !tool.Installed {
+			res.Status = uploadMissingTools
+			if _, system, found := pkgs.FindTool(dep.Packager, dep.Name, dep.Version, data); found {
+				tool.Size, _ = strconv.ParseInt(system.Size, 10, 64)
+				res.DownloadSize += tool.Size
+			}
+		}
+		res.Tools = append(res.Tools, tool)
+	}
+	return res, nil
+}
+
+func uploadReadinessHandler(c *gin.Context) {
+	fqbn := c.Query("fqbn")
+	if fqbn == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fqbn is required"})
+		return
+	}
+
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	res, err := uploadReadiness(Index, dataDir, fqbn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the network uploads are not supported anymore, so the port must be a serial one
+	if res.Port = c.Query("port"); res.Port != "" {
+		serialPorts.portsLock.Lock()
+		res.PortFound = serialPorts.getPortByName(res.Port) != nil
+		serialPorts.portsLock.Unlock()
+		if !res.PortFound && res.Status == uploadReady {
+			res.Status = uploadPortNotFound
+		}
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// resolveTool returns the tool the agent would run for the {runtime.tools.<name>.path}
+// variable of the commandline, as done by upload.PartiallyResolve
+func resolveTool(locater upload.Locater, toolsDir *paths.Path, tool RequiredTool) ResolvedTool {
+	res := ResolvedTool{Packager: tool.Packager, Name: tool.Name, Version: tool.Version}
+	location, err := locater.GetLocation("{runtime.tools." + tool.Name + ".path}")
+	if err != nil || location == "" {
+		res.Path = toolsDir.Join(tool.Packager, tool.Name, tool.Version).String()
+		return res
+	}
+	res.Path = filepath.FromSlash(location)
+	res.Found = true
+	res.ResolvedVersion = filepath.Base(res.Path)
+	return res
+}
+
+func uploadToolsHandler(c *gin.Context) {
+	fqbn := c.Query("fqbn")
+	if fqbn == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fqbn is required"})
+		return
+	}
+
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	readiness, err := uploadReadiness(Index, dataDir, fqbn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !readiness.Recognized {
+		c.JSON(http.StatusNotFound, gin.H{"error": "board " + fqbn + " not found in the index"})
+		return
+	}
+
+	tools := []ResolvedTool{}
+	for _, tool := range readiness.Tools {
+		tools = append(tools, resolveTool(Tools, dataDir, tool))
+	}
+	c.JSON(http.StatusOK, tools)
+}
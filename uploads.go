@@ -0,0 +1,89 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/arduino/arduino-create-agent/config"
+	"github.com/arduino/go-paths-helper"
+	log "github.com/sirupsen/logrus"
+)
+
+// orphanedUploadDirAge is the age after which the directory of an upload is
+// considered orphaned, e.g. because the agent crashed during the upload
+const orphanedUploadDirAge = 24 * time.Hour
+
+// newUploadDir creates a unique directory, inside the uploads dir, where the
+// files of an upload are saved. It must be removed when the upload completes.
+func newUploadDir() (string, error) {
+	uploadsDir, err := config.GetUploadsDir()
+	if err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(uploadsDir.String(), "upload-")
+}
+
+// removeOrphanedUploadDirs removes the directories of the uploads older than maxAge
+func removeOrphanedUploadDirs(maxAge time.Duration) {
+	// don't use GetUploadsDir to avoid creating the dir, the data dir could be read-only
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return
+	}
+	uploadsDir := dataDir.Join("uploads")
+	if uploadsDir.NotExist() {
+		return
+	}
+	dirs, err := uploadsDir.ReadDir()
+	if err != nil {
+		log.Errorf("cannot read the uploads dir: %s", err)
+		return
+	}
+	dirs.FilterDirs()
+
+	var reclaimed int64
+	removed := 0
+	for _, dir := range dirs {
+		info, err := dir.Stat()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		size := dirSize(dir)
+		if err := dir.RemoveAll(); err != nil {
+			log.Errorf("cannot remove the orphaned upload dir %s: %s", dir, err)
+			continue
+		}
+		reclaimed += size
+		removed++
+	}
+	if removed > 0 {
+		log.Infof("Removed %d orphaned upload dirs from %s, reclaimed %d bytes", removed, uploadsDir, reclaimed)
+	}
+}
+
+func dirSize(dir *paths.Path) int64 {
+	var size int64
+	filepath.Walk(dir.String(), func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadStatus tells if an upload is running, and on which port
+type UploadStatus struct {
+	InProgress bool   `json:"inProgress"`
+	Port       string `json:"port,omitempty"`
+	Board      string `json:"board,omitempty"`
+	// Progress is the last line printed by the upload tool
+	Progress       string     `json:"progress,omitempty"`
+	StartTime      *time.Time `json:"startTime,omitempty"`
+	ElapsedSeconds float64    `json:"elapsedSeconds,omitempty"`
+}
+
+// uploadTracker keeps the status of the running upload.
+// Like killupload, it assumes there's only one upload at a time.
+type uploadTracker struct {
+	mu        sync.Mutex
+	running   bool
+	port      string
+	board     string
+	progress  string
+	startTime time.Time
+}
+
+var currentUpload uploadTracker
+
+func (u *uploadTracker) start(port, board string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.running = true
+	u.port = port
+	u.board = board
+	u.progress = ""
+	u.startTime = time.Now()
+}
+
+func (u *uploadTracker) setProgress(msg string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.running {
+		u.progress = msg
+	}
+}
+
+func (u *uploadTracker) done() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.running = false
+}
+
+func (u *uploadTracker) status() UploadStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.running {
+		return UploadStatus{}
+	}
+	startTime := u.startTime
+	return UploadStatus{
+		InProgress:     true,
+		Port:           u.port,
+		Board:          u.board,
+		Progress:       u.progress,
+		StartTime:      &startTime,
+		ElapsedSeconds: time.Since(u.startTime).Seconds(),
+	}
+}
+
+func uploadStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, currentUpload.status())
+}
+
+func broadcastUploadStatus() {
+	status, _ := json.Marshal(map[string]UploadStatus{"UploadStatus": currentUpload.status()})
+	h.broadcastSys <- status
+}
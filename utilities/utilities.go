@@ -46,6 +46,12 @@ func SaveFileonTempDir(filename string, data io.Reader) (string, error) {
 	return saveFileonTempDir(tmpdir, filename, data)
 }
 
+// SaveFileonDir saves the file data as the filename in the given directory.
+// Returns an error if the filename doesn't form a valid path.
+func SaveFileonDir(dir, filename string, data io.Reader) (string, error) {
+	return saveFileonTempDir(dir, filename, data)
+}
+
 func saveFileonTempDir(tmpDir, filename string, data io.Reader) (string, error) {
 	path, err := SafeJoin(tmpDir, filename)
 	if err != nil {
@@ -129,14 +135,21 @@ func SafeJoin(parent, subdir string) (string, error) {
 	return res, nil
 }
 
-// VerifyInput will verify an input against a signature using the public key.
+// VerifyInput will verify an input against a signature using the public keys,
+// the signature is valid if any of them verifies it, e.g. during a key rotation.
 // A valid signature is indicated by returning a nil error.
-func VerifyInput(input string, signature string, pubKey *rsa.PublicKey) error {
+func VerifyInput(input string, signature string, pubKeys []*rsa.PublicKey) error {
 	sign, _ := hex.DecodeString(signature)
 	h := sha256.New()
 	h.Write([]byte(input))
 	d := h.Sum(nil)
-	return rsa.VerifyPKCS1v15(pubKey, crypto.SHA256, d, sign)
+	err := errors.New("no public key to verify the signature")
+	for _, pubKey := range pubKeys {
+		if err = rsa.VerifyPKCS1v15(pubKey, crypto.SHA256, d, sign); err == nil {
+			return nil
+		}
+	}
+	return err
 }
 
 // ParseRsaPublicKey parses a public key in PEM format and returns the rsa.PublicKey object.
@@ -169,6 +182,30 @@ func MustParseRsaPublicKey(key []byte) *rsa.PublicKey {
 	return parsedKey
 }
 
+// ParseRsaPublicKeys parses a comma separated list of public keys in PEM format.
+// Returns an error if any key is invalid.
+func ParseRsaPublicKeys(keys []byte) ([]*rsa.PublicKey, error) {
+	var publicKeys []*rsa.PublicKey
+	for i, key := range bytes.Split(keys, []byte(",")) {
+		publicKey, err := ParseRsaPublicKey(bytes.TrimSpace(key))
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i+1, err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	return publicKeys, nil
+}
+
+// MustParseRsaPublicKeys parses a comma separated list of public keys in PEM format.
+// Panics if any key is invalid.
+func MustParseRsaPublicKeys(keys []byte) []*rsa.PublicKey {
+	publicKeys, err := ParseRsaPublicKeys(keys)
+	if err != nil {
+		panic(err)
+	}
+	return publicKeys
+}
+
 // UserPrompt executes an osascript and returns the pressed button
 func UserPrompt(dialog string, buttons string, defaultButton string, toPress string, title string) bool {
 	oscmd := exec.Command("osascript", "-e", "display dialog \""+dialog+"\" buttons "+buttons+" default button\""+defaultButton+"\" with title \""+title+"\"")
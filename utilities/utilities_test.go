@@ -2,6 +2,13 @@ package utilities
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
 	"fmt"
 	"path/filepath"
 	"runtime"
@@ -46,3 +53,38 @@ func TestSaveFileonTempDirWithEvilName(t *testing.T) {
 		require.ErrorContains(t, err, "unsafe path join")
 	}
 }
+
+func TestVerifyInputWithRotatedKeys(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	toPEM := func(key *rsa.PrivateKey) string {
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		require.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+	sign := func(key *rsa.PrivateKey, input string) string {
+		sum := sha256.Sum256([]byte(input))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+		require.NoError(t, err)
+		return hex.EncodeToString(signature)
+	}
+
+	// during the rotation both the keys are accepted
+	keys, err := ParseRsaPublicKeys([]byte(toPEM(oldKey) + ",\n" + toPEM(newKey)))
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	require.NoError(t, VerifyInput("avrdude -v", sign(oldKey, "avrdude -v"), keys))
+	require.NoError(t, VerifyInput("avrdude -v", sign(newKey, "avrdude -v"), keys))
+	require.Error(t, VerifyInput("avrdude -V", sign(newKey, "avrdude -v"), keys))
+
+	// after the rotation only the new key is accepted
+	keys, err = ParseRsaPublicKeys([]byte(toPEM(newKey)))
+	require.NoError(t, err)
+	require.Error(t, VerifyInput("avrdude -v", sign(oldKey, "avrdude -v"), keys))
+	require.Error(t, VerifyInput("avrdude -v", sign(newKey, "avrdude -v"), nil))
+
+	_, err = ParseRsaPublicKeys([]byte(toPEM(newKey) + ",not a key"))
+	require.ErrorContains(t, err, "key 2")
+}
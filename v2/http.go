@@ -21,7 +21,9 @@ import (
 	"encoding/json"
 	"net/http"
 
+	serialsvr "github.com/arduino/arduino-create-agent/gen/http/serial/server"
 	toolssvr "github.com/arduino/arduino-create-agent/gen/http/tools/server"
+	serialsvc "github.com/arduino/arduino-create-agent/gen/serial"
 	toolssvc "github.com/arduino/arduino-create-agent/gen/tools"
 	"github.com/arduino/arduino-create-agent/index"
 	"github.com/arduino/arduino-create-agent/v2/pkgs"
@@ -31,8 +33,15 @@ import (
 	goamiddleware "goa.design/goa/v3/middleware"
 )
 
-// Server is the actual server
-func Server(directory string, index *index.Resource, pubKey *rsa.PublicKey) http.Handler {
+// Server is the actual server.
+// The openAPI document describing the endpoints is served on /v2/openapi.json.
+// If toolsMirror is not empty the tools are downloaded from that mirror first,
+// without verifying their signatures if mirrorUnsigned is true.
+// If toolsSignatures is false the signatures of the tools are never verified, only their checksums.
+// The failed downloads of the tools are retried up to downloadRetries times, the retries
+// and the resumed downloads are reported to toolsLogger if not nil.
+// If serialPorts is not nil the serial ports can be opened and closed on /v2/serial.
+func Server(directory string, index *index.Resource, toolsLogger func(msg string), pubKeys []*rsa.PublicKey, openAPI []byte, toolsMirror string, mirrorUnsigned, toolsSignatures bool, downloadRetries int, serialPorts SerialPorts) http.Handler {
 	mux := goahttp.NewMuxer()
 
 	// Instantiate logger
@@ -41,11 +50,29 @@ func Server(directory string, index *index.Resource, pubKey *rsa.PublicKey) http
 	logAdapter := LogAdapter{Logger: logger}
 
 	// Mount tools
-	toolsSvc := pkgs.New(index, directory, "replace", pubKey)
+	toolsSvc := pkgs.New(index, directory, "replace", pubKeys)
+	toolsSvc.SetMirror(toolsMirror)
+	toolsSvc.SetMirrorUnsigned(mirrorUnsigned)
+	toolsSvc.SetVerifySignatures(toolsSignatures)
+	toolsSvc.SetRetries(downloadRetries)
+	toolsSvc.SetLogger(toolsLogger)
 	toolsEndpoints := toolssvc.NewEndpoints(toolsSvc)
 	toolsServer := toolssvr.New(toolsEndpoints, mux, CustomRequestDecoder, goahttp.ResponseEncoder, errorHandler(logger), nil)
 	toolssvr.Mount(mux, toolsServer)
 
+	// Mount serial, the data of the ports is streamed on the websocket
+	if serialPorts != nil {
+		serialEndpoints := serialsvc.NewEndpoints(serialService{ports: serialPorts})
+		serialServer := serialsvr.New(serialEndpoints, mux, CustomRequestDecoder, goahttp.ResponseEncoder, errorHandler(logger), nil)
+		serialsvr.Mount(mux, serialServer)
+	}
+
+	// Mount the API description
+	mux.Handle("GET", "/v2/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPI)
+	})
+
 	// Mount middlewares
 	handler := middleware.Log(logAdapter)(mux)
 	handler = middleware.RequestID()(handler)
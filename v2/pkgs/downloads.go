@@ -0,0 +1,142 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package pkgs
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDownloadNotFound is returned when cancelling a download not in progress
+var ErrDownloadNotFound = errors.New("download not found")
+
+// DownloadStatus is the status of a tool download in progress
+type DownloadStatus struct {
+	ID         string    `json:"id"`
+	Tool       string    `json:"tool"` // packager/name/version
+	URL        string    `json:"url"`
+	Downloaded int64     `json:"downloaded"`
+	Total      int64     `json:"total"` // -1 if the size is unknown
+	Speed      float64   `json:"speed"` // bytes per second
+	StartedAt  time.Time `json:"startedAt"`
+}
+
+// toolDownload tracks a download in progress, it's shared by all the Tools
+// so that the downloads can be listed and cancelled from everywhere
+type toolDownload struct {
+	id         string
+	tool       string
+	started    time.Time
+	cancel     context.CancelFunc
+	downloaded atomic.Int64
+
+	mu    sync.Mutex
+	url   string
+	total int64
+}
+
+var (
+	downloads      = map[string]*toolDownload{}
+	downloadsMutex sync.Mutex
+	lastDownloadID atomic.Uint64
+)
+
+// startDownload tracks a new download of the tool, the returned context is
+// cancelled by CancelDownload. The returned function must be called when the download ends.
+func startDownload(ctx context.Context, tool string) (context.Context, *toolDownload, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	d := &toolDownload{
+		id:      strconv.FormatUint(lastDownloadID.Add(1), 10),
+		tool:    tool,
+		started: time.Now(),
+		cancel:  cancel,
+	}
+	downloadsMutex.Lock()
+	downloads[d.id] = d
+	downloadsMutex.Unlock()
+
+	return ctx, d, func() {
+		downloadsMutex.Lock()
+		delete(downloads, d.id)
+		downloadsMutex.Unlock()
+		cancel()
+	}
+}
+
+// setSource is called when the download from url starts, e.g. after falling back from the mirror
+func (d *toolDownload) setSource(url string, total int64) {
+	d.mu.Lock()
+	d.url = url
+	d.total = total
+	d.mu.Unlock()
+	d.downloaded.Store(0)
+}
+
+// Write counts the bytes downloaded
+func (d *toolDownload) Write(p []byte) (int, error) {
+	d.downloaded.Add(int64(len(p)))
+	return len(p), nil
+}
+
+func (d *toolDownload) status() DownloadStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	downloaded := d.downloaded.Load()
+	status := DownloadStatus{
+		ID:         d.id,
+		Tool:       d.tool,
+		URL:        d.url,
+		Downloaded: downloaded,
+		Total:      d.total,
+		StartedAt:  d.started,
+	}
+	if elapsed := time.Since(d.started).Seconds(); elapsed > 0 {
+		status.Speed = float64(downloaded) / elapsed
+	}
+	return status
+}
+
+// Downloads returns the tool downloads in progress
+func Downloads() []DownloadStatus {
+	downloadsMutex.Lock()
+	defer downloadsMutex.Unlock()
+	res := []DownloadStatus{}
+	for _, d := range downloads {
+		res = append(res, d.status())
+	}
+	slices.SortFunc(res, func(a, b DownloadStatus) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+	return res
+}
+
+// CancelDownload cancels the tool download with the given id.
+// The downloaded data is discarded and the tool is not installed.
+func CancelDownload(id string) error {
+	downloadsMutex.Lock()
+	defer downloadsMutex.Unlock()
+	d, ok := downloads[id]
+	if !ok {
+		return ErrDownloadNotFound
+	}
+	d.cancel()
+	return nil
+}
@@ -21,17 +21,38 @@
 // cores, and to download tools used for upload.
 package pkgs
 
-import "regexp"
+import (
+	"regexp"
+
+	"github.com/blang/semver"
+)
 
 // Index is the go representation of a typical
 // package-index file, stripped from every non-used field.
 type Index struct {
 	Packages []struct {
-		Name  string `json:"name"`
-		Tools []Tool `json:"tools"`
+		Name      string     `json:"name"`
+		Tools     []Tool     `json:"tools"`
+		Platforms []Platform `json:"platforms"`
 	} `json:"packages"`
 }
 
+// Platform is the go representation of the info about a
+// platform contained in a package-index file, stripped from
+// every non-used field.
+type Platform struct {
+	Architecture      string           `json:"architecture"`
+	Version           string           `json:"version"`
+	ToolsDependencies []ToolDependency `json:"toolsDependencies"`
+}
+
+// ToolDependency is a tool required by a platform
+type ToolDependency struct {
+	Packager string `json:"packager"`
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+}
+
 // Tool is the go representation of the info about a
 // tool contained in a package-index file, stripped from
 // every non-used field.
@@ -48,6 +69,7 @@ type System struct {
 	URL      string `json:"url"`
 	Name     string `json:"archiveFileName"`
 	Checksum string `json:"checksum"`
+	Size     string `json:"size"`
 }
 
 // Source: https://github.com/arduino/arduino-cli/blob/master/internal/arduino/cores/tools.go#L129-L142
@@ -139,3 +161,26 @@ func (t *Tool) GetFlavourCompatibleWith(osName, osArch string) System {
 
 	return correctSystem
 }
+
+// FindPlatform returns the latest version of the platform of the given packager and architecture
+func FindPlatform(pack, arch string, data Index) (Platform, bool) {
+	var latest Platform
+	found := false
+	for _, p := range data.Packages {
+		if p.Name != pack {
+			continue
+		}
+		for _, platform := range p.Platforms {
+			if platform.Architecture != arch {
+				continue
+			}
+			v1, _ := semver.ParseTolerant(platform.Version)
+			v2, _ := semver.ParseTolerant(latest.Version)
+			if !found || v1.Compare(v2) > 0 {
+				latest = platform
+				found = true
+			}
+		}
+	}
+	return latest, found
+}
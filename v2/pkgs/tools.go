@@ -26,25 +26,41 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/arduino/arduino-create-agent/gen/tools"
 	"github.com/arduino/arduino-create-agent/index"
 	"github.com/arduino/arduino-create-agent/utilities"
 	"github.com/blang/semver"
 	"github.com/codeclysm/extract/v4"
+	"github.com/sirupsen/logrus"
 )
 
 // public vars to allow override in the tests
 var (
 	OS   = runtime.GOOS
 	Arch = runtime.GOARCH
+	// Keyring is used to verify the detached signatures of the tools archives
+	Keyring, keyringErr = index.Keyring()
+	// RetryDelay is the wait before retrying a failed download, it doubles after each attempt
+	RetryDelay = time.Second
+	// SignedHosts are the hosts publishing the detached signatures of the archives. The index lists
+	// also tools hosted elsewhere, e.g. on github.com, without a signature: they're verified only
+	// with the checksum of the signed index.
+	SignedHosts = []string{"downloads.arduino.cc"}
 )
 
+// maxRetryDelay is the longest wait between the attempts of a download
+const maxRetryDelay = 30 * time.Second
+
 // Tools is a client that implements github.com/arduino/arduino-create-agent/gen/tools.Service interface.
 // It saves tools in a specified folder with this structure: packager/name/version
 // For example:
@@ -59,25 +75,30 @@ var (
 //
 // It requires an Index Resource to search for tools
 type Tools struct {
-	index                 *index.Resource
-	folder                string
-	behaviour             string
-	installed             map[string]string
-	mutex                 sync.RWMutex
-	verifySignaturePubKey *rsa.PublicKey // public key used to verify the signature of a command sent to the boards
+	index                  *index.Resource
+	folder                 string
+	behaviour              string
+	installed              map[string]string
+	mutex                  sync.RWMutex
+	verifySignaturePubKeys []*rsa.PublicKey // public keys used to verify the signature of a command sent to the boards
+	mirror                 string           // base URL of a mirror of the tools downloads, tried before the original URL
+	mirrorUnsigned         bool             // if true the signatures of the archives downloaded from the mirror are not verified
+	skipSignatures         bool             // if true the signatures of the archives are never verified, only their checksums
+	retries                int              // number of times a failed download is retried
+	logger                 func(msg string)
 }
 
 // New will return a Tool object, allowing the caller to execute operations on it.
 // The New function will accept an index as parameter (used to download the indexes)
 // and a folder used to download the indexes
-func New(index *index.Resource, folder, behaviour string, verifySignaturePubKey *rsa.PublicKey) *Tools {
+func New(index *index.Resource, folder, behaviour string, verifySignaturePubKeys []*rsa.PublicKey) *Tools {
 	t := &Tools{
-		index:                 index,
-		folder:                folder,
-		behaviour:             behaviour,
-		installed:             map[string]string{},
-		mutex:                 sync.RWMutex{},
-		verifySignaturePubKey: verifySignaturePubKey,
+		index:                  index,
+		folder:                 folder,
+		behaviour:              behaviour,
+		installed:              map[string]string{},
+		mutex:                  sync.RWMutex{},
+		verifySignaturePubKeys: verifySignaturePubKeys,
 	}
 	t.readInstalled()
 	return t
@@ -162,6 +183,31 @@ func (t *Tools) Installed(ctx context.Context) (tools.ToolCollection, error) {
 	return res, nil
 }
 
+// Installedversions crawles the Tools Folder like Installed, but it groups the versions of each tool
+// and it returns where the tool is installed.
+func (t *Tools) Installedversions(ctx context.Context) (tools.InstalledToolCollection, error) {
+	installed, err := t.Installed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := tools.InstalledToolCollection{}
+	for _, tool := range installed {
+		// the versions of the same tool are listed one after the other
+		if n := len(res); n > 0 && res[n-1].Packager == tool.Packager && res[n-1].Name == tool.Name {
+			res[n-1].Versions = append(res[n-1].Versions, tool.Version)
+			continue
+		}
+		res = append(res, &tools.InstalledTool{
+			Packager: tool.Packager,
+			Name:     tool.Name,
+			Versions: []string{tool.Version},
+			Path:     filepath.Join(t.folder, tool.Packager, tool.Name),
+		})
+	}
+	return res, nil
+}
+
 // Install crawles the Index folder, downloads the specified tool, extracts the archive in the Tools Folder.
 // It checks for the Signature specified in the package index.
 func (t *Tools) Install(ctx context.Context, payload *tools.ToolPayload) (*tools.Operation, error) {
@@ -169,14 +215,14 @@ func (t *Tools) Install(ctx context.Context, payload *tools.ToolPayload) (*tools
 
 	//if URL is defined and is signed we verify the signature and override the name, payload, version parameters
 	if payload.URL != nil && payload.Signature != nil && payload.Checksum != nil {
-		err := utilities.VerifyInput(*payload.URL, *payload.Signature, t.verifySignaturePubKey)
+		err := utilities.VerifyInput(*payload.URL, *payload.Signature, t.verifySignaturePubKeys)
 		if err != nil {
 			return nil, err
 		}
-		return t.install(ctx, path, *payload.URL, *payload.Checksum)
+		return t.install(ctx, path, *payload.URL, *payload.Checksum, true)
 	}
 
-	// otherwise we install from the default index
+	// otherwise we install from the default index, merged with the additional ones if any
 	body, err := t.index.Read()
 	if err != nil {
 		return nil, err
@@ -202,7 +248,12 @@ func (t *Tools) Install(ctx context.Context, payload *tools.ToolPayload) (*tools
 		}
 	}
 	if found {
-		return t.install(ctx, path, correctSystem.URL, correctSystem.Checksum)
+		signed := true
+		if src := t.index.ToolSource(payload.Packager, correctTool.Name, correctTool.Version); src != "" {
+			logrus.Infof("Tool %s found in the index %s", filepath.ToSlash(path), src)
+			signed = !t.index.IsUnsigned(src)
+		}
+		return t.install(ctx, path, correctSystem.URL, correctSystem.Checksum, signed)
 	}
 
 	return nil, tools.MakeNotFound(
@@ -210,29 +261,12 @@ func (t *Tools) Install(ctx context.Context, payload *tools.ToolPayload) (*tools
 			payload.Packager, payload.Name, payload.Version))
 }
 
-func (t *Tools) install(ctx context.Context, path, url, checksum string) (*tools.Operation, error) {
+func (t *Tools) install(ctx context.Context, path, url, checksum string, signed bool) (*tools.Operation, error) {
 	// Download the archive
-	res, err := http.Get(url)
+	buffer, err := t.download(ctx, filepath.ToSlash(path), url, checksum, signed)
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-
-	var buffer bytes.Buffer
-
-	// We copy the body of the response to a buffer to calculate the checksum
-	_, err = io.Copy(&buffer, res.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	// Check the checksum
-	sum := sha256.Sum256(buffer.Bytes())
-	sumString := "SHA-256:" + hex.EncodeToString(sum[:sha256.Size])
-
-	if sumString != checksum {
-		return nil, errors.New("checksum of downloaded file doesn't match, expected: " + checksum + " got: " + sumString)
-	}
 
 	safePath, err := utilities.SafeJoin(t.folder, path)
 	if err != nil {
@@ -245,7 +279,7 @@ func (t *Tools) install(ctx context.Context, path, url, checksum string) (*tools
 		return nil, err
 	}
 
-	err = extract.Archive(ctx, &buffer, t.folder, rename(path))
+	err = extract.Archive(ctx, buffer, t.folder, rename(path))
 	if err != nil {
 		os.RemoveAll(safePath)
 		return nil, err
@@ -260,6 +294,177 @@ func (t *Tools) install(ctx context.Context, path, url, checksum string) (*tools
 	return &tools.Operation{Status: "ok"}, nil
 }
 
+// download downloads the archive at the given url and checks its checksum and its signature.
+// If a mirror is set the archive is downloaded from the mirror first,
+// falling back to the original url if it's not available there or it's not correctly signed.
+// The download can be cancelled with CancelDownload while it's in progress.
+// If signed is false, e.g. for the tools of an unsigned index, only the checksum is verified.
+// The same happens for the archives not hosted on the SignedHosts or if the signatures are disabled.
+func (t *Tools) download(ctx context.Context, tool, archiveURL, checksum string, signed bool) (*bytes.Buffer, error) {
+	ctx, d, done := startDownload(ctx, tool)
+	defer done()
+
+	verify := signed && !t.skipSignatures && signedHost(archiveURL)
+	if signed && !verify {
+		logrus.Infof("Signature of %s not verified, it's checked with the checksum of the signed index", archiveURL)
+	}
+
+	if t.mirror != "" {
+		mirrorURL, err := getMirrorURL(t.mirror, archiveURL)
+		if err == nil {
+			var buffer *bytes.Buffer
+			if buffer, err = t.downloadAndCheck(ctx, mirrorURL, checksum, d); err == nil {
+				if t.mirrorUnsigned || !verify {
+					logrus.Warnf("Signature of %s not verified, it has been downloaded from the mirror %s", archiveURL, mirrorURL)
+					return buffer, nil
+				}
+				if err = checkSignature(ctx, mirrorURL, buffer); err == nil {
+					logrus.Infof("Downloaded %s from the mirror %s", archiveURL, mirrorURL)
+					return buffer, nil
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("download of %s cancelled", tool)
+		}
+		logrus.Warnf("Cannot download %s from the mirror, falling back to the original url: %s", archiveURL, err)
+	}
+
+	buffer, err := t.downloadAndCheck(ctx, archiveURL, checksum, d)
+	if err == nil && !signed {
+		logrus.Warnf("Signature of %s not verified, the tool comes from an unsigned index", archiveURL)
+	} else if err == nil && verify {
+		err = checkSignature(ctx, archiveURL, buffer)
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("download of %s cancelled", tool)
+	} else if err != nil {
+		return nil, err
+	}
+	logrus.Infof("Downloaded %s", archiveURL)
+	return buffer, nil
+}
+
+// signedHost returns true if the archive is hosted on one of the SignedHosts
+func signedHost(archiveURL string) bool {
+	u, err := url.Parse(archiveURL)
+	return err == nil && slices.Contains(SignedHosts, u.Hostname())
+}
+
+// checkSignature downloads the detached signature of the archive, published next to it
+// with the .sig extension, and verifies it with the Keyring.
+func checkSignature(ctx context.Context, archiveURL string, archive *bytes.Buffer) error {
+	if len(Keyring) == 0 {
+		if keyringErr != nil {
+			return fmt.Errorf("cannot verify the signature of %s, the keyring of the Arduino keys cannot be loaded: %w", archiveURL, keyringErr)
+		}
+		return fmt.Errorf("cannot verify the signature of %s, the keyring of the Arduino keys is empty", archiveURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, archiveURL+".sig", nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot download the signature of %s: %s", archiveURL, res.Status)
+	}
+
+	if _, err := openpgp.CheckDetachedSignature(Keyring, bytes.NewReader(archive.Bytes()), res.Body, nil); err != nil {
+		logrus.Errorf("Signature of %s is not valid: %s", archiveURL, err)
+		return fmt.Errorf("signature of %s is not valid: %w", archiveURL, err)
+	}
+	logrus.Infof("Signature of %s verified", archiveURL)
+	return nil
+}
+
+// getMirrorURL rewrites the url of an archive to point to the mirror, keeping its path, e.g.
+// https://downloads.arduino.cc/tools/bossac.tar.gz -> http://mirror.local/arduino/tools/bossac.tar.gz
+func getMirrorURL(mirror, archiveURL string) (string, error) {
+	u, err := url.Parse(archiveURL)
+	if err != nil {
+		return "", err
+	}
+	return url.JoinPath(mirror, u.Path)
+}
+
+// downloadAndCheck downloads the archive and checks its checksum. A failed download is retried
+// up to t.retries times, resuming it from where it stopped if the server supports the range requests.
+func (t *Tools) downloadAndCheck(ctx context.Context, archiveURL, checksum string, d *toolDownload) (*bytes.Buffer, error) {
+	var buffer bytes.Buffer
+	for attempt := 0; ; attempt++ {
+		resumable, retry, err := downloadTo(ctx, archiveURL, &buffer, d)
+		if err == nil {
+			break
+		}
+		if !retry || attempt >= t.retries || ctx.Err() != nil {
+			return nil, err
+		}
+		if !resumable {
+			buffer.Reset()
+		}
+		delay := min(RetryDelay<<attempt, maxRetryDelay)
+		t.log(fmt.Sprintf("Download of %s failed, retrying in %s (%d/%d): %s", archiveURL, delay, attempt+1, t.retries, err))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		if buffer.Len() > 0 {
+			t.log(fmt.Sprintf("Resuming the download of %s from %d bytes", archiveURL, buffer.Len()))
+		}
+	}
+
+	// Check the checksum
+	sum := sha256.Sum256(buffer.Bytes())
+	sumString := "SHA-256:" + hex.EncodeToString(sum[:sha256.Size])
+
+	if sumString != checksum {
+		return nil, errors.New("checksum of downloaded file doesn't match, expected: " + checksum + " got: " + sumString)
+	}
+	return &buffer, nil
+}
+
+// downloadTo appends the archive to the buffer, asking only for the missing part if the buffer isn't empty.
+// It returns if the server supports the range requests, to resume the download, and if the error is worth a retry.
+func downloadTo(ctx context.Context, archiveURL string, buffer *bytes.Buffer, d *toolDownload) (resumable, retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, archiveURL, nil)
+	if err != nil {
+		return false, false, err
+	}
+	if buffer.Len() > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", buffer.Len()))
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, true, err
+	}
+	defer res.Body.Close()
+	resumable = res.Header.Get("Accept-Ranges") == "bytes"
+
+	switch {
+	case res.StatusCode == http.StatusOK:
+		// the whole archive, e.g. the server ignored the range
+		buffer.Reset()
+		d.setSource(archiveURL, res.ContentLength)
+	case res.StatusCode == http.StatusPartialContent && buffer.Len() > 0:
+		if !strings.HasPrefix(res.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", buffer.Len())) {
+			return false, true, fmt.Errorf("cannot resume the download of %s: unexpected range %s", archiveURL, res.Header.Get("Content-Range"))
+		}
+		// the partial content is served only by the servers supporting the ranges
+		resumable = true
+	default:
+		return resumable, res.StatusCode >= http.StatusInternalServerError, fmt.Errorf("cannot download %s: %s", archiveURL, res.Status)
+	}
+
+	// We copy the body of the response to a buffer to calculate the checksum
+	_, err = io.Copy(io.MultiWriter(buffer, d), res.Body)
+	return resumable, true, err
+}
+
 // Remove deletes the tool folder from Tools Folder
 func (t *Tools) Remove(ctx context.Context, payload *tools.ToolPayload) (*tools.Operation, error) {
 	path := filepath.Join(payload.Packager, payload.Name, payload.Version)
@@ -339,6 +544,42 @@ func (t *Tools) SetBehaviour(behaviour string) {
 	t.behaviour = behaviour
 }
 
+// SetMirror sets the base URL of a mirror of the tools downloads.
+// The tools are downloaded from the mirror first, keeping the path of their original URL.
+func (t *Tools) SetMirror(mirror string) {
+	t.mirror = mirror
+}
+
+// SetMirrorUnsigned disables the verification of the signatures of the archives downloaded
+// from the mirror, for the mirrors not providing them.
+// The archives downloaded from the original URL are always verified.
+func (t *Tools) SetMirrorUnsigned(unsigned bool) {
+	t.mirrorUnsigned = unsigned
+}
+
+// SetVerifySignatures enables the verification of the signatures of the archives hosted on
+// the SignedHosts, the default. If it's disabled only their checksums are verified.
+func (t *Tools) SetVerifySignatures(verify bool) {
+	t.skipSignatures = !verify
+}
+
+// SetRetries sets the number of times a failed download is retried, waiting longer after each attempt
+func (t *Tools) SetRetries(retries int) {
+	t.retries = retries
+}
+
+// SetLogger sets the function reporting the progress of the downloads, e.g. when they are retried
+func (t *Tools) SetLogger(logger func(msg string)) {
+	t.logger = logger
+}
+
+func (t *Tools) log(msg string) {
+	logrus.Info(msg)
+	if t.logger != nil {
+		t.logger(msg)
+	}
+}
+
 func (t *Tools) getInstalledValue(key string) (string, bool) {
 	t.mutex.RLock()
 	defer t.mutex.RUnlock()
@@ -16,13 +16,24 @@
 package pkgs_test
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/arduino/arduino-create-agent/config"
 	"github.com/arduino/arduino-create-agent/gen/tools"
 	"github.com/arduino/arduino-create-agent/globals"
@@ -45,9 +56,11 @@ func TestTools(t *testing.T) {
 
 	indexURL := "https://downloads.arduino.cc/packages/package_index.json"
 	// Instantiate Index
-	Index := index.Init(indexURL, config.GetDataDir())
+	dataDir, err := config.GetDataDir()
+	require.NoError(t, err)
+	Index := index.Init(indexURL, dataDir)
 
-	service := pkgs.New(Index, tmp, "replace", utilities.MustParseRsaPublicKey([]byte(globals.ArduinoSignaturePubKey)))
+	service := pkgs.New(Index, tmp, "replace", utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
 
 	ctx := context.Background()
 
@@ -126,9 +139,11 @@ func TestEvilFilename(t *testing.T) {
 
 	indexURL := "https://downloads.arduino.cc/packages/package_index.json"
 	// Instantiate Index
-	Index := index.Init(indexURL, config.GetDataDir())
+	dataDir, err := config.GetDataDir()
+	require.NoError(t, err)
+	Index := index.Init(indexURL, dataDir)
 
-	service := pkgs.New(Index, tmp, "replace", utilities.MustParseRsaPublicKey([]byte(globals.ArduinoSignaturePubKey)))
+	service := pkgs.New(Index, tmp, "replace", utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
 
 	ctx := context.Background()
 
@@ -195,14 +210,38 @@ func TestInstalledHead(t *testing.T) {
 
 	indexURL := "https://downloads.arduino.cc/packages/package_index.json"
 	// Instantiate Index
-	Index := index.Init(indexURL, config.GetDataDir())
+	dataDir, err := config.GetDataDir()
+	require.NoError(t, err)
+	Index := index.Init(indexURL, dataDir)
 
-	service := pkgs.New(Index, tmp, "replace", utilities.MustParseRsaPublicKey([]byte(globals.ArduinoSignaturePubKey)))
+	service := pkgs.New(Index, tmp, "replace", utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
 
 	ctx := context.Background()
 
-	err := service.Installedhead(ctx)
+	err = service.Installedhead(ctx)
+	require.NoError(t, err)
+}
+
+func TestInstalledversions(t *testing.T) {
+	tmp := t.TempDir()
+	for _, dir := range []string{"arduino/avrdude/6.3.0-arduino17", "arduino/bossac/1.7.0", "arduino/bossac/1.9.1-arduino2", "esp32/esptool/4.5.1"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(tmp, dir), 0755))
+	}
+
+	// the index isn't needed to list the installed tools, so it's not downloaded
+	dataDir, err := config.GetDataDir()
+	require.NoError(t, err)
+	Index := index.New("https://downloads.arduino.cc/packages/package_index.json", dataDir)
+
+	service := pkgs.New(Index, tmp, "replace", utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
+
+	installed, err := service.Installedversions(context.Background())
 	require.NoError(t, err)
+	require.Equal(t, tools.InstalledToolCollection{
+		{Packager: "arduino", Name: "avrdude", Versions: []string{"6.3.0-arduino17"}, Path: filepath.Join(tmp, "arduino", "avrdude")},
+		{Packager: "arduino", Name: "bossac", Versions: []string{"1.7.0", "1.9.1-arduino2"}, Path: filepath.Join(tmp, "arduino", "bossac")},
+		{Packager: "esp32", Name: "esptool", Versions: []string{"4.5.1"}, Path: filepath.Join(tmp, "esp32", "esptool")},
+	}, installed)
 }
 
 func strpoint(s string) *string {
@@ -218,7 +257,7 @@ func TestInstall(t *testing.T) {
 		LastRefresh: time.Now(),
 	}
 
-	tool := pkgs.New(testIndex, tmp, "replace", utilities.MustParseRsaPublicKey([]byte(globals.ArduinoSignaturePubKey)))
+	tool := pkgs.New(testIndex, tmp, "replace", utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
 
 	ctx := context.Background()
 
@@ -276,3 +315,337 @@ func TestInstall(t *testing.T) {
 	}
 
 }
+
+func TestInstallFromMirror(t *testing.T) {
+	archive, signature := testToolArchive(t)
+	sum := sha256.Sum256(archive)
+
+	serve := func(hits *int, available bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, ".sig") {
+				w.Write(signature)
+				return
+			}
+			*hits++
+			if !available {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(archive)
+		}))
+	}
+	var originHits, mirrorHits, missingMirrorHits int
+	origin := serve(&originHits, true)
+	defer origin.Close()
+	mirror := serve(&mirrorHits, true)
+	defer mirror.Close()
+	missingMirror := serve(&missingMirrorHits, false)
+	defer missingMirror.Close()
+
+	testIndex := testToolIndex(t, origin.URL+"/tools/tool-1.0.0.tar.gz", sum[:])
+
+	payload := &tools.ToolPayload{Name: "tool", Version: "1.0.0", Packager: "test"}
+	ctx := context.Background()
+
+	tmp := t.TempDir()
+	tool := pkgs.New(testIndex, tmp, "replace", utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
+	tool.SetMirror(mirror.URL + "/arduino")
+	_, err := tool.Install(ctx, payload)
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(tmp, "test", "tool", "1.0.0", "tool"))
+	require.Equal(t, 1, mirrorHits)
+	require.Equal(t, 0, originHits)
+
+	// if the tool is not on the mirror it's downloaded from the original url
+	tool.SetMirror(missingMirror.URL)
+	_, err = tool.Install(ctx, payload)
+	require.NoError(t, err)
+	require.Equal(t, 1, missingMirrorHits)
+	require.Equal(t, 1, originHits)
+}
+
+func TestInstallSignature(t *testing.T) {
+	archive, signature := testToolArchive(t)
+	sum := sha256.Sum256(archive)
+
+	tampered := bytes.Clone(signature)
+	tampered[len(tampered)-1] ^= 0xff
+	otherKey, err := openpgp.NewEntity("Other", "", "other@example.com", nil)
+	require.NoError(t, err)
+	var otherSignature bytes.Buffer
+	require.NoError(t, openpgp.DetachSign(&otherSignature, otherKey, bytes.NewReader(archive), nil))
+
+	var sig []byte
+	var mirrorSig []byte
+	serve := func(sig *[]byte) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, ".sig") {
+				w.Write(archive)
+			} else if *sig == nil {
+				http.NotFound(w, r)
+			} else {
+				w.Write(*sig)
+			}
+		}))
+	}
+	origin := serve(&sig)
+	defer origin.Close()
+	mirror := serve(&mirrorSig)
+	defer mirror.Close()
+
+	testIndex := testToolIndex(t, origin.URL+"/tools/tool-1.0.0.tar.gz", sum[:])
+	payload := &tools.ToolPayload{Name: "tool", Version: "1.0.0", Packager: "test"}
+	ctx := context.Background()
+	tmp := t.TempDir()
+	toolFile := filepath.Join(tmp, "test", "tool", "1.0.0", "tool")
+	tool := pkgs.New(testIndex, tmp, "replace", utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
+
+	t.Run("valid", func(t *testing.T) {
+		sig = signature
+		_, err := tool.Install(ctx, payload)
+		require.NoError(t, err)
+		require.FileExists(t, toolFile)
+		require.NoError(t, os.RemoveAll(tmp))
+	})
+
+	for name, s := range map[string][]byte{"unsigned": nil, "tampered": tampered, "other key": otherSignature.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			sig = s
+			_, err := tool.Install(ctx, payload)
+			require.Error(t, err)
+			require.NoFileExists(t, toolFile)
+		})
+	}
+
+	t.Run("no keyring", func(t *testing.T) {
+		defer func(keyring openpgp.EntityList) { pkgs.Keyring = keyring }(pkgs.Keyring)
+		pkgs.Keyring = nil
+		sig = signature
+		_, err := tool.Install(ctx, payload)
+		require.ErrorContains(t, err, "keyring")
+		require.NoFileExists(t, toolFile)
+	})
+
+	t.Run("mirror", func(t *testing.T) {
+		// a badly signed archive on the mirror is downloaded again from the original url
+		sig, mirrorSig = signature, tampered
+		tool.SetMirror(mirror.URL)
+		_, err := tool.Install(ctx, payload)
+		require.NoError(t, err)
+		require.FileExists(t, toolFile)
+		require.NoError(t, os.RemoveAll(tmp))
+
+		// unless the signatures of the mirror are not verified
+		sig, mirrorSig = nil, nil
+		_, err = tool.Install(ctx, payload)
+		require.Error(t, err)
+		tool.SetMirrorUnsigned(true)
+		_, err = tool.Install(ctx, payload)
+		require.NoError(t, err)
+		require.FileExists(t, toolFile)
+	})
+}
+
+func TestInstallWithoutSignature(t *testing.T) {
+	archive, _ := testToolArchive(t)
+	sum := sha256.Sum256(archive)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".sig") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	payload := &tools.ToolPayload{Name: "tool", Version: "1.0.0", Packager: "test"}
+	ctx := context.Background()
+
+	t.Run("third-party host", func(t *testing.T) {
+		// the signatures are published only by the SignedHosts, e.g. not by github.com
+		thirdParty := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+		tmp := t.TempDir()
+		tool := pkgs.New(testToolIndex(t, thirdParty+"/tool-1.0.0.tar.gz", sum[:]), tmp, "replace", utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
+		_, err := tool.Install(ctx, payload)
+		require.NoError(t, err)
+		require.FileExists(t, filepath.Join(tmp, "test", "tool", "1.0.0", "tool"))
+	})
+
+	t.Run("signatures disabled", func(t *testing.T) {
+		tmp := t.TempDir()
+		tool := pkgs.New(testToolIndex(t, server.URL+"/tool-1.0.0.tar.gz", sum[:]), tmp, "replace", utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
+		_, err := tool.Install(ctx, payload)
+		require.ErrorContains(t, err, "cannot download the signature")
+
+		tool.SetVerifySignatures(false)
+		_, err = tool.Install(ctx, payload)
+		require.NoError(t, err)
+		require.FileExists(t, filepath.Join(tmp, "test", "tool", "1.0.0", "tool"))
+	})
+}
+
+func TestInstallFromUnsignedIndex(t *testing.T) {
+	archive, _ := testToolArchive(t)
+	sum := sha256.Sum256(archive)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".sig") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	// the tool of the additional index is not signed
+	dir := paths.New(t.TempDir())
+	mainURL, extraURL := server.URL+"/package_index.json", server.URL+"/package_extra_index.json"
+	idx := index.New(mainURL+","+extraURL, dir)
+	require.NoError(t, idx.IndexFile.WriteFile([]byte(`{"packages": []}`)))
+	require.NoError(t, dir.Join("extra1_package_extra_index.json").WriteFile([]byte(`{"packages": [{"name": "test", "tools": [{"name": "tool", "version": "1.0.0", "systems": [{
+		"host": "all",
+		"url": "`+server.URL+`/tools/tool-1.0.0.tar.gz",
+		"archiveFileName": "tool-1.0.0.tar.gz",
+		"checksum": "SHA-256:`+hex.EncodeToString(sum[:])+`"
+	}]}]}]}`)))
+	idx.LastRefresh = time.Now()
+
+	tmp := t.TempDir()
+	tool := pkgs.New(idx, tmp, "replace", utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
+	payload := &tools.ToolPayload{Name: "tool", Version: "1.0.0", Packager: "test"}
+	_, err := tool.Install(context.Background(), payload)
+	require.Error(t, err)
+
+	// unless the index is unsigned, then only the checksum is verified
+	require.NoError(t, idx.SetUnsigned(extraURL))
+	_, err = tool.Install(context.Background(), payload)
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(tmp, "test", "tool", "1.0.0", "tool"))
+}
+
+// testToolArchive returns an archive containing the tool test/tool@1.0.0 and its signature.
+// The Keyring is replaced with a test key for the duration of the test.
+func testToolArchive(t *testing.T) ([]byte, []byte) {
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "tool-1.0.0/tool", Mode: 0755, Size: 4}))
+	_, err := tw.Write([]byte("tool"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	key, err := openpgp.NewEntity("Test", "", "test@example.com", nil)
+	require.NoError(t, err)
+	var signature bytes.Buffer
+	require.NoError(t, openpgp.DetachSign(&signature, key, bytes.NewReader(archive.Bytes()), nil))
+
+	keyring, signedHosts := pkgs.Keyring, pkgs.SignedHosts
+	pkgs.Keyring = openpgp.EntityList{key}
+	// the archives are served by httptest on 127.0.0.1
+	pkgs.SignedHosts = []string{"127.0.0.1"}
+	t.Cleanup(func() { pkgs.Keyring, pkgs.SignedHosts = keyring, signedHosts })
+	return archive.Bytes(), signature.Bytes()
+}
+
+// testToolIndex returns an index containing the tool test/tool@1.0.0 for every system
+func testToolIndex(t *testing.T, url string, checksum []byte) *index.Resource {
+	indexFile := paths.New(t.TempDir(), "package_index.json")
+	require.NoError(t, indexFile.WriteFile([]byte(`{"packages": [{"name": "test", "tools": [{"name": "tool", "version": "1.0.0", "systems": [{
+		"host": "all",
+		"url": "`+url+`",
+		"archiveFileName": "tool-1.0.0.tar.gz",
+		"checksum": "SHA-256:`+hex.EncodeToString(checksum)+`"
+	}]}]}]}`)))
+	return &index.Resource{IndexFile: *indexFile, LastRefresh: time.Now()}
+}
+
+func TestInstallRetryAndResume(t *testing.T) {
+	archive, signature := testToolArchive(t)
+	sum := sha256.Sum256(archive)
+
+	retryDelay := pkgs.RetryDelay
+	pkgs.RetryDelay = time.Millisecond
+	t.Cleanup(func() { pkgs.RetryDelay = retryDelay })
+
+	// the server fails once with an error, then it drops the connection in the middle of the archive
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".sig") {
+			w.Write(signature)
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		switch len(ranges) {
+		case 1:
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+			w.Write(archive[:len(archive)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		default:
+			http.ServeContent(w, r, "tool-1.0.0.tar.gz", time.Time{}, bytes.NewReader(archive))
+		}
+	}))
+	defer server.Close()
+
+	testIndex := testToolIndex(t, server.URL+"/tool-1.0.0.tar.gz", sum[:])
+	payload := &tools.ToolPayload{Name: "tool", Version: "1.0.0", Packager: "test"}
+
+	// without retries the first error is returned
+	tool := pkgs.New(testIndex, t.TempDir(), "replace", utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
+	_, err := tool.Install(context.Background(), payload)
+	require.ErrorContains(t, err, "503")
+
+	ranges = nil
+	var messages []string
+	tmp := t.TempDir()
+	tool = pkgs.New(testIndex, tmp, "replace", utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
+	tool.SetRetries(2)
+	tool.SetLogger(func(msg string) { messages = append(messages, msg) })
+	_, err = tool.Install(context.Background(), payload)
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(tmp, "test", "tool", "1.0.0", "tool"))
+	require.Equal(t, []string{"", "", fmt.Sprintf("bytes=%d-", len(archive)/2)}, ranges)
+	require.Len(t, messages, 3)
+	require.Contains(t, messages[2], fmt.Sprintf("Resuming the download of %s/tool-1.0.0.tar.gz from %d bytes", server.URL, len(archive)/2))
+}
+
+func TestCancelDownload(t *testing.T) {
+	// the server sends a part of the archive and then hangs
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "2048")
+		w.Write(make([]byte, 1024))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	testIndex := testToolIndex(t, server.URL+"/tool-1.0.0.tar.gz", make([]byte, 32))
+	tool := pkgs.New(testIndex, t.TempDir(), "replace", utilities.MustParseRsaPublicKeys([]byte(globals.ArduinoSignaturePubKey)))
+
+	installErr := make(chan error)
+	go func() {
+		_, err := tool.Install(context.Background(), &tools.ToolPayload{Name: "tool", Version: "1.0.0", Packager: "test"})
+		installErr <- err
+	}()
+
+	var download pkgs.DownloadStatus
+	require.Eventually(t, func() bool {
+		downloads := pkgs.Downloads()
+		if len(downloads) != 1 || downloads[0].Downloaded == 0 {
+			return false
+		}
+		download = downloads[0]
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "test/tool/1.0.0", download.Tool)
+	require.Equal(t, int64(1024), download.Downloaded)
+	require.Equal(t, int64(2048), download.Total)
+
+	require.NoError(t, pkgs.CancelDownload(download.ID))
+	require.ErrorContains(t, <-installErr, "cancelled")
+	require.Empty(t, pkgs.Downloads())
+	require.ErrorIs(t, pkgs.CancelDownload(download.ID), pkgs.ErrDownloadNotFound)
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package v2
+
+import (
+	"context"
+	"errors"
+
+	serialsvc "github.com/arduino/arduino-create-agent/gen/serial"
+)
+
+// The errors returned by SerialPorts, answered with the matching HTTP status
+var (
+	ErrInvalidSerialRequest = errors.New("invalid request")
+	ErrSerialPortNotFound   = errors.New("port not found")
+	ErrSerialPortOpen       = errors.New("port already open")
+	ErrSerialNotAllowed     = errors.New("not allowed")
+)
+
+// SerialPorts opens and closes the serial ports for the clients not using the websocket.
+// The data of the open ports is still streamed on the websocket.
+type SerialPorts interface {
+	// Open opens the port at the baud rate, with the buffer type used by the websocket
+	// open command (default, timed or timedraw). An empty buffer type means default.
+	Open(port string, baud int, buffer string) error
+	Close(port string) error
+}
+
+// serialService implements the serial service on top of SerialPorts,
+// turning their errors in the ones of the design
+type serialService struct {
+	ports SerialPorts
+}
+
+// Open opens the port with the buffer type requested
+func (s serialService) Open(ctx context.Context, p *serialsvc.SerialOpenPayload) (*serialsvc.Operation, error) {
+	return serialResult(s.ports.Open(p.Port, p.Baud, p.Buffer))
+}
+
+// Close closes the port if it's open
+func (s serialService) Close(ctx context.Context, p *serialsvc.SerialClosePayload) (*serialsvc.Operation, error) {
+	return serialResult(s.ports.Close(p.Port))
+}
+
+func serialResult(err error) (*serialsvc.Operation, error) {
+	switch {
+	case err == nil:
+		return &serialsvc.Operation{Status: "ok"}, nil
+	case errors.Is(err, ErrInvalidSerialRequest):
+		return nil, serialsvc.MakeInvalidRequest(err)
+	case errors.Is(err, ErrSerialPortNotFound):
+		return nil, serialsvc.MakeNotFound(err)
+	case errors.Is(err, ErrSerialPortOpen):
+		return nil, serialsvc.MakeAlreadyOpen(err)
+	case errors.Is(err, ErrSerialNotAllowed):
+		return nil, serialsvc.MakeNotAllowed(err)
+	}
+	return nil, err
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io"
+	"sync"
+)
+
+// virtualPortName is the name of the virtual board enabled with the virtualPort setting.
+// It echoes the data sent to it, and the uploads on it always succeed without running any tool,
+// so that the clients can be developed and tested without a real board.
+const virtualPortName = "virtual"
+
+// virtualSerialPort is a loopback serial port: what is written on it can be read back
+type virtualSerialPort struct {
+	data      chan []byte
+	pending   []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newVirtualSerialPort() *virtualSerialPort {
+	return &virtualSerialPort{
+		data:   make(chan []byte, 256),
+		closed: make(chan struct{}),
+	}
+}
+
+// Read blocks until some data is written or the port is closed
+func (v *virtualSerialPort) Read(p []byte) (int, error) {
+	if len(v.pending) == 0 {
+		select {
+		case v.pending = <-v.data:
+		case <-v.closed:
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, v.pending)
+	v.pending = v.pending[n:]
+	return n, nil
+}
+
+func (v *virtualSerialPort) Write(p []byte) (int, error) {
+	// check the closing first, select picks randomly among the ready cases
+	select {
+	case <-v.closed:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+	select {
+	case v.data <- append([]byte{}, p...):
+		return len(p), nil
+	case <-v.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+func (v *virtualSerialPort) Close() error {
+	v.closeOnce.Do(func() { close(v.closed) })
+	return nil
+}
+
+func isVirtualPort(portname string) bool {
+	return *virtualPort && portname == virtualPortName
+}
+
+func newVirtualPortItem() *SpPortItem {
+	return &SpPortItem{
+		Name:         virtualPortName,
+		Type:         portTypeSerial,
+		SerialNumber: "VIRTUAL",
+		VendorID:     "0x0000",
+		ProductID:    "0x0000",
+		Ver:          version,
+		Available:    true,
+	}
+}
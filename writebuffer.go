@@ -0,0 +1,56 @@
+// Copyright 2022 Arduino SA
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// WriteBufferDepth is the data queued to be written on a port
+type WriteBufferDepth struct {
+	Cmd      string
+	Port     string
+	Bytes    int64 // the bytes not written on the port yet
+	Messages int   // the send commands waiting in the queues of the port
+}
+
+func (p *serport) writeBufferDepth() WriteBufferDepth {
+	return WriteBufferDepth{
+		Cmd:      "WriteBufferDepth",
+		Port:     p.portConf.Name,
+		Bytes:    max(p.writeQueued.Load(), 0),
+		Messages: len(p.sendBuffered) + len(p.sendNoBuf) + len(p.sendRaw),
+	}
+}
+
+// spWriteBufferDepth reports the data queued to be written on a port, so that the
+// clients streaming to the board can pace the sends without overrunning it.
+// The arguments are: writebufferdepth <portName>
+func spWriteBufferDepth(arg string) {
+	args := strings.Fields(arg)
+	if len(args) < 2 {
+		spErr("You did not specify a port to get the write buffer depth of")
+		return
+	}
+	port, ok := sh.FindPortByName(args[1])
+	if !ok {
+		spErr("We could not find the serial port " + args[1] + " to get the write buffer depth of.")
+		return
+	}
+	msg, _ := json.Marshal(port.writeBufferDepth())
+	h.broadcastSys <- msg
+}